@@ -8,6 +8,7 @@ import (
 
 	"github.com/caarlos0/log"
 	"github.com/goreleaser/goreleaser/v2/internal/gerrors"
+	"github.com/goreleaser/goreleaser/v2/internal/http"
 	"github.com/goreleaser/goreleaser/v2/internal/pipe/defaults"
 	"github.com/goreleaser/goreleaser/v2/pkg/context"
 	"github.com/spf13/cobra"
@@ -54,7 +55,7 @@ func newCheckCmd() *checkCmd {
 				log.WithField("path", path).
 					Info(boldStyle.Render("checking"))
 
-				if err := (defaults.Pipe{}).Run(ctx); err != nil {
+				if err := checkConfig(ctx); err != nil {
 					exits = append(exits, 1)
 					log.WithError(fmt.Errorf("configuration is invalid: %w", err)).Error(path)
 				}
@@ -96,3 +97,18 @@ func newCheckCmd() *checkCmd {
 	root.cmd = cmd
 	return root
 }
+
+// checkConfig sets the configuration defaults, and validates the uploads
+// templates.
+func checkConfig(ctx *context.Context) error {
+	if err := (defaults.Pipe{}).Run(ctx); err != nil {
+		return err
+	}
+	if err := http.Validate(ctx, ctx.Config.Uploads); err != nil {
+		return fmt.Errorf("uploads: %w", err)
+	}
+	if err := http.Validate(ctx, ctx.Config.Artifactories); err != nil {
+		return fmt.Errorf("artifactories: %w", err)
+	}
+	return nil
+}
@@ -48,6 +48,13 @@ func TestCheckConfigInvalid(t *testing.T) {
 	require.Equal(t, 1, cmd.checked)
 }
 
+func TestCheckConfigInvalidUpload(t *testing.T) {
+	cmd := newCheckCmd()
+	cmd.cmd.SetArgs([]string{"-f", "testdata/invalid_upload.yml"})
+	require.Error(t, cmd.cmd.Execute())
+	require.Equal(t, 1, cmd.checked)
+}
+
 func TestCheckConfigInvalidQuiet(t *testing.T) {
 	cmd := newCheckCmd()
 	cmd.cmd.SetArgs([]string{"-f", "testdata/invalid.yml", "-q"})
@@ -26,6 +26,12 @@ func Eval(template *tmpl.Template, files []config.File) ([]config.File, error) {
 			return result, fmt.Errorf("failed to apply template %s: %w", f.Source, err)
 		}
 
+		dst, err := template.Apply(f.Destination)
+		if err != nil {
+			return result, fmt.Errorf("failed to apply template %s: %w", f.Destination, err)
+		}
+		f.Destination = dst
+
 		files, err := fileglob.Glob(glob)
 		if err != nil {
 			return result, fmt.Errorf("globbing failed for pattern %s: %w", glob, err)
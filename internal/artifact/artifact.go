@@ -255,6 +255,12 @@ const (
 	ExtraChecksumOf = "ChecksumOf"
 	ExtraBuilder    = "Builder"
 	ExtranDynLink   = "DynamicallyLinked"
+	ExtraCID        = "CID"
+	ExtraRemoteURL  = "RemoteURL"
+
+	// ExtraUploadHeaderPrefix prefixes the response headers captured by
+	// uploads, e.g. `UploadHeader.ETag`.
+	ExtraUploadHeaderPrefix = "UploadHeader."
 )
 
 // Extras represents the extra fields in an artifact.
@@ -731,6 +737,15 @@ func ByExts(exts ...string) Filter {
 	return autoOr(exts, ByExt)
 }
 
+// ByExtra filter artifacts by the given extra field, compared as a string, so
+// `ByExtra("Replaces", "true")` matches boolean extras as well.
+func ByExtra(key, value string) Filter {
+	return func(a *Artifact) bool {
+		v, ok := a.Extra[key]
+		return ok && fmt.Sprint(v) == value
+	}
+}
+
 // ByBinaryLikeArtifacts filter artifacts down to artifacts that are Binary, UploadableBinary, or UniversalBinary,
 // deduplicating artifacts by path (preferring UploadableBinary over all others). Note: this filter is unique in the
 // sense that it cannot act in isolation of the state of other artifacts; the filter requires the whole list of
@@ -602,6 +602,34 @@ func TestByIDs(t *testing.T) {
 	require.Len(t, artifacts.Filter(ByIDs()).items, 5)
 }
 
+func TestByExtra(t *testing.T) {
+	data := []*Artifact{
+		{
+			Name:  "stable",
+			Extra: map[string]any{"channel": "stable"},
+		},
+		{
+			Name:  "beta",
+			Extra: map[string]any{"channel": "beta"},
+		},
+		{
+			Name:  "replaces",
+			Extra: map[string]any{ExtraReplaces: true},
+		},
+		{
+			Name: "none",
+		},
+	}
+	artifacts := New()
+	for _, a := range data {
+		artifacts.Add(a)
+	}
+
+	require.Len(t, artifacts.Filter(ByExtra("channel", "stable")).items, 1)
+	require.Len(t, artifacts.Filter(ByExtra(ExtraReplaces, "true")).items, 1)
+	require.Empty(t, artifacts.Filter(ByExtra("channel", "")).items)
+}
+
 func TestByExts(t *testing.T) {
 	data := []*Artifact{
 		{
@@ -18,12 +18,24 @@ func IsRepo(ctx context.Context) bool {
 }
 
 func RunWithEnv(ctx context.Context, env []string, args ...string) (string, error) {
+	return run(ctx, "git", env, args...)
+}
+
+// RunWithBinary runs a git command using the given git binary.
+func RunWithBinary(ctx context.Context, binary string, args ...string) (string, error) {
+	if binary == "" {
+		binary = "git"
+	}
+	return run(ctx, binary, []string{}, args...)
+}
+
+func run(ctx context.Context, binary string, env []string, args ...string) (string, error) {
 	extraArgs := []string{
 		"-c", "log.showSignature=false",
 	}
 	args = append(extraArgs, args...)
 	/* #nosec */
-	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd := exec.CommandContext(ctx, binary, args...)
 
 	stdout := bytes.Buffer{}
 	stderr := bytes.Buffer{}
@@ -40,6 +52,10 @@ func RunWithEnv(ctx context.Context, env []string, args ...string) (string, erro
 		Debug("git command result")
 
 	if err != nil {
+		if stderr.Len() == 0 {
+			// e.g. the binary could not be found.
+			return "", err
+		}
 		return "", errors.New(stderr.String())
 	}
 
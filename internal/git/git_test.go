@@ -1,6 +1,8 @@
 package git_test
 
 import (
+	"os"
+	"os/exec"
 	"testing"
 
 	"github.com/goreleaser/goreleaser/v2/internal/git"
@@ -19,6 +21,23 @@ func TestGit(t *testing.T) {
 	require.Empty(t, out)
 }
 
+func TestGitWithBinary(t *testing.T) {
+	ctx := t.Context()
+	bin, err := exec.LookPath("git")
+	require.NoError(t, err)
+
+	out, err := git.RunWithBinary(ctx, bin, "status")
+	require.NoError(t, err)
+	require.NotEmpty(t, out)
+
+	out, err = git.RunWithBinary(ctx, "", "status")
+	require.NoError(t, err)
+	require.NotEmpty(t, out)
+
+	_, err = git.RunWithBinary(ctx, "/nope/git", "status")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
 func TestGitWarning(t *testing.T) {
 	ctx := t.Context()
 	testlib.Mktmp(t)
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"sync/atomic"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/pipe"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+)
+
+// bestEffort keeps track of failed uploads when continue_on_error is set,
+// logging them instead of failing the whole upload.
+type bestEffort struct {
+	upload    *config.Upload
+	failed    atomic.Int64
+	succeeded atomic.Int64
+}
+
+// run runs fn, swallowing its error if continue_on_error is set.
+func (b *bestEffort) run(fn func() error) error {
+	err := fn()
+	if !b.upload.ContinueOnError {
+		return err
+	}
+	if err != nil {
+		log.WithField("instance", b.upload.Name).WithError(err).Warn("upload failed")
+		b.failed.Add(1)
+		return nil
+	}
+	b.succeeded.Add(1)
+	return nil
+}
+
+// result returns a skip if all uploads failed, and nil otherwise.
+func (b *bestEffort) result() error {
+	failed := b.failed.Load()
+	if failed == 0 {
+		return nil
+	}
+	if b.succeeded.Load() == 0 {
+		return pipe.Skipf("all %d uploads failed", failed)
+	}
+	log.WithField("instance", b.upload.Name).Warnf("%d uploads failed", failed)
+	return nil
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+)
+
+// circuitBreaker counts the consecutive failed uploads to each host, so the
+// remaining uploads to a failing host can fail fast instead of hammering it.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{failures: map[string]int{}}
+}
+
+// allow errors if the failure_threshold was reached for the target host.
+func (b *circuitBreaker) allow(upload *config.Upload, target string) error {
+	host := breakerHost(target)
+	if upload.FailureThreshold <= 0 || host == "" {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := b.failures[host]; n >= upload.FailureThreshold {
+		return fmt.Errorf("giving up on %s after %d consecutive failures", host, n)
+	}
+	return nil
+}
+
+// record counts a failed upload to the target host, or resets the count on
+// success.
+func (b *circuitBreaker) record(upload *config.Upload, target string, err error) {
+	host := breakerHost(target)
+	if upload.FailureThreshold <= 0 || host == "" {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.failures[host]++
+		return
+	}
+	delete(b.failures, host)
+}
+
+func breakerHost(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	h "net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/dustin/go-humanize"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+)
+
+// bufferThresholdDefault is the default maximum size of the files kept in
+// memory while uploading them.
+const bufferThresholdDefault = 8 << 20
+
+// bufferThreshold returns the buffer_threshold of the upload, in bytes.
+func bufferThreshold(upload *config.Upload) (int64, error) {
+	if upload.BufferThreshold == "" {
+		return bufferThresholdDefault, nil
+	}
+	n, err := humanize.ParseBytes(upload.BufferThreshold)
+	if err != nil {
+		return 0, fmt.Errorf("invalid buffer_threshold: %w", err)
+	}
+	return int64(min(n, math.MaxInt64)), nil
+}
+
+// mkdirTemp creates a temporary directory in the tmp_dir of the upload, if
+// set, or in the default temporary directory, which honors TMPDIR.
+// Callers must remove it once done.
+func mkdirTemp(upload *config.Upload, pattern string) (string, error) {
+	if upload.TmpDir != "" {
+		if err := os.MkdirAll(upload.TmpDir, 0o755); err != nil {
+			return "", err
+		}
+	}
+	return os.MkdirTemp(upload.TmpDir, pattern)
+}
+
+// bufferFile reads the artifact into memory if it is up to threshold bytes,
+// so it is uploaded from memory, and retried without opening it again.
+// Bigger files are not read, and nil is returned.
+func bufferFile(a *artifact.Artifact, threshold int64) ([]byte, error) {
+	s, err := os.Stat(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	if s.Size() > threshold {
+		return nil, nil
+	}
+	return os.ReadFile(a.Path)
+}
+
+// bufferedAsset returns the buffered contents as an asset, or nil if nothing
+// was buffered.
+func bufferedAsset(data []byte) *asset {
+	if data == nil {
+		return nil
+	}
+	return &asset{
+		ReadCloser: io.NopCloser(bytes.NewReader(data)),
+		Size:       int64(len(data)),
+	}
+}
+
+// spool writes the body returned by open to a temporary file in the tmp_dir
+// the first time it is opened, and reads it from there afterwards, so bodies
+// produced while sending them, e.g. compressed or remote ones, are produced
+// only once, even when retried, and are sent with a known size.
+type spool struct {
+	upload  *config.Upload
+	open    func() (*asset, error)
+	path    string
+	trailer h.Header
+}
+
+func (s *spool) Open() (*asset, error) {
+	if s.path == "" {
+		if err := s.write(); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &asset{
+		ReadCloser: f,
+		Size:       st.Size(),
+		Trailer:    s.trailer,
+	}, nil
+}
+
+func (s *spool) write() error {
+	a, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer a.ReadCloser.Close()
+	dir, err := mkdirTemp(s.upload, "goreleaser-upload-bodies")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "body")
+	if err := writeBody(path, a.ReadCloser); err != nil {
+		_ = os.RemoveAll(dir)
+		return err
+	}
+	// the trailer, if any, is complete once the whole body was read.
+	s.path, s.trailer = path, a.Trailer
+	return nil
+}
+
+func writeBody(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Remove removes the spooled body, if any.
+func (s *spool) Remove() {
+	if s.path != "" {
+		_ = os.RemoveAll(filepath.Dir(s.path))
+	}
+}
@@ -0,0 +1,152 @@
+package http
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+)
+
+// canonicalEntry is an archive member, as hashed by canonicalArchiveSum.
+// Modification times and owners are left out, as they change between runs.
+type canonicalEntry struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Mode     uint32 `json:"mode"`
+	Linkname string `json:"linkname,omitempty"`
+	Sum      string `json:"sum"`
+}
+
+// canonicalizable tells whether canonicalArchiveSum supports the artifact.
+func canonicalizable(a *artifact.Artifact) bool {
+	name := strings.ToLower(a.Path)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalArchiveSum returns the SHA256 of a normalized form of the given
+// zip or tar archive: its members sorted by name, without modification times
+// nor owners, so archives with the same contents have the same sum
+// regardless of how they were created.
+func canonicalArchiveSum(path string) (string, error) {
+	var entries []canonicalEntry
+	var err error
+	if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		entries, err = zipEntries(path)
+	} else {
+		entries, err = tarEntries(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to checksum: %w", err)
+	}
+	slices.SortFunc(entries, func(a, b canonicalEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	h := sha256.New()
+	if err := json.NewEncoder(h).Encode(entries); err != nil {
+		return "", fmt.Errorf("failed to checksum: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func tarEntries(path string) ([]canonicalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if lower := strings.ToLower(path); strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var entries []canonicalEntry
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sum, err := sumReader(tr)
+		if err != nil {
+			return nil, err
+		}
+		mode := hdr.FileInfo().Mode()
+		entries = append(entries, canonicalEntry{
+			Name:     strings.TrimSuffix(hdr.Name, "/"),
+			Type:     mode.Type().String(),
+			Mode:     uint32(mode.Perm()),
+			Linkname: hdr.Linkname,
+			Sum:      sum,
+		})
+	}
+}
+
+func zipEntries(path string) ([]canonicalEntry, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	entries := make([]canonicalEntry, 0, len(zr.File))
+	for _, f := range zr.File {
+		sum, err := zipEntrySum(f)
+		if err != nil {
+			return nil, err
+		}
+		mode := f.Mode()
+		entries = append(entries, canonicalEntry{
+			Name: strings.TrimSuffix(f.Name, "/"),
+			Type: mode.Type().String(),
+			Mode: uint32(mode.Perm()),
+			Sum:  sum,
+		})
+	}
+	return entries, nil
+}
+
+func zipEntrySum(f *zip.File) (string, error) {
+	if f.Mode()&fs.ModeDir != 0 {
+		return sumReader(strings.NewReader(""))
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return sumReader(rc)
+}
+
+func sumReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
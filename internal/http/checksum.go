@@ -0,0 +1,203 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	h "net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+)
+
+// hashedAsset holds the SHA256 of an artifact, and its contents if it is small
+// enough to be buffered.
+type hashedAsset struct {
+	sum  string
+	data []byte
+}
+
+// hashChunkSize is the size of the chunks read while pipelining the hash of
+// big files.
+const hashChunkSize = 1 << 20
+
+// hashAsset hashes the artifact, keeping its contents in memory if it is up
+// to threshold bytes.
+//
+// Request headers must be sent before the body, so a checksum header requires
+// the file to be read before uploading it.
+// Small files are read only once, and uploaded from memory.
+// Bigger files are read twice: once to hash them, and once to upload them.
+func hashAsset(a *artifact.Artifact, fast bool, threshold int64) (*hashedAsset, error) {
+	s, err := os.Stat(a.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checksum: %w", err)
+	}
+	if s.Size() > threshold {
+		checksum := a.Checksum
+		if fast {
+			checksum = func(string) (string, error) {
+				return pipelinedSHA256(a.Path)
+			}
+		}
+		sum, err := checksum("sha256")
+		if err != nil {
+			return nil, err
+		}
+		return &hashedAsset{sum: sum}, nil
+	}
+	data, err := os.ReadFile(a.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checksum: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return &hashedAsset{
+		sum:  hex.EncodeToString(sum[:]),
+		data: data,
+	}, nil
+}
+
+// encode returns the checksum in the given encoding, defaulting to hex.
+func (h *hashedAsset) encode(encoding string) (string, error) {
+	if encoding != ChecksumEncodingBase64 {
+		return h.sum, nil
+	}
+	sum, err := hex.DecodeString(h.sum)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode checksum: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(sum), nil
+}
+
+// withChecksumTrailer hashes the asset while it is read, sending its checksum
+// in the given trailer once the whole body was sent.
+// This avoids reading the file before uploading it, but requires the server to
+// support chunked requests with trailers.
+func withChecksumTrailer(a *asset, name, encoding string) *asset {
+	trailer := h.Header{}
+	trailer.Set(name, "")
+	return &asset{
+		ReadCloser: &trailerHasher{
+			ReadCloser: a.ReadCloser,
+			hash:       sha256.New(),
+			trailer:    trailer,
+			name:       name,
+			encoding:   encoding,
+		},
+		Size:    -1,
+		Trailer: trailer,
+	}
+}
+
+type trailerHasher struct {
+	io.ReadCloser
+	hash     hash.Hash
+	trailer  h.Header
+	name     string
+	encoding string
+}
+
+func (t *trailerHasher) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.hash.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		hashed := &hashedAsset{sum: hex.EncodeToString(t.hash.Sum(nil))}
+		sum, encErr := hashed.encode(t.encoding)
+		if encErr != nil {
+			return n, encErr
+		}
+		t.trailer.Set(t.name, sum)
+	}
+	return n, err
+}
+
+// pipelinedSHA256 hashes the given file, reading the next chunk from disk
+// while the previous one is being hashed.
+func pipelinedSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to checksum: %w", err)
+	}
+	defer f.Close()
+
+	// two buffers are enough: one being read into, and one being hashed.
+	free := make(chan []byte, 2)
+	free <- make([]byte, hashChunkSize)
+	free <- make([]byte, hashChunkSize)
+	full := make(chan []byte)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(full)
+		for buf := range free {
+			n, err := io.ReadFull(f, buf)
+			if n > 0 {
+				full <- buf[:n]
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	h := sha256.New()
+	for buf := range full {
+		h.Write(buf)
+		free <- buf[:cap(buf)]
+	}
+	close(free)
+	select {
+	case err := <-errs:
+		return "", fmt.Errorf("failed to checksum: %w", err)
+	default:
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// open returns the buffered contents as an asset, or nil if the file was not
+// buffered.
+func (h *hashedAsset) open() *asset {
+	if h == nil {
+		return nil
+	}
+	return bufferedAsset(h.data)
+}
+
+// checksumSidecars writes a `<name>.sha256` file for each of the given
+// artifacts into dir, in the sha256sum format, returning them as artifacts.
+func checksumSidecars(dir string, artifacts []*artifact.Artifact) ([]*artifact.Artifact, error) {
+	var result []*artifact.Artifact
+	for _, a := range artifacts {
+		switch a.Type {
+		case artifact.Checksum, artifact.Signature, artifact.Certificate, artifact.Metadata:
+			continue
+		}
+		sum, err := a.Checksum("sha256")
+		if err != nil {
+			return nil, err
+		}
+		name := a.Name + ".sha256"
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(sum+"  "+filepath.Base(a.Name)+"\n"), 0o644); err != nil {
+			return nil, err
+		}
+		result = append(result, &artifact.Artifact{
+			Name: name,
+			Path: path,
+			Type: artifact.Checksum,
+		})
+	}
+	return result, nil
+}
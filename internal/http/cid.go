@@ -0,0 +1,72 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	h "net/http"
+	"strings"
+
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+)
+
+// maxJSONResponseSize is the maximum size of the JSON responses values are
+// captured from.
+const maxJSONResponseSize = 1 << 20
+
+// storeCID captures the CID from the response body into the artifact extras.
+func storeCID(a *artifact.Artifact, body io.Reader, path string) error {
+	cid, err := jsonPathString(body, path)
+	if err != nil {
+		return err
+	}
+	if a.Extra == nil {
+		a.Extra = map[string]any{}
+	}
+	a.Extra[artifact.ExtraCID] = cid
+	return nil
+}
+
+// storeHeaders captures the given response headers into the artifact extras,
+// prefixed by [artifact.ExtraUploadHeaderPrefix].
+// Headers missing from the response are ignored.
+func storeHeaders(a *artifact.Artifact, header h.Header, names []string) {
+	for _, name := range names {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		if a.Extra == nil {
+			a.Extra = map[string]any{}
+		}
+		a.Extra[artifact.ExtraUploadHeaderPrefix+name] = value
+	}
+}
+
+// jsonPathString reads the string at the given path from the JSON response
+// body, e.g. the CID of an upload.
+//
+// The path is a dot-separated list of object keys, optionally prefixed by
+// `$.`, e.g. `$.data.cid`.
+func jsonPathString(body io.Reader, path string) (string, error) {
+	var v any
+	if err := json.NewDecoder(io.LimitReader(body, maxJSONResponseSize)).Decode(&v); err != nil {
+		return "", fmt.Errorf("invalid json response: %w", err)
+	}
+	for key := range strings.SplitSeq(strings.TrimPrefix(path, "$."), ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("%s: not found in response", path)
+		}
+		v, ok = obj[key]
+		if !ok {
+			return "", fmt.Errorf("%s: not found in response", path)
+		}
+	}
+	str, ok := v.(string)
+	if !ok || str == "" {
+		return "", errors.New(path + ": not a string")
+	}
+	return str, nil
+}
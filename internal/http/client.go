@@ -0,0 +1,229 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	h "net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+)
+
+// expectContinueTimeout is how long to wait for the server to answer an
+// `Expect: 100-continue` request before sending its body.
+const expectContinueTimeout = time.Second
+
+// getHTTPClient returns the client to use to connect to the given host, which
+// may include a port.
+func getHTTPClient(upload *config.Upload, host string) (*h.Client, error) {
+	if upload.TrustedCerts == "" && upload.ClientX509Cert == "" && upload.ClientX509Key == "" &&
+		len(upload.ClientX509ByHost) == 0 && upload.ResolveHost == "" &&
+		upload.Timeout == "" && upload.ConnectTimeout == "" && upload.UnixSocket == "" &&
+		!upload.Expect100Continue {
+		return h.DefaultClient, nil
+	}
+	var timeout, connectTimeout time.Duration
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"timeout", upload.Timeout, &timeout},
+		{"connect_timeout", upload.ConnectTimeout, &connectTimeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", d.name, err)
+		}
+		*d.dst = v
+	}
+
+	transport := &h.Transport{
+		Proxy:           h.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{},
+	}
+	client := &h.Client{Transport: transport, Timeout: timeout}
+	if upload.Expect100Continue {
+		// the body is sent anyway if the server doesn't answer in time, as
+		// it might not support the expectation.
+		transport.ExpectContinueTimeout = expectContinueTimeout
+	}
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	if connectTimeout > 0 {
+		transport.DialContext = dialer.DialContext
+		// the TLS handshake is part of connecting as well.
+		transport.TLSHandshakeTimeout = connectTimeout
+	}
+	if upload.TrustedCerts != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			if runtime.GOOS == "windows" {
+				// on windows ignore errors until golang issues #16736 & #18609 get fixed
+				pool = x509.NewCertPool()
+			} else {
+				return nil, err
+			}
+		}
+		pool.AppendCertsFromPEM([]byte(upload.TrustedCerts)) // already validated certs checked by CheckConfig
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	if pair := clientX509(upload, host); pair.Cert != "" && pair.Key != "" {
+		cert, err := tls.LoadX509KeyPair(pair.Cert, pair.Key)
+		if err != nil {
+			return nil, err
+		}
+		cas := &acceptedCAs{}
+		transport.TLSClientConfig.GetClientCertificate = clientCertificate(cert, cas)
+		client.Transport = clientCertTransport{RoundTripper: transport, cas: cas}
+	}
+	if upload.ResolveHost != "" {
+		transport.DialContext = resolvingDialer(dialer, upload.ResolveHost, upload.ResolveAddr)
+	}
+	if upload.UnixSocket != "" {
+		// proxies can't be used to reach a local socket.
+		transport.Proxy = nil
+		transport.DialContext = unixDialer(dialer, upload.UnixSocket)
+	}
+	return client, nil
+}
+
+// clientX509 returns the client certificate to use for the given host: the
+// one in client_x509_by_host for the host and port, or just the host, falling
+// back to client_x509_cert and client_x509_key.
+// It is resolved when creating the client, as the TLS handshake doesn't tell
+// which host asked for the certificate.
+func clientX509(upload *config.Upload, host string) config.UploadClientX509 {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	for _, name := range []string{host, hostname} {
+		for k, pair := range upload.ClientX509ByHost {
+			if strings.EqualFold(k, name) {
+				return pair
+			}
+		}
+	}
+	return config.UploadClientX509{
+		Cert: upload.ClientX509Cert,
+		Key:  upload.ClientX509Key,
+	}
+}
+
+// clientCertificate returns the given certificate only when the server asks
+// for one it supports, so the same configuration works with targets that
+// don't use mTLS.
+// The CAs the server accepts are recorded, to tell them apart when it
+// rejects the certificate.
+func clientCertificate(cert tls.Certificate, cas *acceptedCAs) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		cas.set(cri.AcceptableCAs)
+		if err := cri.SupportsCertificate(&cert); err != nil {
+			log.WithError(err).Warn("server does not support the configured client certificate")
+			return &tls.Certificate{}, nil
+		}
+		return &cert, nil
+	}
+}
+
+// acceptedCAs holds the distinguished names of the CAs the server accepts
+// client certificates from, as told in its last handshake.
+type acceptedCAs struct {
+	mu  sync.Mutex
+	dns []string
+}
+
+func (c *acceptedCAs) set(cas [][]byte) {
+	dns := make([]string, 0, len(cas))
+	for _, der := range cas {
+		var rdn pkix.RDNSequence
+		if _, err := asn1.Unmarshal(der, &rdn); err != nil {
+			continue
+		}
+		dns = append(dns, rdn.String())
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dns = dns
+}
+
+func (c *acceptedCAs) get() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dns
+}
+
+// clientCertTransport adds the CAs the server accepts to the errors of
+// requests whose client certificate was rejected, to help diagnose
+// mismatches.
+type clientCertTransport struct {
+	h.RoundTripper
+	cas *acceptedCAs
+}
+
+func (t clientCertTransport) RoundTrip(req *h.Request) (*h.Response, error) {
+	res, err := t.RoundTripper.RoundTrip(req)
+	if err == nil || !clientCertRejected(err) {
+		return res, err
+	}
+	dns := t.cas.get()
+	if len(dns) == 0 {
+		return res, fmt.Errorf("%w: the server did not tell which CAs it accepts client certificates from", err)
+	}
+	log.WithField("accepted_cas", dns).Warn("server rejected the client certificate")
+	return res, fmt.Errorf("%w: the server accepts client certificates from: %s", err, strings.Join(dns, "; "))
+}
+
+// clientCertRejected tells whether the error is a TLS alert sent by the
+// server because of the client certificate.
+func clientCertRejected(err error) bool {
+	msg := err.Error()
+	for _, alert := range []string{
+		"tls: bad certificate",
+		"tls: unsupported certificate",
+		// also matches unknown certificate authority.
+		"tls: unknown certificate",
+		"tls: certificate required",
+	} {
+		if strings.Contains(msg, "remote error: "+alert) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvingDialer dials addr instead of host, much like curl's --resolve.
+// The request's Host header and TLS server name are kept intact.
+// If addr has no port, the original port is used.
+func resolvingDialer(dialer *net.Dialer, host, addr string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		h, port, err := net.SplitHostPort(address)
+		if err == nil && strings.EqualFold(h, host) {
+			address = addr
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				address = net.JoinHostPort(addr, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+}
+
+// unixDialer dials the given unix domain socket, regardless of the address
+// being connected to.
+func unixDialer(dialer *net.Dialer, socket string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", socket)
+	}
+}
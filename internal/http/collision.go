@@ -0,0 +1,102 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+)
+
+const (
+	// OnCollisionOverwrite uploads all the artifacts resolving to the same
+	// target, so the last one wins, with a warning.
+	OnCollisionOverwrite = "overwrite"
+	// OnCollisionError fails the upload of the artifacts resolving to a
+	// target already used by another artifact.
+	OnCollisionError = "error"
+	// OnCollisionRename uploads the artifacts resolving to a target already
+	// used by another artifact with a numeric suffix in their names.
+	OnCollisionRename = "rename"
+)
+
+// collisions tracks the artifact uploaded to each target of each upload
+// block, so artifacts resolving to the same target don't silently overwrite
+// each other.
+type collisions struct {
+	mu   sync.Mutex
+	seen map[string]string
+}
+
+func newCollisions() *collisions {
+	return &collisions{seen: map[string]string{}}
+}
+
+// claim records the artifact as the one uploaded to the target, and returns
+// the target it should be uploaded to, according to the on_collision policy.
+func (c *collisions) claim(upload *config.Upload, a *artifact.Artifact, target string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := upload.Name + "@" + target
+	prev, ok := c.seen[key]
+	if !ok {
+		c.seen[key] = a.Name
+		return target, nil
+	}
+
+	switch upload.OnCollision {
+	case OnCollisionError:
+		return "", fmt.Errorf("%s resolves to the same target as %s", a.Name, prev)
+	case OnCollisionRename:
+		for i := 1; ; i++ {
+			renamed, err := renameTarget(target, i)
+			if err != nil {
+				return "", err
+			}
+			if _, ok := c.seen[upload.Name+"@"+renamed]; ok {
+				continue
+			}
+			c.seen[upload.Name+"@"+renamed] = a.Name
+			log.WithField("instance", upload.Name).
+				WithField("file", a.Name).
+				WithField("collides-with", prev).
+				Info("target already used, renaming")
+			return renamed, nil
+		}
+	case OnCollisionOverwrite:
+		log.WithField("instance", upload.Name).
+			WithField("file", a.Name).
+			WithField("collides-with", prev).
+			Warn("target already used, overwriting")
+		return target, nil
+	default:
+		// targets omitting e.g. the arch on purpose are common, so the
+		// default is to overwrite silently.
+		log.WithField("instance", upload.Name).
+			WithField("file", a.Name).
+			WithField("collides-with", prev).
+			Debug("target already used, overwriting")
+		return target, nil
+	}
+}
+
+// renameTarget adds the given suffix to the last path element of the target,
+// before its extension, e.g. foo.tar.gz becomes foo-1.tar.gz.
+func renameTarget(target string, n int) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid target: %w", err)
+	}
+	dir, base := path.Split(u.Path)
+	ext := path.Ext(base)
+	if strings.HasSuffix(strings.TrimSuffix(base, ext), ".tar") {
+		ext = ".tar" + ext
+	}
+	u.Path = fmt.Sprintf("%s%s-%d%s", dir, strings.TrimSuffix(base, ext), n, ext)
+	u.RawPath = ""
+	return u.String(), nil
+}
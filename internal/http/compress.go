@@ -0,0 +1,84 @@
+package http
+
+import (
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+)
+
+const (
+	// CompressAlgoGzip compresses uploads with gzip.
+	CompressAlgoGzip = "gzip"
+	// CompressAlgoBrotli compresses uploads with brotli.
+	CompressAlgoBrotli = "br"
+)
+
+// compressSkipExtsDefault are the extensions of files which are usually
+// compressed already, and thus are not compressed again.
+var compressSkipExtsDefault = []string{
+	"gz", "tgz", "zst", "tzst", "xz", "txz", "bz2", "zip", "deb", "rpm", "apk",
+}
+
+// shouldCompress tells whether the given artifact should be compressed, based
+// on its extension.
+func shouldCompress(skipExts []string, a *artifact.Artifact) bool {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(a.Name), "."))
+	return !slices.ContainsFunc(skipExts, func(skip string) bool {
+		return strings.ToLower(strings.TrimPrefix(skip, ".")) == ext
+	})
+}
+
+// compressOpen compresses the opened assets with the given algorithm while
+// they are read.
+// The compressed size is not known in advance, so they are sent using chunked
+// encoding.
+func compressOpen(open func() (*asset, error), algo string) func() (*asset, error) {
+	return func() (*asset, error) {
+		a, err := open()
+		if err != nil {
+			return nil, err
+		}
+		return compressAsset(a, algo), nil
+	}
+}
+
+func compressAsset(a *asset, algo string) *asset {
+	pr, pw := io.Pipe()
+	go func() {
+		cw := newCompressor(pw, algo)
+		_, err := io.Copy(cw, a.ReadCloser)
+		if err == nil {
+			err = cw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return &asset{
+		ReadCloser: &pipeReadCloser{PipeReader: pr, source: a.ReadCloser},
+		Size:       -1,
+		Trailer:    a.Trailer,
+	}
+}
+
+func newCompressor(w io.Writer, algo string) io.WriteCloser {
+	if algo == CompressAlgoBrotli {
+		return brotli.NewWriter(w)
+	}
+	return gzip.NewWriter(w)
+}
+
+// pipeReadCloser is the reading end of a pipe fed from source, closing both
+// when closed.
+type pipeReadCloser struct {
+	*io.PipeReader
+	source io.Closer
+}
+
+func (g *pipeReadCloser) Close() error {
+	_ = g.PipeReader.Close()
+	return g.source.Close()
+}
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"sync"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+)
+
+// deduper tracks the contents uploaded to each target, so the same file
+// registered as multiple artifacts, e.g. universal binaries, is only uploaded
+// once.
+type deduper struct {
+	mu   sync.Mutex
+	seen map[string]string
+}
+
+func newDeduper() *deduper {
+	return &deduper{seen: map[string]string{}}
+}
+
+// claim tells whether the artifact should be uploaded to the target, i.e.
+// whether no artifact with the same contents was uploaded to it yet.
+func (d *deduper) claim(upload *config.Upload, a *artifact.Artifact, target string) (bool, error) {
+	if !upload.Dedupe {
+		return true, nil
+	}
+	sum, err := a.Checksum("sha256")
+	if err != nil {
+		return false, err
+	}
+	key := target + "@" + sum
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if prev, ok := d.seen[key]; ok {
+		log.WithField("instance", upload.Name).
+			WithField("file", a.Name).
+			WithField("duplicate-of", prev).
+			Info("same contents already uploaded to target, skipping")
+		return false, nil
+	}
+	d.seen[key] = a.Path
+	return true, nil
+}
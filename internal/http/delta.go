@@ -0,0 +1,138 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	h "net/http"
+	"os"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// maxDeltaManifestSize is the maximum size of the delta_from manifests read.
+const maxDeltaManifestSize = 10 << 20
+
+// deltaFilter removes the artifacts whose sha256 matches the one in the
+// delta_from manifest, so only new and changed artifacts are uploaded.
+func deltaFilter(ctx *context.Context, upload *config.Upload, kind string, u *uploader, artifacts []*artifact.Artifact) ([]*artifact.Artifact, error) {
+	sums, err := loadDeltaManifest(ctx, upload, kind, u)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: could not load delta_from manifest: %w", upload.Name, kind, err)
+	}
+	result := make([]*artifact.Artifact, 0, len(artifacts))
+	for _, a := range artifacts {
+		prev, ok := sums[a.Name]
+		if !ok {
+			result = append(result, a)
+			continue
+		}
+		sum, err := a.Checksum("sha256")
+		if err != nil {
+			return nil, err
+		}
+		if sum != prev {
+			result = append(result, a)
+			continue
+		}
+		log.WithField("instance", upload.Name).
+			WithField("file", a.Name).
+			Info("unchanged since previous release, skipping")
+	}
+	return result, nil
+}
+
+// loadDeltaManifest reads the delta_from manifest, either from a http(s) URL
+// or from a local path.
+// A missing remote manifest is not an error, so the first release of a series
+// uploads everything.
+func loadDeltaManifest(ctx *context.Context, upload *config.Upload, kind string, u *uploader) (map[string]string, error) {
+	from, err := tmpl.New(ctx).Apply(upload.DeltaFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	lower := strings.ToLower(from)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		f, err := os.Open(from)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseDeltaManifest(f)
+	}
+
+	if err := checkAllowedHost(ctx, from); err != nil {
+		return nil, err
+	}
+	username, err := getUsername(ctx, upload, kind)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := getPassword(ctx, upload, kind)
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{}
+	token, err := u.tokens.token(ctx, upload, from)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+
+	rem := remote{
+		ctx:      ctx,
+		upload:   upload,
+		target:   from,
+		username: username,
+		secret:   secret,
+		headers:  headers,
+		u:        u,
+	}
+	req, err := rem.newRequest(h.MethodGet, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := rem.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == h.StatusNotFound:
+		log.WithField("instance", upload.Name).
+			WithField("manifest", from).
+			Warn("delta_from manifest not found, uploading everything")
+		return map[string]string{}, nil
+	case res.StatusCode != h.StatusOK:
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return parseDeltaManifest(res.Body)
+}
+
+// parseDeltaManifest parses a checksums file in the sha256sum format, as
+// created by the checksum pipe, into a map of file name to sha256.
+func parseDeltaManifest(r io.Reader) (map[string]string, error) {
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(io.LimitReader(r, maxDeltaManifestSize))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		sums[name] = strings.ToLower(sum)
+	}
+	return sums, scanner.Err()
+}
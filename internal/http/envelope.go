@@ -0,0 +1,80 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// jsonEnvelopeDataField is the JSON envelope field holding the base64-encoded
+// artifact contents.
+const jsonEnvelopeDataField = "data"
+
+// jsonEnvelopeWarnSize is the artifact size above which we warn about the
+// memory usage of the JSON envelope, as it is built in memory.
+const jsonEnvelopeWarnSize = 100 << 20
+
+// jsonEnvelope renders the JSON envelope for the given artifact, with its
+// base64-encoded contents in the data field.
+// If body_schema is set, the envelope is validated against it.
+func jsonEnvelope(tpl *tmpl.Template, upload *config.Upload, a *artifact.Artifact) ([]byte, error) {
+	fields := upload.JSONEnvelope
+	if len(fields) == 0 {
+		fields = map[string]string{"name": "{{ .ArtifactName }}"}
+	}
+	envelope := make(map[string]string, len(fields)+1)
+	for k, v := range fields {
+		value, err := tpl.Apply(v)
+		if err != nil {
+			return nil, err
+		}
+		envelope[k] = value
+	}
+
+	data, err := os.ReadFile(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > jsonEnvelopeWarnSize {
+		log.WithField("file", a.Name).
+			WithField("size", len(data)).
+			Warn("json envelope is built in memory, this may use a lot of memory for big files")
+	}
+	envelope[jsonEnvelopeDataField] = base64.StdEncoding.EncodeToString(data)
+
+	if upload.BodySchema != "" {
+		if err := validateEnvelope(upload.BodySchema, envelope); err != nil {
+			return nil, err
+		}
+	}
+
+	bts, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal json envelope: %w", err)
+	}
+	return bts, nil
+}
+
+// validateEnvelope validates the envelope against the JSON schema at the
+// given path.
+func validateEnvelope(path string, envelope map[string]string) error {
+	schema, err := jsonschema.Compile(path)
+	if err != nil {
+		return fmt.Errorf("invalid body_schema: %w", err)
+	}
+	doc := make(map[string]any, len(envelope))
+	for k, v := range envelope {
+		doc[k] = v
+	}
+	if err := schema.Validate(doc); err != nil {
+		return fmt.Errorf("json envelope doesn't match body_schema: %w", err)
+	}
+	return nil
+}
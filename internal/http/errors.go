@@ -0,0 +1,39 @@
+package http
+
+import (
+	"fmt"
+
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+)
+
+// UploadError is returned when an artifact could not be uploaded to its
+// target.
+type UploadError struct {
+	// Name of the upload configuration.
+	Name string
+	// Kind of upload, e.g. "upload" or "artifactory".
+	Kind     string
+	Artifact *artifact.Artifact
+	Target   string
+	// StatusCode of the last response, zero if no response was received.
+	StatusCode int
+	Err        error
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("%s: %s: upload failed: %v", e.Name, e.Kind, e.Err)
+}
+
+func (e *UploadError) Unwrap() error { return e.Err }
+
+// AuthError is returned when the server rejects the upload credentials,
+// i.e. with a 401 or 403 status.
+// It is wrapped by an [UploadError].
+type AuthError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *AuthError) Error() string { return e.Err.Error() }
+
+func (e *AuthError) Unwrap() error { return e.Err }
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	h "net/http"
+	"strings"
+)
+
+// ExistsMethodPropfind checks whether files exist using the WebDAV PROPFIND
+// method.
+const ExistsMethodPropfind = "PROPFIND"
+
+// propfindBody asks for the resource type only, as we only care whether the
+// file exists.
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`
+
+// maxPropfindResponseSize is the maximum size of the PROPFIND responses read.
+const maxPropfindResponseSize = 1 << 20
+
+// davMultistatus is the subset of a WebDAV multistatus response we use.
+type davMultistatus struct {
+	Responses []struct {
+		Status    string `xml:"status"`
+		Propstats []struct {
+			Status string `xml:"status"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// exists tells whether the target was uploaded already, using the configured
+// exists_method.
+func (v remote) exists() (bool, error) {
+	if v.upload.ExistsMethod == ExistsMethodPropfind {
+		return v.propfind()
+	}
+	req, err := v.newRequest(h.MethodHead, nil)
+	if err != nil {
+		return false, err
+	}
+	res, err := v.do(req)
+	if err != nil {
+		return false, fmt.Errorf("could not check if file exists: %w", err)
+	}
+	_ = res.Body.Close()
+	return existsStatus(res)
+}
+
+func (v remote) propfind() (bool, error) {
+	req, err := v.newRequest(ExistsMethodPropfind, strings.NewReader(propfindBody))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Depth", "0")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	res, err := v.do(req)
+	if err != nil {
+		return false, fmt.Errorf("could not check if file exists: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != h.StatusMultiStatus {
+		return existsStatus(res)
+	}
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(io.LimitReader(res.Body, maxPropfindResponseSize)).Decode(&ms); err != nil {
+		return false, fmt.Errorf("could not check if file exists: invalid multistatus response: %w", err)
+	}
+	for _, r := range ms.Responses {
+		if isOKStatusLine(r.Status) {
+			return true, nil
+		}
+		for _, ps := range r.Propstats {
+			if isOKStatusLine(ps.Status) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// existsStatus tells whether a file exists based on the response status.
+func existsStatus(res *h.Response) (bool, error) {
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode <= 299:
+		return true, nil
+	case res.StatusCode == h.StatusNotFound || res.StatusCode == h.StatusGone:
+		return false, nil
+	default:
+		return false, fmt.Errorf("could not check if file exists: unexpected http response status: %s", res.Status)
+	}
+}
+
+// isOKStatusLine tells whether the given WebDAV status, e.g.
+// `HTTP/1.1 200 OK`, is a 2xx one.
+func isOKStatusLine(status string) bool {
+	fields := strings.Fields(status)
+	return len(fields) >= 2 && strings.HasPrefix(fields[1], "2")
+}
@@ -0,0 +1,70 @@
+package http
+
+import (
+	"io"
+	"maps"
+	"mime/multipart"
+	"slices"
+
+	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+)
+
+// formFileField is the multipart form field the artifact is sent as, when
+// using the form body mode.
+const formFileField = "file"
+
+// formFields renders the form fields of the given upload.
+func formFields(tpl *tmpl.Template, upload *config.Upload) (map[string]string, error) {
+	fields := make(map[string]string, len(upload.FormFields)+1)
+	for k, v := range upload.FormFields {
+		value, err := tpl.Apply(v)
+		if err != nil {
+			return nil, err
+		}
+		fields[k] = value
+	}
+	return fields, nil
+}
+
+// formOpen wraps the opened assets in a multipart form, with the given fields
+// followed by the asset itself.
+// The boundary is kept between retries so the content type header remains
+// valid.
+func formOpen(open func() (*asset, error), boundary, name string, fields map[string]string) func() (*asset, error) {
+	return func() (*asset, error) {
+		a, err := open()
+		if err != nil {
+			return nil, err
+		}
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(writeForm(w, boundary, name, fields, a.ReadCloser))
+		}()
+		return &asset{
+			ReadCloser: &pipeReadCloser{PipeReader: r, source: a.ReadCloser},
+			Size:       -1,
+		}, nil
+	}
+}
+
+// writeForm writes the given fields and file as a multipart form to w.
+func writeForm(w io.Writer, boundary, name string, fields map[string]string, file io.Reader) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		if err := mw.WriteField(k, fields[k]); err != nil {
+			return err
+		}
+	}
+	part, err := mw.CreateFormFile(formFileField, name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return err
+	}
+	return mw.Close()
+}
@@ -0,0 +1,175 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/internal/redact"
+	"github.com/goreleaser/goreleaser/v2/internal/semerrgroup"
+	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// groupFormField is the multipart form field each artifact of a group is sent
+// as.
+const groupFormField = "files"
+
+// uploadGroups buckets the artifacts by the evaluated group_template, and
+// uploads each bucket in a single multipart request.
+func uploadGroups(ctx *context.Context, upload *config.Upload, artifacts []*artifact.Artifact, kind string, check ResponseChecker, u *uploader) error {
+	var keys []string
+	groups := map[string][]*artifact.Artifact{}
+	for _, a := range artifacts {
+		tpl, err := artifactTemplate(ctx, upload, a, upload.GroupTemplate)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+		}
+		key, err := tpl.Apply(upload.GroupTemplate)
+		if err != nil {
+			return fmt.Errorf("%s: %s: failed to resolve group_template: %w", upload.Name, kind, err)
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], a)
+	}
+
+	be := &bestEffort{upload: upload}
+	g := semerrgroup.New(ctx.Parallelism)
+	for _, key := range keys {
+		g.Go(func() error {
+			return be.run(func() error {
+				return uploadGroup(ctx, upload, key, groups[key], kind, check, u)
+			})
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return be.result()
+}
+
+// uploadGroup uploads the given artifacts as a multipart request.
+// The target and custom headers templates have access to the group as
+// `.Group`, but not to the artifact fields.
+func uploadGroup(ctx *context.Context, upload *config.Upload, group string, artifacts []*artifact.Artifact, kind string, check ResponseChecker, u *uploader) error {
+	username, err := getUsername(ctx, upload, kind)
+	if err != nil {
+		return fmt.Errorf("%s: could not get username: %w", upload.Name, err)
+	}
+	secret, err := getPassword(ctx, upload, kind)
+	if err != nil {
+		return fmt.Errorf("%s: could not get password: %w", upload.Name, err)
+	}
+
+	for _, a := range artifacts {
+		if s, err := os.Stat(a.Path); err == nil && s.IsDir() {
+			return fmt.Errorf("%s: upload failed: the asset to upload can't be a directory", kind)
+		}
+	}
+
+	tpl := tmpl.New(ctx).WithExtraFields(tmpl.Fields{
+		"Group": group,
+	})
+	targetURL, err := tpl.Apply(upload.Target)
+	if err != nil {
+		return fmt.Errorf("%s: %s: error while building target URL: %w", upload.Name, kind, err)
+	}
+	log.Debugf("generated target url: %s", redact.String(targetURL, ctx.Env.Strings()))
+	if err := checkScheme(targetURL); err != nil {
+		return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+	}
+	if err := checkAllowedHost(ctx, targetURL); err != nil {
+		return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+	}
+
+	headers := make(map[string]string, len(upload.CustomHeaders)+3)
+	for name, value := range upload.CustomHeaders {
+		resolvedValue, err := tpl.Apply(value)
+		if err != nil {
+			return fmt.Errorf("%s: %s: failed to resolve custom_headers template: %w", upload.Name, kind, err)
+		}
+		headers[name] = customHeaderValue(name, resolvedValue)
+	}
+	if upload.VersionHeader != "" {
+		headers[upload.VersionHeader] = ctx.Version
+	}
+	if upload.Expect100Continue {
+		headers["Expect"] = "100-continue"
+	}
+	addProvenanceHeaders(ctx, upload, headers)
+	token, err := u.tokens.token(ctx, upload, targetURL)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+	}
+	if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+
+	log.WithField("instance", upload.Name).
+		WithField("group", group).
+		WithField("files", len(artifacts)).
+		Info("uploading")
+
+	if codes := upload.SuccessCodes[successCodesDefault]; len(codes) > 0 {
+		check = successCodesChecker(codes, check)
+	}
+	if upload.SuccessHeader != "" {
+		check = successHeaderChecker(upload, check)
+	}
+
+	// the boundary is kept between retries so the content type header
+	// remains valid.
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	headers["Content-Type"] = "multipart/form-data; boundary=" + boundary
+	open := func() (*asset, error) {
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(writeGroup(w, boundary, artifacts))
+		}()
+		return &asset{ReadCloser: r, Size: -1}, nil
+	}
+
+	if err := u.breaker.allow(upload, targetURL); err != nil {
+		return fmt.Errorf("%s: %s: %s: %w", upload.Name, kind, group, err)
+	}
+	res, err := uploadAssetToServer(ctx, upload, targetURL, username, secret, headers, open, check, u)
+	u.breaker.record(upload, targetURL, err)
+	if err != nil {
+		return newUploadError(ctx, upload, kind, nil, targetURL, res, err)
+	}
+	if err := res.Body.Close(); err != nil {
+		log.WithError(err).Warn("failed to close response body")
+	}
+	return nil
+}
+
+// writeGroup writes the given artifacts as a multipart form to w.
+func writeGroup(w io.Writer, boundary string, artifacts []*artifact.Artifact) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+	for _, a := range artifacts {
+		part, err := mw.CreateFormFile(groupFormField, filepath.Base(a.Name))
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(a.Path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(part, f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
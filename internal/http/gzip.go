@@ -0,0 +1,87 @@
+package http
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+)
+
+// isGzip tells whether the given artifact is gzip-compressed, based on its
+// name.
+func isGzip(a *artifact.Artifact) bool {
+	return strings.HasSuffix(a.Name, ".gz") || strings.HasSuffix(a.Name, ".tgz")
+}
+
+// gzipVerifier passes the read bytes through a gzip reader as they are read,
+// so corrupted archives fail the upload without being loaded into memory.
+type gzipVerifier struct {
+	rc   io.ReadCloser
+	pw   *io.PipeWriter
+	done chan error
+	err  error
+}
+
+func newGzipVerifier(rc io.ReadCloser) *gzipVerifier {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		gz, err := gzip.NewReader(pr)
+		if err == nil {
+			_, err = io.Copy(io.Discard, gz)
+		}
+		// unblock the writer in case we stopped before the end of the file.
+		_ = pr.CloseWithError(errGzipVerified)
+		done <- err
+	}()
+	return &gzipVerifier{rc: rc, pw: pw, done: done}
+}
+
+var (
+	errGzipVerified  = errors.New("gzip verification finished")
+	errCorruptedGzip = errors.New("corrupted gzip file")
+)
+
+func (v *gzipVerifier) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err := v.rc.Read(p)
+	if n > 0 {
+		if _, werr := v.pw.Write(p[:n]); werr != nil {
+			// the gzip reader stopped before the end of the file.
+			v.err = v.result()
+			if v.err == nil {
+				v.err = fmt.Errorf("%w: trailing data", errCorruptedGzip)
+			}
+			return n, v.err
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		_ = v.pw.Close()
+		if v.err = v.result(); v.err != nil {
+			return n, v.err
+		}
+	}
+	return n, err
+}
+
+func (v *gzipVerifier) result() error {
+	if v.done == nil {
+		return nil
+	}
+	err := <-v.done
+	v.done = nil
+	if err != nil {
+		return fmt.Errorf("%w: %v", errCorruptedGzip, err)
+	}
+	return nil
+}
+
+func (v *gzipVerifier) Close() error {
+	_ = v.pw.CloseWithError(io.ErrClosedPipe)
+	return v.rc.Close()
+}
@@ -2,16 +2,28 @@
 package http
 
 import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"mime/multipart"
 	h "net/http"
+	"net/url"
 	"os"
-	"runtime"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/log"
+	"github.com/dustin/go-humanize"
 	"github.com/goreleaser/goreleaser/v2/internal/artifact"
 	"github.com/goreleaser/goreleaser/v2/internal/extrafiles"
 	"github.com/goreleaser/goreleaser/v2/internal/pipe"
@@ -21,6 +33,8 @@ import (
 	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
 	"github.com/goreleaser/goreleaser/v2/pkg/config"
 	"github.com/goreleaser/goreleaser/v2/pkg/context"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"golang.org/x/sync/semaphore"
 )
 
 const (
@@ -30,15 +44,46 @@ const (
 	ModeArchive = "archive"
 )
 
+const (
+	// BodyModeFile sends the artifact contents as the request body.
+	BodyModeFile = "file"
+	// BodyModeEmpty sends requests without a body, e.g. to register an
+	// artifact uploaded previously.
+	BodyModeEmpty = "empty"
+	// BodyModeJSONEnvelope sends a JSON object with the base64-encoded
+	// artifact contents and the configured json_envelope fields.
+	BodyModeJSONEnvelope = "json_envelope"
+	// BodyModeForm sends a multipart form with the artifact contents and the
+	// configured form_fields.
+	BodyModeForm = "form"
+)
+
+const (
+	// ChecksumEncodingHex encodes the checksum header as lowercase hex.
+	ChecksumEncodingHex = "hex"
+	// ChecksumEncodingBase64 encodes the checksum header as standard base64.
+	ChecksumEncodingBase64 = "base64"
+)
+
+// Keys accepted by the success_codes setting.
+const (
+	successCodesDefault   = "default"
+	successCodesChecksum  = "checksum"
+	successCodesMetadata  = "metadata"
+	successCodesSignature = "signature"
+)
+
 type asset struct {
 	ReadCloser io.ReadCloser
 	Size       int64
+	// Trailer, if set, is sent after the body, using chunked encoding.
+	Trailer h.Header
 }
 
 func assetOpen(kind string, a *artifact.Artifact) (*asset, error) {
 	f, err := os.Open(a.Path)
 	if err != nil {
-		return nil, err
+		return nil, assetOpenError(kind, a.Path, err)
 	}
 	s, err := f.Stat()
 	if err != nil {
@@ -55,6 +100,19 @@ func assetOpen(kind string, a *artifact.Artifact) (*asset, error) {
 	}, nil
 }
 
+// assetOpenError tells apart missing files from broken symlinks, which
+// os.Open reports the same way.
+func assetOpenError(kind, path string, err error) error {
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if s, lerr := os.Lstat(path); lerr == nil && s.Mode()&os.ModeSymlink != 0 {
+		dest, _ := os.Readlink(path)
+		return fmt.Errorf("%s: upload failed: the asset to upload is a broken symlink to %q: %w", kind, dest, err)
+	}
+	return fmt.Errorf("%s: upload failed: the asset to upload does not exist: %w", kind, err)
+}
+
 // Defaults sets default configuration options on upload structs.
 func Defaults(uploads []config.Upload) error {
 	for i := range uploads {
@@ -64,17 +122,27 @@ func Defaults(uploads []config.Upload) error {
 }
 
 func defaults(upload *config.Upload) {
-	if upload.Mode == "" {
+	// in strict mode, an empty mode is reported by CheckConfig instead.
+	if upload.Mode == "" && !upload.Strict {
 		upload.Mode = ModeArchive
 	}
 	if upload.Method == "" {
 		upload.Method = h.MethodPut
 	}
+	if upload.Compress && len(upload.CompressSkipExts) == 0 {
+		upload.CompressSkipExts = compressSkipExtsDefault
+	}
+	if upload.RangeChunkSize != "" && upload.RangeParallelism == 0 {
+		upload.RangeParallelism = rangeParallelismDefault
+	}
+	if upload.SidecarTemplate != "" && upload.SidecarExt == "" {
+		upload.SidecarExt = sidecarExtDefault
+	}
 }
 
 // CheckConfig validates an upload configuration returning a descriptive error when appropriate.
 func CheckConfig(ctx *context.Context, upload *config.Upload, kind string) error {
-	if upload.Target == "" {
+	if upload.Target == "" && upload.InitiateTarget == "" && upload.RawRequestTemplate == "" {
 		return misconfigured(kind, upload, "missing target")
 	}
 
@@ -82,6 +150,43 @@ func CheckConfig(ctx *context.Context, upload *config.Upload, kind string) error
 		return misconfigured(kind, upload, "missing name")
 	}
 
+	if upload.RawRequestTemplate != "" && (upload.Target != "" || upload.InitiateTarget != "" || len(upload.Mirrors) > 0 || upload.FallbackTarget != "" ||
+		len(upload.CustomHeaders) > 0 || upload.GroupTemplate != "" || upload.BodyMode != "" || upload.Compress || upload.ChecksumTrailer || upload.RangeChunkSize != "") {
+		return misconfigured(kind, upload, "raw_request_template can't be used with target, initiate_target, mirrors, fallback_target, custom_headers, group_template, body_mode, compress, checksum_trailer or range_chunk_size")
+	}
+
+	// the raw_request_template target is only checked when uploading.
+	if upload.RawRequestTemplate == "" {
+		if err := checkTargetHost(ctx, kind, upload, "target", cmp.Or(upload.Target, upload.InitiateTarget)); err != nil {
+			return err
+		}
+	}
+
+	for i, mirror := range upload.Mirrors {
+		if mirror == "" {
+			return misconfigured(kind, upload, fmt.Sprintf("mirrors.%d is empty", i))
+		}
+		if err := checkTargetHost(ctx, kind, upload, fmt.Sprintf("mirrors.%d", i), mirror); err != nil {
+			return err
+		}
+	}
+
+	if upload.FallbackTarget != "" {
+		if err := checkTargetHost(ctx, kind, upload, "fallback_target", upload.FallbackTarget); err != nil {
+			return err
+		}
+	}
+
+	if (len(upload.Mirrors) > 0 || upload.FallbackTarget != "") && upload.GroupTemplate != "" {
+		return misconfigured(kind, upload, "mirrors and fallback_target can't be used with group_template")
+	}
+
+	// strict uploads are not defaulted, and fail instead of being skipped,
+	// so the mistake is not missed.
+	if upload.Mode == "" && upload.Strict {
+		return fmt.Errorf("%s: %s: missing mode", upload.Name, kind)
+	}
+
 	if upload.Mode != ModeArchive && upload.Mode != ModeBinary {
 		return misconfigured(kind, upload, "mode must be 'binary' or 'archive'")
 	}
@@ -96,14 +201,212 @@ func CheckConfig(ctx *context.Context, upload *config.Upload, kind string) error
 		return fmt.Errorf("%s: could not get password: %w", upload.Name, err)
 	}
 
-	passwordEnv := fmt.Sprintf("%s_%s_SECRET", strings.ToUpper(kind), strings.ToUpper(upload.Name))
+	passwordEnv := envPrefix(upload, kind) + "_SECRET"
 
-	if password != "" && username == "" {
-		return misconfigured(kind, upload, fmt.Sprintf("'username' is required when 'password' or the '%s' environment variable are set", passwordEnv))
+	if isSFTP(upload.Target) {
+		if err := checkSFTP(kind, upload, username, password); err != nil {
+			return err
+		}
+	} else {
+		if password != "" && username == "" {
+			return misconfigured(kind, upload, fmt.Sprintf("'username' is required when 'password' or the '%s' environment variable are set", passwordEnv))
+		}
+
+		if username != "" && password == "" {
+			return misconfigured(kind, upload, fmt.Sprintf("either 'password' or environment variable '%s' are required when 'username' is set", passwordEnv))
+		}
+	}
+
+	switch upload.BodyMode {
+	case "", BodyModeFile, BodyModeEmpty, BodyModeJSONEnvelope, BodyModeForm:
+	default:
+		return misconfigured(kind, upload, "body_mode must be 'file', 'empty', 'json_envelope' or 'form'")
+	}
+
+	if upload.BodyMode != BodyModeForm && (len(upload.FormFields) > 0 || upload.FormChecksumField != "") {
+		return misconfigured(kind, upload, "form_fields and form_checksum_field require the 'form' body_mode")
+	}
+
+	switch upload.ChecksumEncoding {
+	case "", ChecksumEncodingHex, ChecksumEncodingBase64:
+	default:
+		return misconfigured(kind, upload, "checksum_encoding must be 'hex' or 'base64'")
+	}
+
+	if upload.ChecksumTrailer && (upload.ChecksumHeader == "" || (upload.BodyMode != "" && upload.BodyMode != BodyModeFile)) {
+		return misconfigured(kind, upload, "checksum_trailer requires checksum_header, and can't be used with body_mode")
+	}
+
+	switch upload.OnCollision {
+	case "", OnCollisionOverwrite, OnCollisionError, OnCollisionRename:
+	default:
+		return misconfigured(kind, upload, "on_collision must be 'overwrite', 'error' or 'rename'")
 	}
 
-	if username != "" && password == "" {
-		return misconfigured(kind, upload, fmt.Sprintf("either 'password' or environment variable '%s' are required when 'username' is set", passwordEnv))
+	if upload.OnCollision != "" && (upload.GroupTemplate != "" || upload.InitiateTarget != "") {
+		return misconfigured(kind, upload, "on_collision can't be used with group_template or initiate_target")
+	}
+
+	switch upload.CompressAlgo {
+	case "", CompressAlgoGzip, CompressAlgoBrotli:
+	default:
+		return misconfigured(kind, upload, "compress_algo must be 'gzip' or 'br'")
+	}
+
+	switch upload.ExistsMethod {
+	case "", h.MethodHead, ExistsMethodPropfind:
+	default:
+		return misconfigured(kind, upload, "exists_method must be 'HEAD' or 'PROPFIND'")
+	}
+
+	switch upload.RetryJitter {
+	case "", RetryJitterNone, RetryJitterFull, RetryJitterEqual:
+	default:
+		return misconfigured(kind, upload, "retry_jitter must be 'none', 'full' or 'equal'")
+	}
+
+	switch upload.VerifyMode {
+	case "", VerifyModeFull, VerifyModeSample:
+	default:
+		return misconfigured(kind, upload, "verify_mode must be 'full' or 'sample'")
+	}
+
+	if upload.VerifyAfterUpload && ((upload.BodyMode != "" && upload.BodyMode != BodyModeFile) || upload.GroupTemplate != "" || upload.CustomArtifactName) {
+		return misconfigured(kind, upload, "verify_after_upload can't be used with body_mode, group_template or custom_artifact_name")
+	}
+
+	if upload.Dedupe && upload.GroupTemplate != "" {
+		return misconfigured(kind, upload, "dedupe can't be used with group_template")
+	}
+
+	if upload.VerifySize && ((upload.BodyMode != "" && upload.BodyMode != BodyModeFile) || upload.GroupTemplate != "" || upload.CustomArtifactName || upload.Compress) {
+		return misconfigured(kind, upload, "verify_size can't be used with body_mode, group_template, custom_artifact_name or compress")
+	}
+
+	if upload.SkipExisting && upload.GroupTemplate != "" {
+		return misconfigured(kind, upload, "skip_existing can't be used with group_template")
+	}
+
+	if upload.CanonicalizeArchiveChecksum && (upload.ChecksumHeader == "" || upload.ChecksumTrailer) {
+		return misconfigured(kind, upload, "canonicalize_archive_checksum requires checksum_header, and can't be used with checksum_trailer")
+	}
+
+	if upload.GroupTemplate != "" && ((upload.BodyMode != "" && upload.BodyMode != BodyModeFile) || upload.ChecksumHeader != "" || upload.IdempotencyKeyHeader != "" || upload.MtimeHeader != "") {
+		return misconfigured(kind, upload, "group_template can't be used with body_mode, checksum_header, idempotency_key_header or mtime_header")
+	}
+
+	if _, ok := upload.JSONEnvelope[jsonEnvelopeDataField]; ok {
+		return misconfigured(kind, upload, fmt.Sprintf("json_envelope can't override the '%s' field", jsonEnvelopeDataField))
+	}
+
+	if upload.InitiateTarget != "" {
+		switch {
+		case upload.Target != "":
+			return misconfigured(kind, upload, "target and initiate_target can't be used together")
+		case upload.UploadURLJSONPath == "" && upload.UploadURLHeader == "":
+			return misconfigured(kind, upload, "initiate_target requires upload_url_json_path or upload_url_header")
+		case upload.UploadURLJSONPath != "" && upload.UploadURLHeader != "":
+			return misconfigured(kind, upload, "upload_url_json_path and upload_url_header can't be used together")
+		case upload.UploadURLHeader != "" && (upload.BodyMode != "" || upload.Compress || upload.ChecksumTrailer):
+			return misconfigured(kind, upload, "upload_url_header can't be used with body_mode, compress or checksum_trailer")
+		case upload.GroupTemplate != "" || upload.SkipExisting || upload.VerifyAfterUpload || upload.VerifySize || upload.RangeChunkSize != "" || len(upload.Mirrors) > 0 || upload.FallbackTarget != "":
+			return misconfigured(kind, upload, "initiate_target can't be used with group_template, skip_existing, verify_after_upload, verify_size, range_chunk_size, mirrors or fallback_target")
+		}
+	} else if upload.UploadURLJSONPath != "" {
+		return misconfigured(kind, upload, "upload_url_json_path requires initiate_target")
+	} else if upload.UploadURLHeader != "" {
+		return misconfigured(kind, upload, "upload_url_header requires initiate_target")
+	}
+
+	if upload.BodySchema != "" {
+		if upload.BodyMode != BodyModeJSONEnvelope {
+			return misconfigured(kind, upload, "body_schema requires the json_envelope body_mode")
+		}
+		if _, err := jsonschema.Compile(upload.BodySchema); err != nil {
+			return misconfigured(kind, upload, "invalid body_schema: "+err.Error())
+		}
+	}
+
+	if upload.HashFanout < 0 || upload.HashFanout > maxHashFanout {
+		return misconfigured(kind, upload, fmt.Sprintf("hash_fanout must be between 0 and %d", maxHashFanout))
+	}
+
+	if upload.MaxBytesPerSecond < 0 {
+		return misconfigured(kind, upload, "max_bytes_per_second can't be negative")
+	}
+
+	if upload.SuccessHeaderValue != "" && upload.SuccessHeader == "" {
+		return misconfigured(kind, upload, "success_header_value requires success_header")
+	}
+
+	for key, codes := range upload.SuccessCodes {
+		switch key {
+		case successCodesDefault, successCodesChecksum, successCodesMetadata, successCodesSignature:
+		default:
+			return misconfigured(kind, upload, fmt.Sprintf("invalid success_codes key %q", key))
+		}
+		for _, code := range codes {
+			if code < 100 || code > 599 {
+				return misconfigured(kind, upload, fmt.Sprintf("invalid success_codes status %d", code))
+			}
+		}
+	}
+
+	for _, d := range []struct{ name, value string }{
+		{"timeout", upload.Timeout},
+		{"connect_timeout", upload.ConnectTimeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d.value); err != nil {
+			return misconfigured(kind, upload, fmt.Sprintf("invalid %s: %v", d.name, err))
+		}
+	}
+
+	if upload.FailureThreshold < 0 {
+		return misconfigured(kind, upload, "failure_threshold can't be negative")
+	}
+
+	if upload.MaxFileSize != "" {
+		if _, err := humanize.ParseBytes(upload.MaxFileSize); err != nil {
+			return misconfigured(kind, upload, fmt.Sprintf("invalid max_file_size: %v", err))
+		}
+	}
+
+	if _, err := bufferThreshold(upload); err != nil {
+		return misconfigured(kind, upload, err.Error())
+	}
+
+	if upload.ChunkChecksum && (upload.RangeChunkSize == "" || upload.ChecksumHeader == "") {
+		return misconfigured(kind, upload, "chunk_checksum requires range_chunk_size and checksum_header")
+	}
+
+	if upload.RangeChunkSize != "" {
+		if _, err := humanize.ParseBytes(upload.RangeChunkSize); err != nil {
+			return misconfigured(kind, upload, fmt.Sprintf("invalid range_chunk_size: %v", err))
+		}
+		if (upload.BodyMode != "" && upload.BodyMode != BodyModeFile) || upload.GroupTemplate != "" || upload.Compress || upload.ChecksumTrailer || upload.VerifyGzip {
+			return misconfigured(kind, upload, "range_chunk_size can't be used with body_mode, group_template, compress, checksum_trailer or verify_gzip")
+		}
+	}
+
+	if oauth2 := upload.OAuth2; (oauth2.TokenURL == "") != (oauth2.ClientID == "") {
+		return misconfigured(kind, upload, "'oauth2.token_url' and 'oauth2.client_id' must be set together")
+	}
+
+	if (upload.ResolveHost == "") != (upload.ResolveAddr == "") {
+		return misconfigured(kind, upload, "'resolve_host' and 'resolve_addr' must be set together")
+	}
+
+	for _, realm := range slices.Sorted(maps.Keys(upload.CredentialsByRealm)) {
+		if upload.CredentialsByRealm[realm].Username == "" {
+			return misconfigured(kind, upload, fmt.Sprintf("'credentials_by_realm.%s' requires a username", realm))
+		}
+	}
+
+	if upload.UnixSocket != "" && (isSFTP(upload.Target) || upload.ResolveHost != "") {
+		return misconfigured(kind, upload, "unix_socket can't be used with sftp targets or resolve_host")
 	}
 
 	if upload.TrustedCerts != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(upload.TrustedCerts)) {
@@ -122,10 +425,75 @@ func CheckConfig(ctx *context.Context, upload *config.Upload, kind string) error
 				"client x509 certificate could not be loaded from the specified 'client_x509_cert' and 'client_x509_key'")
 		}
 	}
+	for _, host := range slices.Sorted(maps.Keys(upload.ClientX509ByHost)) {
+		pair := upload.ClientX509ByHost[host]
+		if pair.Cert == "" || pair.Key == "" {
+			return misconfigured(kind, upload, fmt.Sprintf("'client_x509_by_host.%s' requires both 'cert' and 'key'", host))
+		}
+		if _, err := tls.LoadX509KeyPair(pair.Cert, pair.Key); err != nil {
+			return misconfigured(kind, upload, fmt.Sprintf("client x509 certificate for %q could not be loaded: %v", host, err))
+		}
+	}
+
+	return nil
+}
+
+// checkScheme errors if the scheme of the given target, which might come from
+// a template, is not one we can upload to.
+// Targets which can't be parsed are reported when creating the request.
+func checkScheme(target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "sftp":
+		return nil
+	}
+	return fmt.Errorf("unsupported target scheme %q", u.Scheme)
+}
 
+// checkTargetHost renders the given target template of the upload, and
+// errors if its host is not in the uploads_allowed_hosts, if set.
+// The error is not a skip, so a disallowed host fails the release.
+func checkTargetHost(ctx *context.Context, kind string, upload *config.Upload, field, target string) error {
+	if len(ctx.Config.UploadsAllowedHosts) == 0 {
+		return nil
+	}
+	// artifact fields are not known yet, so they resolve to empty values.
+	rendered, err := tmpl.New(ctx).
+		WithArtifact(&artifact.Artifact{}).
+		WithExtraFields(placeholderFields(upload)).
+		Apply(target)
+	if err != nil {
+		return fmt.Errorf("%s: %s: error while building %s URL: %w", upload.Name, kind, field, err)
+	}
+	if err := checkAllowedHost(ctx, rendered); err != nil {
+		return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+	}
 	return nil
 }
 
+// checkAllowedHost errors if the host of the given target is not in the
+// project's uploads_allowed_hosts list.
+// Any host is allowed when the list is empty.
+func checkAllowedHost(ctx *context.Context, target string) error {
+	allowed := ctx.Config.UploadsAllowedHosts
+	if len(allowed) == 0 {
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid target: %w", err)
+	}
+	for _, host := range allowed {
+		if strings.EqualFold(host, u.Hostname()) || strings.EqualFold(host, u.Host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q is not in uploads_allowed_hosts", u.Host)
+}
+
 // username is optional
 func getUsername(ctx *context.Context, upload *config.Upload, kind string) (string, error) {
 	username, err := tmpl.New(ctx).Apply(upload.Username)
@@ -135,8 +503,7 @@ func getUsername(ctx *context.Context, upload *config.Upload, kind string) (stri
 	if username != "" {
 		return username, nil
 	}
-	key := fmt.Sprintf("%s_%s_USERNAME", strings.ToUpper(kind), strings.ToUpper(upload.Name))
-	return ctx.Env[key], nil
+	return ctx.Env[envPrefix(upload, kind)+"_USERNAME"], nil
 }
 
 // password is optional
@@ -148,25 +515,119 @@ func getPassword(ctx *context.Context, upload *config.Upload, kind string) (stri
 	if password != "" {
 		return password, nil
 	}
-	key := fmt.Sprintf("%s_%s_SECRET", strings.ToUpper(kind), strings.ToUpper(upload.Name))
-	return ctx.Env[key], nil
+	return ctx.Env[envPrefix(upload, kind)+"_SECRET"], nil
+}
+
+// envPrefix returns the prefix of the environment variables holding the
+// credentials of the given upload, e.g. `UPLOAD_PRODUCTION`.
+func envPrefix(upload *config.Upload, kind string) string {
+	if upload.EnvPrefix != "" {
+		return upload.EnvPrefix
+	}
+	return fmt.Sprintf("%s_%s", strings.ToUpper(kind), strings.ToUpper(upload.Name))
 }
 
 func misconfigured(kind string, upload *config.Upload, reason string) error {
-	return pipe.Skipf("%s section '%s' is not configured properly (%s)", kind, upload.Name, reason)
+	return pipe.Skipf("%s section '%s' is not configured properly (%s)", cmp.Or(upload.DisplayName, kind), upload.Name, reason)
 }
 
 // ResponseChecker is a function capable of validating an http server response.
 // It must return and error when the response must be considered a failure.
 type ResponseChecker func(*h.Response) error
 
+// Options customizes how the uploads are made.
+type Options struct {
+	// RequestMutator is called with each upload request right before it is
+	// sent, e.g. to sign it.
+	// Returning an error aborts the upload.
+	RequestMutator func(*h.Request) error
+
+	// OnArtifactStart is called before uploading each artifact, e.g. to
+	// render progress.
+	// It may be called concurrently.
+	OnArtifactStart func(*artifact.Artifact)
+
+	// OnArtifactDone is called after uploading each artifact, with the
+	// upload error, if any.
+	// It may be called concurrently.
+	OnArtifactDone func(*artifact.Artifact, error)
+}
+
+// uploader holds the state shared by all the uploads of an Upload call.
+type uploader struct {
+	opts    Options
+	tokens  *tokenCache
+	breaker *circuitBreaker
+	dedupe  *deduper
+	// collisions tracks the artifact uploaded to each target, to apply the
+	// on_collision policy.
+	collisions *collisions
+	// throttles limits the bandwidth of each upload block to its
+	// max_bytes_per_second, if set.
+	throttles *throttles
+	// slots limits the in-flight requests of all upload blocks to the
+	// uploads_parallelism, if set.
+	slots *semaphore.Weighted
+}
+
+// acquire waits for a free request slot.
+func (u *uploader) acquire(ctx *context.Context) error {
+	if u.slots == nil {
+		return nil
+	}
+	return u.slots.Acquire(ctx, 1)
+}
+
+// release frees the request slot taken by acquire.
+func (u *uploader) release() {
+	if u.slots != nil {
+		u.slots.Release(1)
+	}
+}
+
+// do sends the request once it gets a free request slot, so every request
+// counts against the uploads_parallelism.
+func (u *uploader) do(ctx *context.Context, upload *config.Upload, req *h.Request) (*h.Response, error) {
+	client, err := getHTTPClient(upload, req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer u.release()
+	return client.Do(req)
+}
+
 // Upload does the actual uploading work.
 func Upload(ctx *context.Context, uploads []config.Upload, kind string, check ResponseChecker) error {
+	return UploadWithOptions(ctx, uploads, kind, check, Options{})
+}
+
+// UploadWithOptions uploads like Upload, customized by the given options.
+func UploadWithOptions(ctx *context.Context, uploads []config.Upload, kind string, check ResponseChecker, opts Options) error {
 	skips := &pipe.SkipMemento{}
+	u := &uploader{
+		opts:       opts,
+		tokens:     newTokenCache(),
+		breaker:    newCircuitBreaker(),
+		dedupe:     newDeduper(),
+		collisions: newCollisions(),
+		throttles:  newThrottles(),
+	}
+	if n := ctx.Config.UploadsParallelism; n > 0 {
+		u.slots = semaphore.NewWeighted(int64(n))
+	}
 	// Handle every configured upload
 	for _, upload := range uploads {
-		err := uploadOne(ctx, upload, kind, check)
+		err := uploadOne(ctx, upload, kind, check, u)
 		if pipe.IsSkip(err) {
+			log.Debugf("%s block '%s' skipped: %s", kind, upload.Name, err)
+			ctx.SkippedUploads = append(ctx.SkippedUploads, context.SkippedUpload{
+				Kind:   kind,
+				Name:   upload.Name,
+				Reason: err.Error(),
+			})
 			skips.Remember(err)
 			continue
 		}
@@ -178,7 +639,7 @@ func Upload(ctx *context.Context, uploads []config.Upload, kind string, check Re
 	return skips.Evaluate()
 }
 
-func uploadOne(ctx *context.Context, upload config.Upload, kind string, check ResponseChecker) error {
+func uploadOne(ctx *context.Context, upload config.Upload, kind string, check ResponseChecker, u *uploader) error {
 	skip, err := tmpl.New(ctx).Bool(upload.Skip)
 	if err != nil {
 		return err
@@ -187,8 +648,29 @@ func uploadOne(ctx *context.Context, upload config.Upload, kind string, check Re
 		return pipe.Skip("skip evaluates to true")
 	}
 
+	// the display name replaces the kind in errors and logs, but the
+	// environment variables keep being named after the kind.
+	if upload.DisplayName != "" {
+		upload.EnvPrefix = envPrefix(&upload, kind)
+		kind = upload.DisplayName
+	}
+
+	filter, err := ArtifactFilter(&upload)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+	}
+	if err := uploadWithFilter(ctx, &upload, filter, kind, check, u); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ArtifactFilter returns the filter matching the artifacts the given upload
+// should upload, based on its mode, IDs and extensions.
+// Extra files are not included.
+func ArtifactFilter(upload *config.Upload) (artifact.Filter, error) {
 	types := []artifact.Type{}
-	if upload.Checksum {
+	if upload.Checksum && !upload.PerFileChecksum {
 		types = append(types, artifact.Checksum)
 	}
 	if upload.Meta {
@@ -197,6 +679,9 @@ func uploadOne(ctx *context.Context, upload config.Upload, kind string, check Re
 	if upload.Signature {
 		types = append(types, artifact.Signature, artifact.Certificate)
 	}
+	if upload.SBOM {
+		types = append(types, artifact.SBOM)
+	}
 	// We support two different modes
 	//	- "archive": Upload all artifacts
 	//	- "binary": Upload only the raw binaries
@@ -215,24 +700,24 @@ func uploadOne(ctx *context.Context, upload config.Upload, kind string, check Re
 	case ModeBinary:
 		types = append(types, artifact.UploadableBinary)
 	default:
-		return fmt.Errorf("%s: %s: mode \"%s\" not supported", upload.Name, kind, v)
+		return nil, fmt.Errorf("mode \"%s\" not supported", v)
 	}
 
-	filter := artifact.And(
+	filters := []artifact.Filter{
 		artifact.ByTypes(types...),
 		artifact.ByIDs(upload.IDs...),
 		artifact.Or(
 			artifact.ByExts(upload.Exts...),
 			artifact.ByFormats(upload.Exts...),
 		),
-	)
-	if err := uploadWithFilter(ctx, &upload, filter, kind, check); err != nil {
-		return err
 	}
-	return nil
+	for key, value := range upload.ExtraFilter {
+		filters = append(filters, artifact.ByExtra(key, value))
+	}
+	return artifact.And(filters...), nil
 }
 
-func uploadWithFilter(ctx *context.Context, upload *config.Upload, filter artifact.Filter, kind string, check ResponseChecker) error {
+func uploadWithFilter(ctx *context.Context, upload *config.Upload, filter artifact.Filter, kind string, check ResponseChecker, u *uploader) error {
 	var artifacts []*artifact.Artifact
 	extraFiles, err := extrafiles.Find(ctx, upload.ExtraFiles)
 	if err != nil {
@@ -248,24 +733,88 @@ func uploadWithFilter(ctx *context.Context, upload *config.Upload, filter artifa
 	}
 
 	if !upload.ExtraFilesOnly {
+		if upload.Checksum && !upload.PerFileChecksum && !upload.ChecksumOptional &&
+			len(ctx.Artifacts.Filter(artifact.ByType(artifact.Checksum)).List()) == 0 {
+			return fmt.Errorf("%s: %s: checksum upload requested but no checksum artifact found", upload.Name, kind)
+		}
 		artifacts = append(artifacts, ctx.Artifacts.Filter(filter).List()...)
 	}
 
+	if upload.SidecarTemplate != "" {
+		dir, err := mkdirTemp(upload, "goreleaser-upload-sidecars")
+		if err != nil {
+			return fmt.Errorf("%s: %s: could not create sidecars: %w", upload.Name, kind, err)
+		}
+		defer os.RemoveAll(dir)
+		sidecars, err := templateSidecars(ctx, upload, dir, artifacts)
+		if err != nil {
+			return fmt.Errorf("%s: %s: could not create sidecars: %w", upload.Name, kind, err)
+		}
+		artifacts = append(artifacts, sidecars...)
+	}
+
+	if upload.Checksum && upload.PerFileChecksum {
+		dir, err := mkdirTemp(upload, "goreleaser-upload-checksums")
+		if err != nil {
+			return fmt.Errorf("%s: %s: could not create checksums: %w", upload.Name, kind, err)
+		}
+		defer os.RemoveAll(dir)
+		sidecars, err := checksumSidecars(dir, artifacts)
+		if err != nil {
+			return fmt.Errorf("%s: %s: could not create checksums: %w", upload.Name, kind, err)
+		}
+		artifacts = append(artifacts, sidecars...)
+	}
+
+	// sorted so sequential uploads (i.e. with parallelism 1) happen in a
+	// predictable order.
+	slices.SortStableFunc(artifacts, func(a, b *artifact.Artifact) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	// checked before delta_from, as skipping unchanged artifacts is expected.
 	if len(artifacts) == 0 {
-		log.Info("no artifacts found")
+		if upload.FailIfEmpty {
+			return fmt.Errorf("%s: %s: no artifacts found", upload.Name, kind)
+		}
+		log.WithField("instance", upload.Name).Warn("no artifacts found")
 	}
+
+	if upload.DeltaFrom != "" {
+		artifacts, err = deltaFilter(ctx, upload, kind, u, artifacts)
+		if err != nil {
+			return err
+		}
+	}
+
 	log.Debugf("will upload %d artifacts", len(artifacts))
+	if upload.GroupTemplate != "" {
+		return uploadGroups(ctx, upload, artifacts, kind, check, u)
+	}
+	be := &bestEffort{upload: upload}
 	g := semerrgroup.New(ctx.Parallelism)
 	for _, artifact := range artifacts {
 		g.Go(func() error {
-			return uploadAsset(ctx, upload, artifact, kind, check)
+			return be.run(func() error {
+				if u.opts.OnArtifactStart != nil {
+					u.opts.OnArtifactStart(artifact)
+				}
+				err := uploadMirrored(ctx, upload, artifact, kind, check, u)
+				if u.opts.OnArtifactDone != nil {
+					u.opts.OnArtifactDone(artifact, err)
+				}
+				return err
+			})
 		})
 	}
-	return g.Wait()
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return be.result()
 }
 
 // uploadAsset uploads file to target and logs all actions.
-func uploadAsset(ctx *context.Context, upload *config.Upload, artifact *artifact.Artifact, kind string, check ResponseChecker) error {
+func uploadAsset(ctx *context.Context, upload *config.Upload, artifact *artifact.Artifact, kind string, check ResponseChecker, u *uploader) error {
 	// username and secret are optional since the server may not support/need
 	// basic authentication always
 	username, err := getUsername(ctx, upload, kind)
@@ -277,41 +826,165 @@ func uploadAsset(ctx *context.Context, upload *config.Upload, artifact *artifact
 		return fmt.Errorf("%s: could not get password: %w", upload.Name, err)
 	}
 
-	// Generate the target url
-	targetURL, err := tmpl.New(ctx).WithArtifact(artifact).Apply(upload.Target)
+	// Validate the artifact is not a directory before doing any other work.
+	if s, err := os.Stat(artifact.Path); err == nil && s.IsDir() {
+		return fmt.Errorf("%s: upload failed: the asset to upload can't be a directory", kind)
+	}
+
+	sourceURL := remoteURL(artifact)
+	if sourceURL != "" {
+		if err := checkRemoteArtifact(upload); err != nil {
+			return fmt.Errorf("%s: %s: %s: %w", upload.Name, kind, artifact.Name, err)
+		}
+	}
+
+	threshold, err := bufferThreshold(upload)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+	}
+
+	// The checksum is only computed upfront when the templates need it.
+	tpl := tmpl.New(ctx).WithArtifact(artifact)
+	var hashed *hashedAsset
+	if usesChecksum(upload) {
+		hashed, err = hashAsset(artifact, upload.FastHash, threshold)
+		if err != nil {
+			return err
+		}
+		tpl = tpl.WithExtraFields(checksumFields(upload, hashed.sum))
+	}
+
+	if upload.RawRequestTemplate != "" {
+		return uploadRawRequest(ctx, upload, artifact, tpl, kind, username, secret, check, u)
+	}
+
+	// Generate the target url, which is the initiate_target on two-step
+	// uploads.
+	targetURL, err := tpl.Apply(cmp.Or(upload.InitiateTarget, upload.Target))
 	if err != nil {
 		return fmt.Errorf("%s: %s: error while building target URL: %w", upload.Name, kind, err)
 	}
 
-	// Validate the artifact is not a directory before doing any other work.
-	if s, err := os.Stat(artifact.Path); err == nil && s.IsDir() {
-		return fmt.Errorf("%s: upload failed: the asset to upload can't be a directory", kind)
+	name := artifact.Name
+	if upload.NameTemplate != "" {
+		name, err = tpl.Apply(upload.NameTemplate)
+		if err != nil {
+			return fmt.Errorf("%s: %s: error while building artifact name: %w", upload.Name, kind, err)
+		}
 	}
 
 	// target url need to contain the artifact name unless the custom
-	// artifact name is used
-	if !upload.CustomArtifactName {
+	// artifact name is used, or the upload url is assigned by the server.
+	if !upload.CustomArtifactName && upload.InitiateTarget == "" {
 		if !strings.HasSuffix(targetURL, "/") {
 			targetURL += "/"
 		}
-		targetURL += artifact.Name
+		targetURL += name
 	}
 	log.Debugf("generated target url: %s", redact.String(targetURL, ctx.Env.Strings()))
+	if err := checkScheme(targetURL); err != nil {
+		return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+	}
+	if err := checkAllowedHost(ctx, targetURL); err != nil {
+		return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+	}
+	if err := u.breaker.allow(upload, targetURL); err != nil {
+		return fmt.Errorf("%s: %s: %s: %w", upload.Name, kind, artifact.Name, err)
+	}
+	if ok, err := u.dedupe.claim(upload, artifact, targetURL); err != nil || !ok {
+		return err
+	}
+	// the server assigns the upload url on two-step uploads.
+	if upload.InitiateTarget == "" {
+		targetURL, err = u.collisions.claim(upload, artifact, targetURL)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+		}
+	}
 
 	headers := make(map[string]string, len(upload.CustomHeaders))
 	for name, value := range upload.CustomHeaders {
-		resolvedValue, err := tmpl.New(ctx).WithArtifact(artifact).Apply(value)
+		resolvedValue, err := tpl.Apply(value)
 		if err != nil {
 			return fmt.Errorf("%s: %s: failed to resolve custom_headers template: %w", upload.Name, kind, err)
 		}
-		headers[name] = resolvedValue
+		headers[name] = customHeaderValue(name, resolvedValue)
+	}
+	if upload.VersionHeader != "" {
+		headers[upload.VersionHeader] = ctx.Version
+	}
+	if upload.Expect100Continue {
+		headers["Expect"] = "100-continue"
+	}
+	// remote artifacts have no local file to take the time from.
+	if upload.MtimeHeader != "" && sourceURL == "" {
+		s, err := os.Stat(artifact.Path)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+		}
+		headers[upload.MtimeHeader] = s.ModTime().UTC().Format(time.RFC3339)
+	}
+	addProvenanceHeaders(ctx, upload, headers)
+	token, err := u.tokens.token(ctx, upload, targetURL)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+	}
+	if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+
+	rem := remote{
+		ctx:      ctx,
+		upload:   upload,
+		target:   targetURL,
+		username: username,
+		secret:   secret,
+		headers:  remoteHeaders(upload, headers),
+		u:        u,
 	}
-	if upload.ChecksumHeader != "" {
-		sum, err := artifact.Checksum("sha256")
+	if upload.SkipExisting {
+		exists, err := rem.exists()
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+		}
+		if exists {
+			log.WithField("instance", upload.Name).
+				WithField("file", artifact.Name).
+				Info("already uploaded, skipping")
+			return nil
+		}
+	}
+
+	if upload.ChecksumHeader != "" && upload.CanonicalizeArchiveChecksum && canonicalizable(artifact) {
+		sum, err := canonicalArchiveSum(artifact.Path)
+		if err != nil {
+			return err
+		}
+		headers[upload.ChecksumHeader], err = (&hashedAsset{sum: sum}).encode(upload.ChecksumEncoding)
+		if err != nil {
+			return err
+		}
+	} else if upload.ChecksumHeader != "" && !upload.ChecksumTrailer {
+		if hashed == nil {
+			hashed, err = hashAsset(artifact, upload.FastHash, threshold)
+			if err != nil {
+				return err
+			}
+		}
+		headers[upload.ChecksumHeader], err = hashed.encode(upload.ChecksumEncoding)
 		if err != nil {
 			return err
 		}
-		headers[upload.ChecksumHeader] = sum
+	}
+
+	if upload.IdempotencyKeyHeader != "" {
+		if hashed == nil {
+			hashed, err = hashAsset(artifact, upload.FastHash, threshold)
+			if err != nil {
+				return err
+			}
+		}
+		headers[upload.IdempotencyKeyHeader] = idempotencyKey(targetURL, hashed.sum)
 	}
 
 	log.WithField("instance", upload.Name).
@@ -319,38 +992,438 @@ func uploadAsset(ctx *context.Context, upload *config.Upload, artifact *artifact
 		WithField("file", artifact.Name).
 		Info("uploading")
 
-	res, err := uploadAssetToServer(ctx, upload, targetURL, username, secret, headers, kind, artifact, check)
+	if codes := successCodesFor(upload, artifact); len(codes) > 0 {
+		check = successCodesChecker(codes, check)
+	}
+	if upload.SuccessHeader != "" {
+		check = successHeaderChecker(upload, check)
+	}
+
+	compress := upload.Compress && (upload.BodyMode == "" || upload.BodyMode == BodyModeFile)
+	if compress && !shouldCompress(upload.CompressSkipExts, artifact) {
+		log.WithField("file", artifact.Name).Info("skipping compression of already compressed file")
+		compress = false
+	}
+	if compress {
+		headers["Content-Encoding"] = cmp.Or(upload.CompressAlgo, CompressAlgoGzip)
+	}
+
+	var form map[string]string
+	if upload.BodyMode == BodyModeForm {
+		form, err = formFields(tpl, upload)
+		if err != nil {
+			return fmt.Errorf("%s: %s: failed to resolve form_fields template: %w", upload.Name, kind, err)
+		}
+		if upload.FormChecksumField != "" {
+			if hashed == nil {
+				hashed, err = hashAsset(artifact, upload.FastHash, threshold)
+				if err != nil {
+					return err
+				}
+			}
+			form[upload.FormChecksumField], err = hashed.encode(upload.ChecksumEncoding)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var envelope []byte
+	if upload.BodyMode == BodyModeJSONEnvelope {
+		envelope, err = jsonEnvelope(tpl, upload, artifact)
+		if err != nil {
+			return fmt.Errorf("%s: %s: failed to build json envelope: %w", upload.Name, kind, err)
+		}
+		if !hasHeader(headers, "Content-Type") {
+			headers["Content-Type"] = "application/json"
+		}
+	}
+
+	// files which were not buffered while hashing them are buffered now, if
+	// small enough, so retries don't need to read them again.
+	var buffered []byte
+	if hashed == nil && sourceURL == "" && (upload.BodyMode == "" || upload.BodyMode == BodyModeFile || upload.BodyMode == BodyModeForm) {
+		buffered, err = bufferFile(artifact, threshold)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+		}
+	}
+
+	open := func() (*asset, error) {
+		switch upload.BodyMode {
+		case BodyModeEmpty:
+			return &asset{ReadCloser: h.NoBody}, nil
+		case BodyModeJSONEnvelope:
+			return &asset{
+				ReadCloser: io.NopCloser(bytes.NewReader(envelope)),
+				Size:       int64(len(envelope)),
+			}, nil
+		}
+		a := hashed.open()
+		if a == nil {
+			a = bufferedAsset(buffered)
+		}
+		if a == nil && sourceURL != "" {
+			var err error
+			a, err = remoteAssetOpen(ctx, upload, sourceURL)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if a == nil {
+			var err error
+			a, err = assetOpen(kind, artifact)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if upload.VerifyGzip && isGzip(artifact) {
+			a.ReadCloser = newGzipVerifier(a.ReadCloser)
+		}
+		if upload.ChecksumTrailer {
+			a = withChecksumTrailer(a, upload.ChecksumHeader, upload.ChecksumEncoding)
+		}
+		return a, nil
+	}
+
+	if upload.MaxFileSize != "" {
+		open, err = limitSize(open, artifact.Name, upload.MaxFileSize)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+		}
+	}
+	if compress {
+		open = compressOpen(open, upload.CompressAlgo)
+	}
+	if upload.BodyMode == BodyModeForm {
+		boundary := multipart.NewWriter(io.Discard).Boundary()
+		headers["Content-Type"] = "multipart/form-data; boundary=" + boundary
+		open = formOpen(open, boundary, filepath.Base(artifact.Name), form)
+	}
+	if upload.TmpDir != "" && (compress || upload.BodyMode == BodyModeForm || sourceURL != "") {
+		s := &spool{upload: upload, open: open}
+		defer s.Remove()
+		open = s.Open
+	}
+
+	if isSFTP(targetURL) {
+		err := uploadSFTP(ctx, upload, targetURL, username, secret, open, u)
+		u.breaker.record(upload, targetURL, err)
+		if err != nil {
+			return newUploadError(ctx, upload, kind, artifact, targetURL, nil, err)
+		}
+		return nil
+	}
+
+	var res *h.Response
+	sent := false
+	switch {
+	case upload.InitiateTarget != "":
+		res, err = uploadTwoStep(ctx, upload, artifact, name, targetURL, username, secret, headers, open, check, u)
+		sent = true
+	case upload.RangeChunkSize != "":
+		res, sent, err = uploadRanges(ctx, upload, artifact, targetURL, username, secret, headers, open, check, u)
+	}
+	if !sent && err == nil {
+		res, err = uploadAssetToServer(ctx, upload, targetURL, username, secret, headers, open, check, u)
+	}
+	u.breaker.record(upload, targetURL, err)
 	if err != nil {
-		return fmt.Errorf("%s: %s: upload failed: %w", upload.Name, kind, err)
+		return newUploadError(ctx, upload, kind, artifact, targetURL, res, err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			log.WithError(err).Warn("failed to close response body")
+		}
+	}()
+
+	if upload.CaptureCIDJSONPath != "" {
+		if err := storeCID(artifact, res.Body, upload.CaptureCIDJSONPath); err != nil {
+			return fmt.Errorf("%s: %s: failed to capture CID: %w", upload.Name, kind, err)
+		}
 	}
-	if err := res.Body.Close(); err != nil {
-		log.WithError(err).Warn("failed to close response body")
+	storeHeaders(artifact, res.Header, upload.CaptureHeaders)
+
+	if upload.VerifySize {
+		if err := rem.verifySize(artifact); err != nil {
+			return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+		}
+	}
+
+	if upload.VerifyAfterUpload {
+		if err := rem.verify(artifact); err != nil {
+			return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+		}
 	}
 
 	return nil
 }
 
+func newUploadError(ctx *context.Context, upload *config.Upload, kind string, a *artifact.Artifact, target string, res *h.Response, err error) error {
+	status := 0
+	if res != nil {
+		status = res.StatusCode
+	}
+	if status == h.StatusUnauthorized || status == h.StatusForbidden {
+		err = &AuthError{StatusCode: status, Err: err}
+	}
+	return &UploadError{
+		Name:       upload.Name,
+		Kind:       kind,
+		Artifact:   a,
+		Target:     redact.String(target, ctx.Env.Strings()),
+		StatusCode: status,
+		Err:        err,
+	}
+}
+
+// limitSize wraps open so it fails if the asset is bigger than the given
+// size.
+// Assets of unknown size are not checked.
+func limitSize(open func() (*asset, error), name, size string) (func() (*asset, error), error) {
+	limit, err := humanize.ParseBytes(size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max_file_size: %w", err)
+	}
+	return func() (*asset, error) {
+		a, err := open()
+		if err != nil {
+			return nil, err
+		}
+		if a.Size > 0 && uint64(a.Size) > limit {
+			_ = a.ReadCloser.Close()
+			return nil, fmt.Errorf("%s is %s, which is bigger than the max_file_size of %s",
+				name, humanize.IBytes(uint64(a.Size)), humanize.IBytes(limit))
+		}
+		return a, nil
+	}, nil
+}
+
+// customHeaderValue encodes the values of `-bin` headers as unpadded base64,
+// following the gRPC binary metadata convention.
+func customHeaderValue(name, value string) string {
+	if strings.HasSuffix(strings.ToLower(name), "-bin") {
+		return base64.RawStdEncoding.EncodeToString([]byte(value))
+	}
+	return value
+}
+
+// hasHeader tells whether the given header is set, ignoring case.
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// idempotencyKey returns a key which is the same for every upload of the same
+// contents to the same target, so servers can tell retries apart from new
+// uploads.
+func idempotencyKey(target, sum string) string {
+	h := sha256.Sum256([]byte(target + "\n" + sum))
+	return hex.EncodeToString(h[:])
+}
+
+// Headers set by provenance_headers.
+const (
+	provenanceCommitHeader  = "X-Build-Commit"
+	provenanceVersionHeader = "X-Build-Version"
+	provenanceDateHeader    = "X-Build-Date"
+)
+
+// addProvenanceHeaders sets the commit, version and date of the build as
+// headers, if provenance_headers is enabled.
+// Custom headers with the same names take precedence.
+func addProvenanceHeaders(ctx *context.Context, upload *config.Upload, headers map[string]string) {
+	if !upload.ProvenanceHeaders {
+		return
+	}
+	for name, value := range map[string]string{
+		provenanceCommitHeader:  ctx.Git.FullCommit,
+		provenanceVersionHeader: ctx.Version,
+		provenanceDateHeader:    ctx.Date.UTC().Format(time.RFC3339),
+	} {
+		if !hasHeader(headers, name) {
+			headers[name] = value
+		}
+	}
+}
+
+// usesChecksum tells whether any of the templates rendered for each upload
+// request reference the artifact checksum, so we only hash files when needed.
+func usesChecksum(upload *config.Upload) bool {
+	templates := []string{upload.Target, upload.InitiateTarget, upload.RawRequestTemplate, upload.NameTemplate}
+	templates = slices.AppendSeq(templates, maps.Values(upload.CustomHeaders))
+	templates = slices.AppendSeq(templates, maps.Values(upload.FormFields))
+	templates = slices.AppendSeq(templates, maps.Values(upload.JSONEnvelope))
+	return slices.ContainsFunc(templates, referencesChecksum)
+}
+
+// referencesChecksum tells whether the template references the artifact
+// checksum.
+func referencesChecksum(s string) bool {
+	return strings.Contains(s, ".Checksum") || strings.Contains(s, ".SHA256") || strings.Contains(s, ".HashFanout")
+}
+
+// checksumFields returns the template fields of the given artifact sha256.
+func checksumFields(upload *config.Upload, sum string) tmpl.Fields {
+	return tmpl.Fields{
+		"Checksum":   "sha256:" + sum,
+		"SHA256":     sum,
+		"HashFanout": hashFanout(sum, upload.HashFanout),
+	}
+}
+
+// artifactTemplate returns the template to render s for the given artifact,
+// with its checksum fields if s references them.
+func artifactTemplate(ctx *context.Context, upload *config.Upload, a *artifact.Artifact, s string) (*tmpl.Template, error) {
+	tpl := tmpl.New(ctx).WithArtifact(a)
+	if !referencesChecksum(s) {
+		return tpl, nil
+	}
+	hashed, err := hashAsset(a, upload.FastHash, 0)
+	if err != nil {
+		return nil, err
+	}
+	return tpl.WithExtraFields(checksumFields(upload, hashed.sum)), nil
+}
+
+// maxHashFanout is the maximum hash_fanout, as each level takes two of the
+// 64 hex characters of the SHA256.
+const maxHashFanout = sha256.Size
+
+// hashFanout returns the given number of directory levels made of the first
+// bytes of the hex sum, e.g. `ab/cd` for 2 levels of `abcdef...`, for
+// content-addressed layouts.
+func hashFanout(sum string, levels int) string {
+	dirs := make([]string, 0, levels)
+	for i := range min(levels, len(sum)/2) {
+		dirs = append(dirs, sum[i*2:i*2+2])
+	}
+	return strings.Join(dirs, "/")
+}
+
+// successCodesFor returns the configured success codes for the given
+// artifact, falling back to the default ones.
+func successCodesFor(upload *config.Upload, a *artifact.Artifact) []int {
+	key := successCodesDefault
+	switch a.Type {
+	case artifact.Checksum:
+		key = successCodesChecksum
+	case artifact.Metadata:
+		key = successCodesMetadata
+	case artifact.Signature, artifact.Certificate:
+		key = successCodesSignature
+	}
+	if codes, ok := upload.SuccessCodes[key]; ok {
+		return codes
+	}
+	return upload.SuccessCodes[successCodesDefault]
+}
+
+// successCodesChecker only accepts responses with one of the given status
+// codes.
+// Other responses are still passed to the fallback checker, so pipes can
+// report their own, more detailed, errors.
+func successCodesChecker(codes []int, fallback ResponseChecker) ResponseChecker {
+	return func(r *h.Response) error {
+		if slices.Contains(codes, r.StatusCode) {
+			return nil
+		}
+		if err := fallback(r); err != nil {
+			return err
+		}
+		return fmt.Errorf("unexpected http response status: %s", r.Status)
+	}
+}
+
+// successHeaderChecker only accepts responses that pass the given checker
+// and have the success_header, with the success_header_value if set.
+func successHeaderChecker(upload *config.Upload, check ResponseChecker) ResponseChecker {
+	return func(r *h.Response) error {
+		if err := check(r); err != nil {
+			return err
+		}
+		value := r.Header.Get(upload.SuccessHeader)
+		switch {
+		case value == "":
+			return fmt.Errorf("missing %s response header", upload.SuccessHeader)
+		case upload.SuccessHeaderValue != "" && value != upload.SuccessHeaderValue:
+			return fmt.Errorf("unexpected %s response header: %q", upload.SuccessHeader, value)
+		}
+		return nil
+	}
+}
+
 // uploadAssetToServer uploads the asset file to target.
-func uploadAssetToServer(ctx *context.Context, upload *config.Upload, target, username, secret string, headers map[string]string, kind string, artifact *artifact.Artifact, check ResponseChecker) (*h.Response, error) {
-	var resp *h.Response
-	err := retryx.Do(ctx, ctx.Config.Retry, func() error {
-		a, err := assetOpen(kind, artifact)
+func uploadAssetToServer(ctx *context.Context, upload *config.Upload, target, username, secret string, headers map[string]string, open func() (*asset, error), check ResponseChecker, u *uploader) (*h.Response, error) {
+	mutate := u.opts.RequestMutator
+	// send sends the asset once with the given credentials.
+	// Errors creating the request are unrecoverable, and have no response.
+	send := func(username, secret string) (*h.Response, error) {
+		a, err := open()
 		if err != nil {
-			return retryx.Unrecoverable(err)
+			return nil, retryx.Unrecoverable(err)
 		}
 		defer a.ReadCloser.Close()
+		if l := u.throttles.limiter(upload); l != nil {
+			a.ReadCloser = &throttledReader{ReadCloser: a.ReadCloser, ctx: ctx, limiter: l}
+		}
 
 		req, err := newUploadRequest(ctx, upload.Method, target, username, secret, headers, a)
 		if err != nil {
-			return retryx.Unrecoverable(err)
+			return nil, retryx.Unrecoverable(err)
+		}
+		if mutate != nil {
+			if err := mutate(req); err != nil {
+				return nil, retryx.Unrecoverable(fmt.Errorf("failed to mutate request: %w", err))
+			}
+		}
+
+		var trace *requestTrace
+		if upload.Trace {
+			req, trace = traceRequest(req)
+		}
+		resp, err := executeHTTPRequest(ctx, upload, req, check, u) //nolint:bodyclose // closed by caller (uploadAsset)
+		if trace != nil {
+			trace.log(upload, req)
 		}
+		return resp, err
+	}
 
-		resp, err = executeHTTPRequest(ctx, upload, req, check) //nolint:bodyclose // closed by caller (uploadAsset)
+	var resp *h.Response
+	err := retryx.DoWithJitter(ctx, ctx.Config.Retry, func() error {
+		var err error
+		// each realm is tried at most once per attempt, so servers
+		// alternating between challenges can't make it loop forever.
+		tried := map[string]bool{}
+		for {
+			resp, err = send(username, secret)
+			if err == nil || resp == nil {
+				break
+			}
+			realm, user, pass, ok, cerr := realmCredentials(ctx, upload, resp)
+			if cerr != nil {
+				return retryx.Unrecoverable(cerr)
+			}
+			if !ok || tried[realm] || (user == username && pass == secret) {
+				break
+			}
+			// the server asked for another realm, try again right away
+			// with its credentials.
+			tried[realm] = true
+			username, secret = user, pass
+		}
+		if errors.Is(err, errCorruptedGzip) {
+			return retryx.Unrecoverable(err)
+		}
 		if err != nil {
 			return retryx.HTTP(err, resp)
 		}
 		return nil
-	}, retryx.IsRetriable)
+	}, retryx.IsRetriable, retryJitter(upload.RetryJitter))
 	return resp, err
 }
 
@@ -361,8 +1434,15 @@ func newUploadRequest(ctx *context.Context, method, target, username, secret str
 		return nil, err
 	}
 	req.ContentLength = a.Size
+	if a.Trailer != nil {
+		// trailers can only be sent with chunked encoding.
+		req.ContentLength = -1
+		req.Trailer = a.Trailer
+	}
 
-	if username != "" && secret != "" {
+	// a bearer token, or a custom Authorization header, takes precedence
+	// over the basic auth.
+	if username != "" && secret != "" && !hasHeader(headers, "Authorization") {
 		req.SetBasicAuth(username, secret)
 	}
 
@@ -373,49 +1453,14 @@ func newUploadRequest(ctx *context.Context, method, target, username, secret str
 	return req, err
 }
 
-func getHTTPClient(upload *config.Upload) (*h.Client, error) {
-	if upload.TrustedCerts == "" && upload.ClientX509Cert == "" && upload.ClientX509Key == "" {
-		return h.DefaultClient, nil
-	}
-	transport := &h.Transport{
-		Proxy:           h.ProxyFromEnvironment,
-		TLSClientConfig: &tls.Config{},
-	}
-	if upload.TrustedCerts != "" {
-		pool, err := x509.SystemCertPool()
-		if err != nil {
-			if runtime.GOOS == "windows" {
-				// on windows ignore errors until golang issues #16736 & #18609 get fixed
-				pool = x509.NewCertPool()
-			} else {
-				return nil, err
-			}
-		}
-		pool.AppendCertsFromPEM([]byte(upload.TrustedCerts)) // already validated certs checked by CheckConfig
-		transport.TLSClientConfig.RootCAs = pool
-	}
-	if upload.ClientX509Cert != "" && upload.ClientX509Key != "" {
-		cert, err := tls.LoadX509KeyPair(upload.ClientX509Cert, upload.ClientX509Key)
-		if err != nil {
-			return nil, err
-		}
-		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
-	}
-	return &h.Client{Transport: transport}, nil
-}
-
 // executeHTTPRequest processes the http call with respect of context ctx.
 //
 // On success the caller owns resp.Body and must close it.
 // On error the body is already closed; the returned resp (if non-nil)
 // can still be inspected for status code, headers, etc.
-func executeHTTPRequest(ctx *context.Context, upload *config.Upload, req *h.Request, check ResponseChecker) (*h.Response, error) {
-	client, err := getHTTPClient(upload)
-	if err != nil {
-		return nil, err
-	}
+func executeHTTPRequest(ctx *context.Context, upload *config.Upload, req *h.Request, check ResponseChecker, u *uploader) (*h.Response, error) {
 	log.Debugf("executing request: %s %s", req.Method, redact.String(req.URL.String(), ctx.Env.Strings()))
-	resp, err := client.Do(req)
+	resp, err := u.do(ctx, upload, req)
 	if err != nil {
 		// If we got an error, and the context has been canceled,
 		// the context's error is probably more useful.
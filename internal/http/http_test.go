@@ -1,27 +1,53 @@
 package http
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/andybalholm/brotli"
+	"github.com/caarlos0/log"
 	"github.com/goreleaser/goreleaser/v2/internal/artifact"
 	"github.com/goreleaser/goreleaser/v2/internal/pipe"
 	"github.com/goreleaser/goreleaser/v2/internal/testctx"
+	"github.com/goreleaser/goreleaser/v2/internal/testlib"
 	"github.com/goreleaser/goreleaser/v2/pkg/config"
 	"github.com/goreleaser/goreleaser/v2/pkg/context"
+	"github.com/pkg/sftp"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 func TestAssetOpen(t *testing.T) {
@@ -50,12 +76,39 @@ func TestAssetOpen(t *testing.T) {
 	if err == nil {
 		t.Fatalf("should fail on missing file")
 	}
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.ErrorContains(t, err, "the asset to upload does not exist")
 	_, err = assetOpen("blah", &artifact.Artifact{
 		Path: t.TempDir(),
 	})
 	if err == nil {
 		t.Fatalf("should fail on existing dir")
 	}
+	require.ErrorContains(t, err, "the asset to upload can't be a directory")
+
+	link := filepath.Join(t.TempDir(), "link")
+	require.NoError(t, os.Symlink(tf, link))
+	linked, err := assetOpen("blah", &artifact.Artifact{
+		Path: link,
+	})
+	require.NoError(t, err)
+	require.NoError(t, linked.ReadCloser.Close())
+	require.Equal(t, int64(1), linked.Size)
+
+	broken := filepath.Join(t.TempDir(), "broken")
+	require.NoError(t, os.Symlink("nope", broken))
+	_, err = assetOpen("blah", &artifact.Artifact{
+		Path: broken,
+	})
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.ErrorContains(t, err, `the asset to upload is a broken symlink to "nope"`)
+
+	dirLink := filepath.Join(t.TempDir(), "dir")
+	require.NoError(t, os.Symlink(t.TempDir(), dirLink))
+	_, err = assetOpen("blah", &artifact.Artifact{
+		Path: dirLink,
+	})
+	require.ErrorContains(t, err, "the asset to upload can't be a directory")
 }
 
 func TestDefaults(t *testing.T) {
@@ -70,6 +123,7 @@ func TestDefaults(t *testing.T) {
 	}{
 		{"set default", args{[]config.Upload{{Name: "a", Target: "http://"}}}, false, ModeArchive},
 		{"keep value", args{[]config.Upload{{Name: "a", Target: "http://...", Mode: ModeBinary}}}, false, ModeBinary},
+		{"strict", args{[]config.Upload{{Name: "a", Target: "http://...", Strict: true}}}, false, ""},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -101,7 +155,11 @@ func TestCheckConfig(t *testing.T) {
 	}{
 		{"ok", args{ctx, &config.Upload{Name: "a", Target: "http://blabla", Username: "pepe", Mode: ModeArchive}, "test"}, false},
 		{"ok password", args{ctx, &config.Upload{Name: "a", Target: "http://blabla", Username: "pepe", Password: "pass", Mode: ModeArchive}, "test"}, false},
+		{"ok checksum encoding", args{ctx, &config.Upload{Name: "a", Target: "http://blabla", Username: "pepe", Mode: ModeArchive, ChecksumEncoding: ChecksumEncodingBase64}, "test"}, false},
+		{"invalid checksum encoding", args{ctx, &config.Upload{Name: "a", Target: "http://blabla", Username: "pepe", Mode: ModeArchive, ChecksumEncoding: "base32"}, "test"}, true},
 		{"secret missing", args{ctx, &config.Upload{Name: "b", Target: "http://blabla", Username: "pepe", Mode: ModeArchive}, "test"}, true},
+		{"ok env prefix", args{ctx, &config.Upload{Name: "my-upload", EnvPrefix: "TEST_A", Target: "http://blabla", Username: "pepe", Mode: ModeArchive}, "test"}, false},
+		{"env prefix secret missing", args{ctx, &config.Upload{Name: "a", EnvPrefix: "OTHER", Target: "http://blabla", Username: "pepe", Mode: ModeArchive}, "test"}, true},
 		{"target missing", args{ctx, &config.Upload{Name: "a", Username: "pepe", Mode: ModeArchive}, "test"}, true},
 		{"name missing", args{ctx, &config.Upload{Target: "http://blabla", Username: "pepe", Mode: ModeArchive}, "test"}, true},
 		{"username missing", args{ctx, &config.Upload{Name: "a", Target: "http://blabla", Mode: ModeArchive}, "test"}, true},
@@ -139,6 +197,305 @@ func TestCheckConfig(t *testing.T) {
 	}
 }
 
+func TestCheckConfigOptions(t *testing.T) {
+	clientCert, _ := writeClientCert(t, "a")
+	_, otherKey := writeClientCert(t, "b")
+	sshKey := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(sshKey, []byte("nope"), 0o600))
+
+	for name, tt := range map[string]struct {
+		upload config.Upload
+		err    string
+	}{
+		"invalid success_codes key": {
+			config.Upload{SuccessCodes: map[string][]int{"nope": {200}}},
+			"invalid success_codes key",
+		},
+		"success_header_value without success_header": {
+			config.Upload{SuccessHeaderValue: "ok"},
+			"success_header_value requires success_header",
+		},
+		"invalid hash_fanout": {
+			config.Upload{HashFanout: 33},
+			"hash_fanout must be between 0 and 32",
+		},
+		"invalid body_mode": {
+			config.Upload{BodyMode: "nope"},
+			"body_mode must be",
+		},
+		"invalid max_file_size": {
+			config.Upload{MaxFileSize: "lots"},
+			"invalid max_file_size",
+		},
+		"negative max_bytes_per_second": {
+			config.Upload{MaxBytesPerSecond: -1},
+			"max_bytes_per_second can't be negative",
+		},
+		"invalid retry_jitter": {
+			config.Upload{RetryJitter: "random"},
+			"retry_jitter must be",
+		},
+		"negative failure_threshold": {
+			config.Upload{FailureThreshold: -1},
+			"failure_threshold can't be negative",
+		},
+		"invalid buffer_threshold": {
+			config.Upload{BufferThreshold: "big"},
+			"invalid buffer_threshold",
+		},
+		"invalid timeout": {
+			config.Upload{Timeout: "soon"},
+			"invalid timeout",
+		},
+		"invalid connect_timeout": {
+			config.Upload{ConnectTimeout: "10"},
+			"invalid connect_timeout",
+		},
+		"invalid compress_algo": {
+			config.Upload{Compress: true, CompressAlgo: "lzma"},
+			"compress_algo must be",
+		},
+		"invalid exists_method": {
+			config.Upload{SkipExisting: true, ExistsMethod: "GET"},
+			"exists_method must be",
+		},
+		"invalid on_collision": {
+			config.Upload{OnCollision: "skip"},
+			"on_collision must be 'overwrite', 'error' or 'rename'",
+		},
+		"invalid verify_mode": {
+			config.Upload{VerifyAfterUpload: true, VerifyMode: "nope"},
+			"verify_mode must be",
+		},
+		"verify_size with compress": {
+			config.Upload{VerifySize: true, Compress: true},
+			"verify_size can't be used with",
+		},
+		"checksum_trailer without checksum_header": {
+			config.Upload{ChecksumTrailer: true},
+			"checksum_trailer requires checksum_header",
+		},
+		"canonicalize_archive_checksum without checksum_header": {
+			config.Upload{CanonicalizeArchiveChecksum: true},
+			"canonicalize_archive_checksum requires checksum_header",
+		},
+		"form fields without form body_mode": {
+			config.Upload{FormFields: map[string]string{"version": "{{ .Version }}"}, FormChecksumField: "sha256"},
+			"require the 'form' body_mode",
+		},
+		"json_envelope data": {
+			config.Upload{BodyMode: BodyModeJSONEnvelope, JSONEnvelope: map[string]string{"data": "foo"}},
+			"json_envelope can't override the 'data' field",
+		},
+		"body_schema without json_envelope": {
+			config.Upload{BodyMode: BodyModeFile, BodySchema: "schema.json"},
+			"body_schema requires the json_envelope body_mode",
+		},
+		"invalid body_schema": {
+			config.Upload{BodyMode: BodyModeJSONEnvelope, BodySchema: filepath.Join(t.TempDir(), "nope.json")},
+			"invalid body_schema",
+		},
+		"invalid range_chunk_size": {
+			config.Upload{RangeChunkSize: "lots"},
+			"invalid range_chunk_size",
+		},
+		"range_chunk_size with compress": {
+			config.Upload{RangeChunkSize: "1MB", Compress: true},
+			"range_chunk_size can't be used with",
+		},
+		"chunk_checksum without checksum_header": {
+			config.Upload{RangeChunkSize: "1MB", ChunkChecksum: true},
+			"chunk_checksum requires range_chunk_size and checksum_header",
+		},
+		"group_template with body_mode": {
+			config.Upload{GroupTemplate: "{{ .Os }}", BodyMode: BodyModeEmpty},
+			"group_template can't be used",
+		},
+		"group_template with mtime_header": {
+			config.Upload{GroupTemplate: "{{ .Os }}", MtimeHeader: "X-Mtime"},
+			"group_template can't be used with body_mode, checksum_header, idempotency_key_header or mtime_header",
+		},
+		"group_template with idempotency_key_header": {
+			config.Upload{GroupTemplate: "{{ .Os }}", IdempotencyKeyHeader: "Idempotency-Key"},
+			"idempotency_key_header",
+		},
+		"group_template with dedupe": {
+			config.Upload{GroupTemplate: "{{ .Os }}", Dedupe: true},
+			"dedupe can't be used with group_template",
+		},
+		"group_template with on_collision": {
+			config.Upload{GroupTemplate: "{{ .Os }}", OnCollision: OnCollisionRename},
+			"on_collision can't be used with group_template or initiate_target",
+		},
+		"group_template with mirrors": {
+			config.Upload{GroupTemplate: "{{ .Os }}", Mirrors: []string{"http://mirror"}},
+			"mirrors and fallback_target can't be used with group_template",
+		},
+		"credentials_by_realm without username": {
+			config.Upload{CredentialsByRealm: map[string]config.UploadCredentials{"releases": {Password: "secret"}}},
+			"'credentials_by_realm.releases' requires a username",
+		},
+		"oauth2 without client_id": {
+			config.Upload{OAuth2: config.UploadOAuth2{TokenURL: "http://localhost/token"}},
+			"must be set together",
+		},
+		"resolve_host without resolve_addr": {
+			config.Upload{Target: "https://example.com", ResolveHost: "example.com"},
+			"must be set together",
+		},
+		"client_x509_by_host without key": {
+			config.Upload{ClientX509ByHost: map[string]config.UploadClientX509{"example.com": {Cert: clientCert}}},
+			"'client_x509_by_host.example.com' requires both 'cert' and 'key'",
+		},
+		"client_x509_by_host with mismatched key": {
+			config.Upload{ClientX509ByHost: map[string]config.UploadClientX509{"example.com": {Cert: clientCert, Key: otherKey}}},
+			`client x509 certificate for "example.com" could not be loaded`,
+		},
+		"unix_socket with resolve_host": {
+			config.Upload{UnixSocket: "upload.sock", ResolveHost: "localhost", ResolveAddr: "127.0.0.1"},
+			"unix_socket can't be used",
+		},
+		"unix_socket with sftp": {
+			config.Upload{UnixSocket: "upload.sock", Target: "sftp://user@localhost/", Password: "secret"},
+			"unix_socket can't be used",
+		},
+		"sftp without username": {
+			config.Upload{Target: "sftp://localhost/foo"},
+			"require a username",
+		},
+		"sftp without auth": {
+			config.Upload{Target: "sftp://localhost/foo", Username: "user"},
+			"require either 'ssh_key' or a password",
+		},
+		"sftp with invalid ssh_key": {
+			config.Upload{Target: "sftp://user@localhost/foo", SSHKey: sshKey},
+			"could not parse ssh_key",
+		},
+		"raw_request_template with target": {
+			config.Upload{Target: "http://localhost", RawRequestTemplate: "PUT http://localhost\n\n{{ .Body }}"},
+			"raw_request_template can't be used with target",
+		},
+		"initiate_target with target": {
+			config.Upload{Target: "http://localhost", InitiateTarget: "http://localhost", UploadURLJSONPath: "url"},
+			"target and initiate_target can't be used together",
+		},
+		"initiate_target without upload url": {
+			config.Upload{InitiateTarget: "http://localhost"},
+			"initiate_target requires upload_url_json_path or upload_url_header",
+		},
+		"upload_url_json_path with upload_url_header": {
+			config.Upload{InitiateTarget: "http://localhost", UploadURLJSONPath: "url", UploadURLHeader: "Location"},
+			"upload_url_json_path and upload_url_header can't be used together",
+		},
+		"upload_url_header with compress": {
+			config.Upload{InitiateTarget: "http://localhost", UploadURLHeader: "Location", Compress: true},
+			"upload_url_header can't be used with body_mode, compress or checksum_trailer",
+		},
+		"upload_url_header without initiate_target": {
+			config.Upload{UploadURLHeader: "Location"},
+			"upload_url_header requires initiate_target",
+		},
+		"upload_url_json_path without initiate_target": {
+			config.Upload{UploadURLJSONPath: "url"},
+			"upload_url_json_path requires initiate_target",
+		},
+		"initiate_target with verify_after_upload": {
+			config.Upload{InitiateTarget: "http://localhost", UploadURLJSONPath: "url", VerifyAfterUpload: true},
+			"initiate_target can't be used with",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			upload := tt.upload
+			upload.Name = "a"
+			upload.Mode = ModeArchive
+			if upload.Target == "" && upload.InitiateTarget == "" {
+				upload.Target = "http://localhost"
+			}
+			err := CheckConfig(testctx.Wrap(t.Context()), &upload, "test")
+			require.True(t, pipe.IsSkip(err), err)
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestEnvPrefix(t *testing.T) {
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		Env: []string{
+			"DEPLOY_USERNAME=user",
+			"DEPLOY_SECRET=pass",
+			"UPLOAD_MY-UPLOAD_SECRET=nope",
+		},
+	})
+	upload := &config.Upload{
+		Name:      "my-upload",
+		EnvPrefix: "DEPLOY",
+		Target:    "http://blabla",
+		Mode:      ModeArchive,
+	}
+	require.NoError(t, CheckConfig(ctx, upload, "upload"))
+
+	username, err := getUsername(ctx, upload, "upload")
+	require.NoError(t, err)
+	require.Equal(t, "user", username)
+	password, err := getPassword(ctx, upload, "upload")
+	require.NoError(t, err)
+	require.Equal(t, "pass", password)
+
+	upload.EnvPrefix = ""
+	password, err = getPassword(ctx, upload, "upload")
+	require.NoError(t, err)
+	require.Equal(t, "nope", password)
+}
+
+func TestCheckConfigStrict(t *testing.T) {
+	ctx := testctx.Wrap(t.Context())
+	uploads := []config.Upload{{Name: "a", Target: "http://blabla", Strict: true}}
+	require.NoError(t, Defaults(uploads))
+	err := CheckConfig(ctx, &uploads[0], "test")
+	require.False(t, pipe.IsSkip(err), err)
+	require.EqualError(t, err, "a: test: missing mode")
+
+	uploads[0].Strict = false
+	require.NoError(t, Defaults(uploads))
+	require.NoError(t, CheckConfig(ctx, &uploads[0], "test"))
+}
+
+func TestCheckConfigAllowedHosts(t *testing.T) {
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		ProjectName:         "blah",
+		UploadsAllowedHosts: []string{"staging.example.com", "localhost:8080"},
+	})
+	for target, allowed := range map[string]bool{
+		"https://staging.example.com/{{ .ProjectName }}/{{ .Os }}": true,
+		"https://STAGING.example.com/foo":                          true,
+		"http://localhost:8080/foo":                                true,
+		"http://localhost:9090/foo":                                false,
+		"https://prod.example.com/{{ .ProjectName }}":              false,
+		"https://staging.example.com/blobs/{{ .SHA256 }}":          true,
+		"https://prod.example.com/blobs/{{ .SHA256 }}":             false,
+	} {
+		t.Run(target, func(t *testing.T) {
+			err := CheckConfig(ctx, &config.Upload{Name: "a", Target: target, Mode: ModeArchive}, "test")
+			if allowed {
+				require.NoError(t, err)
+				return
+			}
+			require.False(t, pipe.IsSkip(err), err)
+			require.ErrorContains(t, err, "is not in uploads_allowed_hosts")
+		})
+	}
+
+	t.Run("upload", func(t *testing.T) {
+		addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz")
+		err := Upload(ctx, []config.Upload{{
+			Name:   "a",
+			Mode:   ModeArchive,
+			Target: "https://prod.example.com/",
+		}}, "test", acceptAll)
+		require.ErrorContains(t, err, `host "prod.example.com" is not in uploads_allowed_hosts`)
+	})
+}
+
 type check struct {
 	path    string
 	user    string
@@ -531,6 +888,21 @@ func TestUpload(t *testing.T) {
 			},
 			checks(check{"/blah/2.1.0/a.ubi", "u2", "x", content, map[string]string{"-x-sha256": "e37a649e5b4e9dd25672f22470f7ac0e5a902c2e02b54f9adc8ce791383d7514"}}),
 		},
+		{
+			"checksumheader-base64", true, true, false, false,
+			func(s *httptest.Server) (*context.Context, config.Upload) {
+				return ctx, config.Upload{
+					Mode:             ModeBinary,
+					Name:             "a",
+					Target:           s.URL + "/{{.ProjectName}}/{{.Version}}/",
+					Username:         "u2",
+					ChecksumHeader:   "-x-sha256",
+					ChecksumEncoding: ChecksumEncodingBase64,
+					TrustedCerts:     cert(s),
+				}
+			},
+			checks(check{"/blah/2.1.0/a.ubi", "u2", "x", content, map[string]string{"-x-sha256": "43pknltOndJWcvIkcPesDlqQLC4CtU+a3IznkTg9dRQ="}}),
+		},
 		{
 			"custom-headers", true, true, false, false,
 			func(s *httptest.Server) (*context.Context, config.Upload) {
@@ -547,6 +919,48 @@ func TestUpload(t *testing.T) {
 			},
 			checks(check{"/blah/2.1.0/a.ubi", "u2", "x", content, map[string]string{"x-custom-header-name": "custom-header-value"}}),
 		},
+		{
+			"name-template", true, true, false, false,
+			func(s *httptest.Server) (*context.Context, config.Upload) {
+				return ctx, config.Upload{
+					Mode:         ModeBinary,
+					Name:         "a",
+					Target:       s.URL + "/{{.ProjectName}}/{{.Version}}/",
+					Username:     "u2",
+					NameTemplate: `{{ replace (toupper .ArtifactName) "." "-" }}.bin`,
+					TrustedCerts: cert(s),
+				}
+			},
+			checks(check{"/blah/2.1.0/A-UBI.bin", "u2", "x", content, map[string]string{}}),
+		},
+		{
+			"invalid-name-template", true, true, true, true,
+			func(s *httptest.Server) (*context.Context, config.Upload) {
+				return ctx, config.Upload{
+					Mode:         ModeBinary,
+					Name:         "a",
+					Target:       s.URL + "/{{.ProjectName}}/{{.Version}}/",
+					Username:     "u2",
+					NameTemplate: "{{ .ArtifactName }",
+					TrustedCerts: cert(s),
+				}
+			},
+			checks(),
+		},
+		{
+			"version-header", true, true, false, false,
+			func(s *httptest.Server) (*context.Context, config.Upload) {
+				return ctx, config.Upload{
+					Mode:          ModeBinary,
+					Name:          "a",
+					Target:        s.URL + "/{{.ProjectName}}/{{.Version}}/",
+					Username:      "u2",
+					VersionHeader: "x-version",
+					TrustedCerts:  cert(s),
+				}
+			},
+			checks(check{"/blah/2.1.0/a.ubi", "u2", "x", content, map[string]string{"x-version": "2.1.0"}}),
+		},
 		{
 			"custom-headers-with-template", true, true, false, false,
 			func(s *httptest.Server) (*context.Context, config.Upload) {
@@ -563,6 +977,56 @@ func TestUpload(t *testing.T) {
 			},
 			checks(check{"/blah/2.1.0/a.ubi", "u2", "x", content, map[string]string{"x-project-name": "blah"}}),
 		},
+		{
+			"binary-custom-headers", true, true, false, false,
+			func(s *httptest.Server) (*context.Context, config.Upload) {
+				return ctx, config.Upload{
+					Mode:     ModeBinary,
+					Name:     "a",
+					Target:   s.URL + "/{{.ProjectName}}/{{.Version}}/",
+					Username: "u2",
+					CustomHeaders: map[string]string{
+						"X-Trace-Bin": "version {{ .Version }}",
+						"X-Version":   "version {{ .Version }}",
+					},
+					TrustedCerts: cert(s),
+				}
+			},
+			checks(check{"/blah/2.1.0/a.ubi", "u2", "x", content, map[string]string{"X-Trace-Bin": "dmVyc2lvbiAyLjEuMA", "X-Version": "version 2.1.0"}}),
+		},
+		{
+			"empty-body", true, true, false, false,
+			func(s *httptest.Server) (*context.Context, config.Upload) {
+				return ctx, config.Upload{
+					Mode:           ModeBinary,
+					Name:           "a",
+					Target:         s.URL + "/{{.ProjectName}}/{{.Version}}/",
+					Username:       "u2",
+					BodyMode:       BodyModeEmpty,
+					ChecksumHeader: "X-SHA256",
+					CustomHeaders: map[string]string{
+						"X-Artifact": "{{ .ArtifactName }}",
+					},
+					TrustedCerts: cert(s),
+				}
+			},
+			checks(check{"/blah/2.1.0/a.ubi", "u2", "x", nil, map[string]string{"X-Artifact": "a.ubi", "X-SHA256": "e37a649e5b4e9dd25672f22470f7ac0e5a902c2e02b54f9adc8ce791383d7514"}}),
+		},
+		{
+			"hash-fanout", true, true, false, false,
+			func(s *httptest.Server) (*context.Context, config.Upload) {
+				return ctx, config.Upload{
+					Mode:               ModeBinary,
+					Name:               "a",
+					Target:             s.URL + "/cas/{{ .HashFanout }}/{{ .SHA256 }}",
+					Username:           "u2",
+					CustomArtifactName: true,
+					HashFanout:         2,
+					TrustedCerts:       cert(s),
+				}
+			},
+			checks(check{"/cas/e3/7a/e37a649e5b4e9dd25672f22470f7ac0e5a902c2e02b54f9adc8ce791383d7514", "u2", "x", content, map[string]string{}}),
+		},
 		{
 			"invalid-template-in-custom-headers", true, true, true, true,
 			func(s *httptest.Server) (*context.Context, config.Upload) {
@@ -639,6 +1103,28 @@ func TestUpload(t *testing.T) {
 				check{"/blah/2.1.0/a.deb", "u3", "x", content, map[string]string{}},
 			),
 		},
+		{
+			name: "given a server without ClientAuth, " +
+				"and an Upload with ClientX509Cert and ClientX509Key set, " +
+				"then the response should pass",
+			tryTLS: true,
+			setup: func(s *httptest.Server) (*context.Context, config.Upload) {
+				s.TLS.ClientAuth = tls.NoClientCert
+				return ctx, config.Upload{
+					Mode:           ModeArchive,
+					Name:           "a",
+					Target:         s.URL + "/{{.ProjectName}}/{{.Version}}/",
+					Username:       "u3",
+					TrustedCerts:   cert(s),
+					ClientX509Cert: "testcert.pem",
+					ClientX509Key:  "testkey.pem",
+					Exts:           []string{"deb", "rpm"},
+				}
+			},
+			check: checks(
+				check{"/blah/2.1.0/a.deb", "u3", "x", content, map[string]string{}},
+			),
+		},
 		{
 			name: "given a server with ClientAuth = RequireAnyClientCert, " +
 				"and an Upload without either ClientX509Cert or ClientX509Key set, " +
@@ -708,17 +1194,140 @@ func cert(srv *httptest.Server) string {
 	return string(pem.EncodeToMemory(block))
 }
 
-func TestManyUploads(t *testing.T) {
-	var uploaded atomic.Bool
-	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusCreated)
-		uploaded.Store(true)
+// acceptAll is a ResponseChecker accepting any response.
+func acceptAll(*http.Response) error { return nil }
+
+// addArtifacts writes a file with the given content for each of the names to
+// a temporary directory, and adds them to ctx as artifacts of the given type.
+func addArtifacts(tb testing.TB, ctx *context.Context, typ artifact.Type, content string, names ...string) []*artifact.Artifact {
+	tb.Helper()
+	folder := tb.TempDir()
+	arts := make([]*artifact.Artifact, 0, len(names))
+	for _, name := range names {
+		path := filepath.Join(folder, name)
+		require.NoError(tb, os.WriteFile(path, []byte(content), 0o644))
+		a := &artifact.Artifact{
+			Name: name,
+			Path: path,
+			Type: typ,
+		}
+		ctx.Artifacts.Add(a)
+		arts = append(arts, a)
+	}
+	return arts
+}
+
+// recorder is a test server recording the requests it receives, with their
+// bodies.
+type recorder struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+// newRecorder starts a recorder answering with handler, or with 201 Created
+// if it is nil. The request body is read before handler is called, and can
+// be read again by it.
+func newRecorder(tb testing.TB, handler http.HandlerFunc) *recorder {
+	tb.Helper()
+	rec := &recorder{}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bts, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(bts))
+		rec.mu.Lock()
+		rec.requests = append(rec.requests, r)
+		rec.bodies = append(rec.bodies, string(bts))
+		rec.mu.Unlock()
+		if handler == nil {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		handler(w, r)
 	}))
-	t.Cleanup(srv.Close)
+	tb.Cleanup(rec.Close)
+	return rec
+}
 
-	tmpFile := filepath.Join(t.TempDir(), "checksums.txt")
-	require.NoError(t, os.WriteFile(tmpFile, []byte("a"), 0o644))
+// paths returns the paths of the requests received with the given method,
+// sorted.
+func (rec *recorder) paths(method string) []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var paths []string
+	for _, r := range rec.requests {
+		if r.Method == method {
+			paths = append(paths, r.URL.Path)
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// files returns the last body received for each path.
+func (rec *recorder) files() map[string]string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	files := map[string]string{}
+	for i, r := range rec.requests {
+		files[r.URL.Path] = rec.bodies[i]
+	}
+	return files
+}
+
+// last returns the last request received, if any.
+func (rec *recorder) last() *http.Request {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.requests) == 0 {
+		return nil
+	}
+	return rec.requests[len(rec.requests)-1]
+}
+
+// reset forgets the requests received so far.
+func (rec *recorder) reset() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.requests = nil
+	rec.bodies = nil
+}
+
+// sha256 of "a", the contents of the artifacts created by newArchivesCtx.
+const deltaSum = "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"
+
+// newArchivesCtx returns a context with two archives, a.tar.gz and b.tar.gz.
+func newArchivesCtx(t *testing.T) *context.Context {
+	t.Helper()
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz", "b.tar.gz")
+	return ctx
+}
+
+// newDeltaServer starts a recorder serving manifest as /checksums.txt, unless
+// it is empty.
+func newDeltaServer(tb testing.TB, manifest string) *recorder {
+	tb.Helper()
+	return newRecorder(tb, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if r.URL.Path != "/checksums.txt" || manifest == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(manifest))
+	})
+}
 
+func TestManyUploads(t *testing.T) {
+	srv := newRecorder(t, nil)
 	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
 		ProjectName: "blah",
 		Env:         []string{"FOO=1"},
@@ -739,14 +1348,3563 @@ func TestManyUploads(t *testing.T) {
 			},
 		},
 	}, testctx.WithVersion("2.1.0"))
+	addArtifacts(t, ctx, artifact.Checksum, "a", "checksums.txt")
 
-	ctx.Artifacts.Add(&artifact.Artifact{
-		Name: "checksums.txt",
-		Path: tmpFile,
-		Type: artifact.Checksum,
-	})
-	err := Upload(ctx, ctx.Config.Uploads, "test", func(*http.Response) error { return nil })
+	err := Upload(ctx, ctx.Config.Uploads, "test", acceptAll)
 	require.Error(t, err)
 	require.True(t, pipe.IsSkip(err), err)
-	require.True(t, uploaded.Load(), "should have uploaded")
+	require.Equal(t, map[string]string{"/checksums.txt": "a"}, srv.files(), "should have uploaded")
+	require.Equal(t, []context.SkippedUpload{
+		{Kind: "test", Name: "skip1", Reason: "skip evaluates to true"},
+		{Kind: "test", Name: "skip1", Reason: "skip evaluates to true"},
+	}, ctx.SkippedUploads)
+}
+
+func TestUploadSBOM(t *testing.T) {
+	ctx := testctx.Wrap(t.Context())
+	for _, a := range []struct {
+		name, id string
+		typ      artifact.Type
+	}{
+		{"a.tar.gz", "default", artifact.UploadableArchive},
+		{"a.sbom.json", "sbom", artifact.SBOM},
+	} {
+		addArtifacts(t, ctx, a.typ, "a", a.name)[0].Extra = map[string]any{
+			artifact.ExtraID: a.id,
+		}
+	}
+
+	for name, tt := range map[string]struct {
+		sbom     bool
+		ids      []string
+		expected []string
+	}{
+		"disabled": {false, nil, []string{"/a.tar.gz"}},
+		"enabled":  {true, nil, []string{"/a.sbom.json", "/a.tar.gz"}},
+		"only":     {true, []string{"sbom"}, []string{"/a.sbom.json"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := newRecorder(t, nil)
+			upload := config.Upload{
+				Name:   "a",
+				Mode:   ModeArchive,
+				Method: http.MethodPut,
+				Target: srv.URL,
+				SBOM:   tt.sbom,
+				IDs:    tt.ids,
+			}
+			require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+			require.Equal(t, tt.expected, srv.paths(http.MethodPut))
+		})
+	}
+}
+
+func TestUploadSuccessCodes(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".json") {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		ProjectName: "blah",
+	}, testctx.WithVersion("2.1.0"))
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz")
+	addArtifacts(t, ctx, artifact.Metadata, "a", "metadata.json")
+
+	is200 := func(r *http.Response) error {
+		if r.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected http response status: %s", r.Status)
+		}
+		return nil
+	}
+
+	for name, tt := range map[string]struct {
+		codes map[string][]int
+		err   string
+	}{
+		"distinct codes": {
+			map[string][]int{"default": {http.StatusCreated}, "metadata": {http.StatusOK, http.StatusAccepted}},
+			"",
+		},
+		"metadata not accepted": {
+			map[string][]int{"default": {http.StatusCreated}, "metadata": {http.StatusOK}},
+			"202 Accepted",
+		},
+		"default only": {
+			map[string][]int{"default": {http.StatusCreated}},
+			"202 Accepted",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := Upload(ctx, []config.Upload{{
+				Name:         "a",
+				Mode:         ModeArchive,
+				Target:       srv.URL,
+				Meta:         true,
+				SuccessCodes: tt.codes,
+			}}, "test", is200)
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestUploadSuccessHeader(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/ok/") {
+			w.Header().Set("X-Upload-Status", "ok")
+		}
+		if strings.HasPrefix(r.URL.Path, "/failed/") {
+			w.Header().Set("X-Upload-Status", "failed")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for path, expected := range map[string]string{
+		"/ok":     "",
+		"/nope":   "missing X-Upload-Status response header",
+		"/failed": `unexpected X-Upload-Status response header: "failed"`,
+	} {
+		t.Run(path, func(t *testing.T) {
+			err := Upload(newArchivesCtx(t), []config.Upload{{
+				Name:               "a",
+				Mode:               ModeArchive,
+				Method:             http.MethodPut,
+				Target:             srv.URL + path + "/",
+				SuccessCodes:       map[string][]int{"default": {http.StatusOK}},
+				SuccessHeader:      "X-Upload-Status",
+				SuccessHeaderValue: "ok",
+			}}, "test", acceptAll)
+			if expected == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, expected)
+		})
+	}
+}
+
+func TestUploadExtraFilter(t *testing.T) {
+	srv := newRecorder(t, nil)
+	ctx := testctx.Wrap(t.Context())
+	for name, channel := range map[string]string{
+		"a.tar.gz": "stable",
+		"b.tar.gz": "beta",
+	} {
+		addArtifacts(t, ctx, artifact.UploadableArchive, "a", name)[0].Extra = map[string]any{
+			"channel": channel,
+		}
+	}
+
+	require.NoError(t, Upload(ctx, []config.Upload{{
+		Name:        "a",
+		Mode:        ModeArchive,
+		Method:      http.MethodPut,
+		Target:      srv.URL,
+		ExtraFilter: map[string]string{"channel": "stable"},
+	}}, "test", acceptAll))
+	require.Equal(t, []string{"/a.tar.gz"}, srv.paths(http.MethodPut))
+}
+
+func TestHashFanout(t *testing.T) {
+	require.Empty(t, hashFanout("abcdef", 0))
+	require.Equal(t, "ab", hashFanout("abcdef", 1))
+	require.Equal(t, "ab/cd/ef", hashFanout("abcdef", 5))
+}
+
+func TestUploadChecksumInTemplates(t *testing.T) {
+	const sum = "e37a649e5b4e9dd25672f22470f7ac0e5a902c2e02b54f9adc8ce791383d7514"
+	for name, tt := range map[string]struct {
+		upload   config.Upload
+		expected string
+	}{
+		"target": {
+			upload: config.Upload{
+				Target:             "/blobs/{{ .Checksum }}/{{ .SHA256 }}",
+				CustomArtifactName: true,
+			},
+			expected: "/blobs/sha256:" + sum + "/" + sum,
+		},
+		"name_template": {
+			upload: config.Upload{
+				Target:       "/",
+				NameTemplate: "{{ .HashFanout }}/{{ .SHA256 }}",
+				HashFanout:   1,
+			},
+			expected: "/e3/" + sum,
+		},
+		"form_fields": {
+			upload: config.Upload{
+				Target:     "/",
+				BodyMode:   BodyModeForm,
+				FormFields: map[string]string{"sha256": "{{ .SHA256 }}"},
+			},
+			expected: sum,
+		},
+		"json_envelope": {
+			upload: config.Upload{
+				Target:       "/",
+				BodyMode:     BodyModeJSONEnvelope,
+				JSONEnvelope: map[string]string{"sha256": "{{ .SHA256 }}"},
+			},
+			expected: `"sha256":"` + sum + `"`,
+		},
+		"sidecar_template": {
+			upload: config.Upload{
+				Target:          "/",
+				SidecarTemplate: `{"sha256": "{{ .SHA256 }}"}`,
+				SidecarExt:      "json",
+			},
+			expected: `{"sha256": "` + sum + `"}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := newRecorder(t, nil)
+			ctx := testctx.Wrap(t.Context())
+			addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")
+
+			upload := tt.upload
+			upload.Name = "a"
+			upload.Mode = ModeArchive
+			upload.Target = srv.URL + upload.Target
+			require.NoError(t, Validate(ctx, []config.Upload{upload}))
+			require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+			var requests []string
+			for path, body := range srv.files() {
+				requests = append(requests, path+" "+body)
+			}
+			require.Condition(t, func() bool {
+				return slices.ContainsFunc(requests, func(r string) bool {
+					return strings.Contains(r, tt.expected)
+				})
+			}, "%q not found in %q", tt.expected, requests)
+		})
+	}
+}
+
+func TestUploadContinueOnError(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "bad") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	is2xx := func(r *http.Response) error {
+		if r.StatusCode/100 != 2 {
+			return fmt.Errorf("unexpected http response status: %s", r.Status)
+		}
+		return nil
+	}
+
+	for name, tt := range map[string]struct {
+		continueOnError bool
+		names           []string
+		err             string
+	}{
+		"fail fast":   {false, []string{"good.tar.gz", "bad.tar.gz"}, "upload failed"},
+		"some failed": {true, []string{"good.tar.gz", "bad.tar.gz", "bad2.tar.gz"}, ""},
+		"all failed":  {true, []string{"bad.tar.gz", "bad2.tar.gz"}, "all 2 uploads failed"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := testctx.Wrap(t.Context())
+			addArtifacts(t, ctx, artifact.UploadableArchive, "a", tt.names...)
+			err := Upload(ctx, []config.Upload{{
+				Name:            "a",
+				Mode:            ModeArchive,
+				Target:          srv.URL,
+				ContinueOnError: tt.continueOnError,
+			}}, "test", is2xx)
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.err)
+			require.Equal(t, tt.continueOnError, pipe.IsSkip(err), err)
+		})
+	}
+}
+
+func TestUploadMaxFileSize(t *testing.T) {
+	srv := newRecorder(t, nil)
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, strings.Repeat("a", 2048), "a.tar.gz")
+
+	upload := config.Upload{
+		Name:        "a",
+		Mode:        ModeArchive,
+		Target:      srv.URL,
+		MaxFileSize: "1KiB",
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	err := Upload(ctx, []config.Upload{upload}, "test", acceptAll)
+	require.ErrorContains(t, err, "a.tar.gz is 2.0 KiB, which is bigger than the max_file_size of 1.0 KiB")
+	require.Empty(t, srv.files())
+
+	upload.MaxFileSize = "2 KiB"
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	require.Len(t, srv.files(), 1)
+}
+
+func TestUploadOrder(t *testing.T) {
+	srv := newRecorder(t, nil)
+	ctx := testctx.Wrap(t.Context())
+	ctx.Parallelism = 1
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "c.tar.gz", "a.tar.gz", "d.tar.gz", "b.tar.gz")
+	require.NoError(t, Upload(ctx, []config.Upload{{
+		Name:   "a",
+		Mode:   ModeArchive,
+		Method: http.MethodPut,
+		Target: srv.URL,
+	}}, "test", acceptAll))
+	var paths []string
+	for _, r := range srv.requests {
+		paths = append(paths, r.URL.Path)
+	}
+	require.Equal(t, []string{"/a.tar.gz", "/b.tar.gz", "/c.tar.gz", "/d.tar.gz"}, paths)
+}
+
+func TestUploadRequestMutator(t *testing.T) {
+	srv := newRecorder(t, nil)
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz")
+	uploads := []config.Upload{{
+		Name:   "a",
+		Mode:   ModeArchive,
+		Method: http.MethodPut,
+		Target: srv.URL,
+	}}
+
+	require.NoError(t, UploadWithOptions(ctx, uploads, "test", acceptAll, Options{
+		RequestMutator: func(r *http.Request) error {
+			r.Header.Set("X-Nonce", "1234")
+			return nil
+		},
+	}))
+	require.Equal(t, "1234", srv.last().Header.Get("X-Nonce"))
+
+	err := UploadWithOptions(ctx, uploads, "test", acceptAll, Options{
+		RequestMutator: func(*http.Request) error {
+			return errors.New("nope")
+		},
+	})
+	require.ErrorContains(t, err, "failed to mutate request: nope")
+	require.Len(t, srv.requests, 1)
+}
+
+func TestUploadArtifactCallbacks(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/b.tar.gz" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz", "b.tar.gz", "c.tar.gz")
+
+	var mu sync.Mutex
+	started := map[string]int{}
+	done := map[string]error{}
+	err := UploadWithOptions(ctx, []config.Upload{{
+		Name:            "a",
+		Mode:            ModeArchive,
+		Method:          http.MethodPut,
+		Target:          srv.URL,
+		ContinueOnError: true,
+	}}, "test", func(r *http.Response) error {
+		if r.StatusCode != http.StatusCreated {
+			return fmt.Errorf("unexpected status %s", r.Status)
+		}
+		return nil
+	}, Options{
+		OnArtifactStart: func(a *artifact.Artifact) {
+			mu.Lock()
+			defer mu.Unlock()
+			started[a.Name]++
+		},
+		OnArtifactDone: func(a *artifact.Artifact, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			require.NotContains(t, done, a.Name)
+			done[a.Name] = err
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"a.tar.gz": 1, "b.tar.gz": 1, "c.tar.gz": 1}, started)
+	require.Len(t, done, 3)
+	require.NoError(t, done["a.tar.gz"])
+	require.ErrorContains(t, done["b.tar.gz"], "unexpected status 403 Forbidden")
+	require.NoError(t, done["c.tar.gz"])
+}
+
+func TestUploadProvenanceHeaders(t *testing.T) {
+	srv := newRecorder(t, nil)
+	ctx := testctx.Wrap(
+		t.Context(),
+		testctx.WithVersion("1.2.3"),
+		testctx.WithCommit("5cf4b5ad8d3c1b3e9f3a1e2f3b0c9d8e7f6a5b4c"),
+		testctx.WithDate(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)),
+	)
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz")
+	upload := config.Upload{
+		Name:              "a",
+		Mode:              ModeArchive,
+		Method:            http.MethodPut,
+		Target:            srv.URL,
+		ProvenanceHeaders: true,
+	}
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	headers := srv.last().Header
+	require.Equal(t, "5cf4b5ad8d3c1b3e9f3a1e2f3b0c9d8e7f6a5b4c", headers.Get("X-Build-Commit"))
+	require.Equal(t, "1.2.3", headers.Get("X-Build-Version"))
+	require.Equal(t, "2026-01-02T03:04:05Z", headers.Get("X-Build-Date"))
+
+	t.Run("custom header wins", func(t *testing.T) {
+		upload := upload
+		upload.CustomHeaders = map[string]string{"x-build-version": "v{{ .Version }}"}
+		require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+		require.Equal(t, []string{"v1.2.3"}, srv.last().Header.Values("X-Build-Version"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		upload := upload
+		upload.ProvenanceHeaders = false
+		require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+		require.Empty(t, srv.last().Header.Get("X-Build-Commit"))
+	})
+}
+
+func TestUploadMtimeHeader(t *testing.T) {
+	srv := newRecorder(t, nil)
+	ctx := testctx.Wrap(t.Context())
+	a := addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz")[0]
+	mtime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	require.NoError(t, os.Chtimes(a.Path, mtime, mtime))
+
+	require.NoError(t, Upload(ctx, []config.Upload{{
+		Name:        "a",
+		Mode:        ModeArchive,
+		Method:      http.MethodPut,
+		Target:      srv.URL,
+		MtimeHeader: "X-Mtime",
+	}}, "test", acceptAll))
+	require.Equal(t, "2024-05-06T07:08:09Z", srv.last().Header.Get("X-Mtime"))
+}
+
+func TestUploadChecksumMissing(t *testing.T) {
+	for name, optional := range map[string]bool{
+		"required": false,
+		"optional": true,
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := newRecorder(t, nil)
+			err := Upload(newArchivesCtx(t), []config.Upload{{
+				Name:             "a",
+				Mode:             ModeArchive,
+				Method:           http.MethodPut,
+				Target:           srv.URL,
+				Checksum:         true,
+				ChecksumOptional: optional,
+			}}, "test", acceptAll)
+			if optional {
+				require.NoError(t, err)
+				require.Equal(t, []string{"/a.tar.gz", "/b.tar.gz"}, srv.paths(http.MethodPut))
+				return
+			}
+			require.EqualError(t, err, "a: test: checksum upload requested but no checksum artifact found")
+			require.Empty(t, srv.paths(http.MethodPut))
+		})
+	}
+}
+
+func TestUploadDisplayName(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	ctx := newArchivesCtx(t)
+	ctx.Env["TEST_A_USERNAME"] = "u"
+	ctx.Env["TEST_A_SECRET"] = "p"
+	upload := config.Upload{
+		Name:        "a",
+		Mode:        ModeArchive,
+		Method:      http.MethodPut,
+		Target:      srv.URL,
+		DisplayName: "cdn",
+	}
+	err := Upload(ctx, []config.Upload{upload}, "test", func(r *http.Response) error {
+		if user, pass, _ := r.Request.BasicAuth(); user != "u" || pass != "p" {
+			return errors.New("missing credentials")
+		}
+		return errors.New(r.Status)
+	})
+	require.ErrorContains(t, err, "a: cdn: upload failed: 500 Internal Server Error")
+
+	upload.Mode = "nope"
+	require.EqualError(t, Upload(ctx, []config.Upload{upload}, "test", nil), `a: cdn: mode "nope" not supported`)
+
+	upload.Target = ""
+	err = CheckConfig(ctx, &upload, "test")
+	require.True(t, pipe.IsSkip(err), err)
+	require.EqualError(t, err, "cdn section 'a' is not configured properly (missing target)")
+}
+
+func TestUploadSubArchTarget(t *testing.T) {
+	srv := newRecorder(t, nil)
+	ctx := testctx.Wrap(t.Context())
+	for _, arch := range []artifact.Artifact{
+		{Goos: "linux", Goarch: "arm", Goarm: "6"},
+		{Goos: "linux", Goarch: "arm", Goarm: "7"},
+		{Goos: "linux", Goarch: "amd64", Goamd64: "v3"},
+		{Goos: "linux", Goarch: "mips", Gomips: "softfloat"},
+	} {
+		a := addArtifacts(t, ctx, artifact.UploadableBinary, "a", "bin")[0]
+		a.Goos = arch.Goos
+		a.Goarch = arch.Goarch
+		a.Goarm = arch.Goarm
+		a.Goamd64 = arch.Goamd64
+		a.Gomips = arch.Gomips
+	}
+
+	upload := config.Upload{
+		Name:   "a",
+		Mode:   ModeBinary,
+		Method: http.MethodPut,
+		Target: srv.URL + "/{{ .Os }}/{{ .Arch }}{{ .Arm }}{{ .Amd64 }}{{ with .Mips }}-{{ . }}{{ end }}/",
+	}
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	require.Equal(t, []string{
+		"/linux/amd64v3/bin",
+		"/linux/arm6/bin",
+		"/linux/arm7/bin",
+		"/linux/mips-softfloat/bin",
+	}, srv.paths(http.MethodPut))
+}
+
+func TestUploadFailIfEmpty(t *testing.T) {
+	srv := newRecorder(t, nil)
+	for name, fail := range map[string]bool{
+		"warn": false,
+		"fail": true,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := newArchivesCtx(t)
+			upload := config.Upload{
+				Name:        "a",
+				Mode:        ModeArchive,
+				Method:      http.MethodPut,
+				Target:      srv.URL,
+				Exts:        []string{"zip"},
+				FailIfEmpty: fail,
+			}
+			err := Upload(ctx, []config.Upload{upload}, "test", acceptAll)
+			if fail {
+				require.EqualError(t, err, "a: test: no artifacts found")
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+	require.Empty(t, srv.files())
+}
+
+func TestUploadVerifyGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, err := gw.Write(bytes.Repeat([]byte("some content "), 1024))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	valid := buf.String()
+
+	srv := newRecorder(t, nil)
+	upload := func(t *testing.T, content string, verify bool) error {
+		t.Helper()
+		ctx := testctx.Wrap(t.Context())
+		addArtifacts(t, ctx, artifact.UploadableArchive, content, "a.tar.gz")
+		return Upload(ctx, []config.Upload{{
+			Name:       "a",
+			Mode:       ModeArchive,
+			Target:     srv.URL,
+			VerifyGzip: verify,
+		}}, "test", acceptAll)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		require.NoError(t, upload(t, valid, true))
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		err := upload(t, valid[:len(valid)/2], true)
+		require.ErrorIs(t, err, errCorruptedGzip)
+	})
+
+	t.Run("not a gzip", func(t *testing.T) {
+		err := upload(t, "not a gzip", true)
+		require.ErrorIs(t, err, errCorruptedGzip)
+	})
+
+	t.Run("truncated without verification", func(t *testing.T) {
+		require.NoError(t, upload(t, valid[:len(valid)/2], false))
+	})
+}
+
+func TestHashAsset(t *testing.T) {
+	t.Run("small", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "a")
+		require.NoError(t, os.WriteFile(path, []byte("blah!"), 0o644))
+
+		h, err := hashAsset(&artifact.Artifact{Path: path}, false, bufferThresholdDefault)
+		require.NoError(t, err)
+		require.Equal(t, "e37a649e5b4e9dd25672f22470f7ac0e5a902c2e02b54f9adc8ce791383d7514", h.sum)
+
+		a := h.open()
+		require.NotNil(t, a)
+		require.Equal(t, int64(5), a.Size)
+		bts, err := io.ReadAll(a.ReadCloser)
+		require.NoError(t, err)
+		require.Equal(t, "blah!", string(bts))
+	})
+
+	t.Run("big", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "a")
+		require.NoError(t, os.WriteFile(path, make([]byte, bufferThresholdDefault+1), 0o644))
+
+		art := &artifact.Artifact{Path: path}
+		h, err := hashAsset(art, false, bufferThresholdDefault)
+		require.NoError(t, err)
+		sum, err := art.Checksum("sha256")
+		require.NoError(t, err)
+		require.Equal(t, sum, h.sum)
+		require.Nil(t, h.open())
+	})
+
+	t.Run("big fast", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "a")
+		// not a multiple of the chunk size, with non-zero contents.
+		data := make([]byte, bufferThresholdDefault+hashChunkSize/2+3)
+		for i := range data {
+			data[i] = byte(i % 251)
+		}
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+
+		art := &artifact.Artifact{Path: path}
+		h, err := hashAsset(art, true, bufferThresholdDefault)
+		require.NoError(t, err)
+		sum, err := art.Checksum("sha256")
+		require.NoError(t, err)
+		require.Equal(t, sum, h.sum)
+		require.Nil(t, h.open())
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := hashAsset(&artifact.Artifact{Path: filepath.Join(t.TempDir(), "a")}, false, bufferThresholdDefault)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func BenchmarkChecksumHeader(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "a")
+	require.NoError(b, os.WriteFile(path, make([]byte, bufferThresholdDefault), 0o644))
+	art := &artifact.Artifact{Path: path}
+
+	b.Run("single read", func(b *testing.B) {
+		for b.Loop() {
+			h, err := hashAsset(art, false, bufferThresholdDefault)
+			require.NoError(b, err)
+			_, err = io.Copy(io.Discard, h.open().ReadCloser)
+			require.NoError(b, err)
+		}
+	})
+
+	b.Run("double read", func(b *testing.B) {
+		for b.Loop() {
+			_, err := art.Checksum("sha256")
+			require.NoError(b, err)
+			a, err := assetOpen("test", art)
+			require.NoError(b, err)
+			_, err = io.Copy(io.Discard, a.ReadCloser)
+			require.NoError(b, err)
+			require.NoError(b, a.ReadCloser.Close())
+		}
+	})
+}
+
+func BenchmarkHashAsset(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "a")
+	require.NoError(b, os.WriteFile(path, make([]byte, 64<<20), 0o644))
+	art := &artifact.Artifact{Path: path}
+
+	for name, fast := range map[string]bool{
+		"serial":    false,
+		"pipelined": true,
+	} {
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				_, err := hashAsset(art, fast, bufferThresholdDefault)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
+
+func TestUploadPerFileChecksum(t *testing.T) {
+	srv := newRecorder(t, nil)
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz", "b.tar.gz")
+	addArtifacts(t, ctx, artifact.Checksum, "blah!", "checksums.txt")
+
+	require.NoError(t, Upload(ctx, []config.Upload{{
+		Name:            "a",
+		Mode:            ModeArchive,
+		Target:          srv.URL,
+		Checksum:        true,
+		PerFileChecksum: true,
+	}}, "test", acceptAll))
+
+	sum := "e37a649e5b4e9dd25672f22470f7ac0e5a902c2e02b54f9adc8ce791383d7514"
+	require.Equal(t, map[string]string{
+		"/a.tar.gz":        "blah!",
+		"/a.tar.gz.sha256": sum + "  a.tar.gz\n",
+		"/b.tar.gz":        "blah!",
+		"/b.tar.gz.sha256": sum + "  b.tar.gz\n",
+	}, srv.files())
+}
+
+func TestUploadChecksumTrailer(t *testing.T) {
+	srv := newRecorder(t, nil)
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")
+
+	upload := config.Upload{
+		Name:            "a",
+		Mode:            ModeArchive,
+		Target:          srv.URL,
+		ChecksumHeader:  "X-SHA256-Sum",
+		ChecksumTrailer: true,
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+
+	r := srv.last()
+	sum := sha256.Sum256([]byte("blah!"))
+	require.Equal(t, map[string]string{"/a.tar.gz": "blah!"}, srv.files())
+	require.Equal(t, []string{"chunked"}, r.TransferEncoding)
+	require.Equal(t, hex.EncodeToString(sum[:]), r.Trailer.Get("X-SHA256-Sum"))
+}
+
+func TestUploadErrors(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unauthorized/a.tar.gz":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/conflict/a.tar.gz":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	})
+
+	ctx := testctx.Wrap(t.Context())
+	art := addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz")[0]
+
+	is2xx := func(r *http.Response) error {
+		if r.StatusCode/100 == 2 {
+			return nil
+		}
+		return errors.New(r.Status)
+	}
+	upload := func(target string) error {
+		return Upload(ctx, []config.Upload{{
+			Name:   "a",
+			Mode:   ModeArchive,
+			Target: srv.URL + target,
+		}}, "test", is2xx)
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		err := upload("/unauthorized")
+		require.EqualError(t, err, "a: test: upload failed: 401 Unauthorized")
+
+		uerr, ok := errors.AsType[*UploadError](err)
+		require.True(t, ok, err)
+		require.Equal(t, http.StatusUnauthorized, uerr.StatusCode)
+		require.Equal(t, srv.URL+"/unauthorized/a.tar.gz", uerr.Target)
+		require.Equal(t, art, uerr.Artifact)
+
+		aerr, ok := errors.AsType[*AuthError](err)
+		require.True(t, ok, err)
+		require.Equal(t, http.StatusUnauthorized, aerr.StatusCode)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		err := upload("/conflict")
+		uerr, ok := errors.AsType[*UploadError](err)
+		require.True(t, ok, err)
+		require.Equal(t, http.StatusConflict, uerr.StatusCode)
+
+		_, ok = errors.AsType[*AuthError](err)
+		require.False(t, ok, err)
+	})
+
+	t.Run("no response", func(t *testing.T) {
+		err := Upload(ctx, []config.Upload{{
+			Name:   "a",
+			Mode:   ModeArchive,
+			Target: "http://localhost:1",
+		}}, "test", is2xx)
+		uerr, ok := errors.AsType[*UploadError](err)
+		require.True(t, ok, err)
+		require.Zero(t, uerr.StatusCode)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		err := Upload(ctx, []config.Upload{{
+			Name: "a",
+			Skip: "true",
+		}}, "test", is2xx)
+		require.True(t, pipe.IsSkip(err), err)
+		_, ok := errors.AsType[*UploadError](err)
+		require.False(t, ok, err)
+	})
+}
+
+func TestUploadJSONEnvelope(t *testing.T) {
+	srv := newRecorder(t, nil)
+	content := "blah!\x00\x01binary"
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		ProjectName: "blah",
+	}, testctx.WithVersion("2.1.0"))
+	addArtifacts(t, ctx, artifact.UploadableArchive, content, "a.tar.gz")
+
+	upload := func(t *testing.T, fields map[string]string) (map[string]string, error) {
+		t.Helper()
+		srv.reset()
+		err := Upload(ctx, []config.Upload{{
+			Name:         "a",
+			Mode:         ModeArchive,
+			Target:       srv.URL,
+			BodyMode:     BodyModeJSONEnvelope,
+			JSONEnvelope: fields,
+		}}, "test", func(r *http.Response) error {
+			if r.StatusCode != http.StatusCreated {
+				return errors.New(r.Status)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		var envelope map[string]string
+		require.NoError(t, json.Unmarshal([]byte(srv.files()["/a.tar.gz"]), &envelope))
+		return envelope, nil
+	}
+
+	t.Run("default fields", func(t *testing.T) {
+		envelope, err := upload(t, nil)
+		require.NoError(t, err)
+		require.Equal(t, "application/json", srv.last().Header.Get("Content-Type"))
+		require.Len(t, envelope, 2)
+		require.Equal(t, "a.tar.gz", envelope["name"])
+		data, err := base64.StdEncoding.DecodeString(envelope["data"])
+		require.NoError(t, err)
+		require.Equal(t, content, string(data))
+	})
+
+	t.Run("custom fields", func(t *testing.T) {
+		envelope, err := upload(t, map[string]string{
+			"filename": "{{ .ArtifactName }}",
+			"version":  `{{ .Version }} "quoted"`,
+		})
+		require.NoError(t, err)
+		require.Len(t, envelope, 3)
+		require.Equal(t, "a.tar.gz", envelope["filename"])
+		require.Equal(t, `2.1.0 "quoted"`, envelope["version"])
+		require.NotEmpty(t, envelope["data"])
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		_, err := upload(t, map[string]string{
+			"name": "{{ .Nope }}",
+		})
+		require.ErrorContains(t, err, "failed to build json envelope")
+	})
+}
+
+func TestUploadJSONEnvelopeBodySchema(t *testing.T) {
+	srv := newRecorder(t, nil)
+	schema := filepath.Join(t.TempDir(), "schema.json")
+	require.NoError(t, os.WriteFile(schema, []byte(`{
+		"type": "object",
+		"required": ["name", "version", "data"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"version": {"type": "string"}
+		}
+	}`), 0o644))
+
+	ctx := testctx.Wrap(t.Context(), testctx.WithVersion("2.1.0"))
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz")
+	upload := func(fields map[string]string) error {
+		srv.reset()
+		return Upload(ctx, []config.Upload{{
+			Name:         "a",
+			Mode:         ModeArchive,
+			Method:       http.MethodPut,
+			Target:       srv.URL,
+			BodyMode:     BodyModeJSONEnvelope,
+			JSONEnvelope: fields,
+			BodySchema:   schema,
+		}}, "test", acceptAll)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		require.NoError(t, upload(map[string]string{
+			"name":    "{{ .ArtifactName }}",
+			"version": "{{ .Version }}",
+		}))
+		require.Len(t, srv.requests, 1)
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		err := upload(map[string]string{
+			"name": "{{ .ArtifactName }}",
+		})
+		require.ErrorContains(t, err, "json envelope doesn't match body_schema")
+		require.ErrorContains(t, err, "missing properties: 'version'")
+		require.Empty(t, srv.requests)
+	})
+}
+
+func TestUploadResolve(t *testing.T) {
+	var host string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(u.Host)
+	require.NoError(t, err)
+
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz")
+
+	// the test server certificate is valid for example.com.
+	for name, addr := range map[string]string{
+		"with port":    "127.0.0.1:" + port,
+		"without port": "127.0.0.1",
+	} {
+		t.Run(name, func(t *testing.T) {
+			host = ""
+			upload := config.Upload{
+				Name:         "a",
+				Mode:         ModeArchive,
+				Target:       "https://example.com:" + port,
+				TrustedCerts: cert(srv),
+				ResolveHost:  "example.com",
+				ResolveAddr:  addr,
+			}
+			require.NoError(t, CheckConfig(ctx, &upload, "test"))
+			require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+			require.Equal(t, "example.com:"+port, host)
+		})
+	}
+}
+
+func TestUploadSchemeFromEnv(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Header().Set("X-TLS", "true")
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	plain := httptest.NewServer(handler)
+	t.Cleanup(plain.Close)
+	secure := httptest.NewTLSServer(handler)
+	t.Cleanup(secure.Close)
+
+	for name, tt := range map[string]struct {
+		scheme, addr string
+		tls          bool
+	}{
+		"http":  {"http", plain.Listener.Addr().String(), false},
+		"https": {"https", secure.Listener.Addr().String(), true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+				Env: []string{"SCHEME=" + tt.scheme, "ADDR=" + tt.addr},
+			})
+			addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")
+			var gotTLS bool
+			require.NoError(t, Upload(ctx, []config.Upload{{
+				Name:         "a",
+				Mode:         ModeArchive,
+				Method:       http.MethodPut,
+				Target:       "{{ .Env.SCHEME }}://{{ .Env.ADDR }}/",
+				TrustedCerts: cert(secure),
+			}}, "test", func(r *http.Response) error {
+				gotTLS = r.Header.Get("X-TLS") == "true" && r.TLS != nil
+				return nil
+			}))
+			require.Equal(t, tt.tls, gotTLS)
+		})
+	}
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			Env: []string{"SCHEME=ftp", "ADDR=" + plain.Listener.Addr().String()},
+		})
+		addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")
+		err := Upload(ctx, []config.Upload{{
+			Name:   "a",
+			Mode:   ModeArchive,
+			Target: "{{ .Env.SCHEME }}://{{ .Env.ADDR }}/",
+		}}, "test", acceptAll)
+		require.EqualError(t, err, `a: test: unsupported target scheme "ftp"`)
+	})
+}
+
+// writeClientCert writes a self-signed client certificate with the given
+// common name and its key, returning their paths.
+func writeClientCert(tb testing.TB, cn string) (string, string) {
+	tb.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(tb, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(tb, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(tb, err)
+
+	dir := tb.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	require.NoError(tb, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(tb, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certPath, keyPath
+}
+
+func TestUploadClientX509ByHost(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string]string{}
+	newServer := func(name string) *httptest.Server {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			got[name] = r.TLS.PeerCertificates[0].Subject.CommonName
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		}))
+		srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	linux := newServer("linux")
+	darwin := newServer("darwin")
+
+	ctx := testctx.Wrap(t.Context())
+	for _, goos := range []string{"linux", "darwin"} {
+		addArtifacts(t, ctx, artifact.UploadableArchive, "a", goos+".tar.gz")[0].Goos = goos
+	}
+
+	linuxCert, linuxKey := writeClientCert(t, "linux-client")
+	darwinCert, darwinKey := writeClientCert(t, "darwin-client")
+	upload := config.Upload{
+		Name:         "a",
+		Mode:         ModeArchive,
+		Method:       http.MethodPut,
+		Target:       `{{ if eq .Os "linux" }}` + linux.URL + `{{ else }}` + darwin.URL + `{{ end }}`,
+		TrustedCerts: cert(linux),
+		ClientX509ByHost: map[string]config.UploadClientX509{
+			linux.Listener.Addr().String():  {Cert: linuxCert, Key: linuxKey},
+			darwin.Listener.Addr().String(): {Cert: darwinCert, Key: darwinKey},
+		},
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	require.Equal(t, map[string]string{
+		"linux":  "linux-client",
+		"darwin": "darwin-client",
+	}, got)
+}
+
+// newClientCA returns a pool with a new CA, to be accepted by servers
+// requiring client certificates.
+func newClientCA(tb testing.TB) *x509.CertPool {
+	tb.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(tb, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Uploads CA", Organization: []string{"GoReleaser"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(tb, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(tb, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return pool
+}
+
+func TestUploadClientX509Rejected(t *testing.T) {
+	pool := newClientCA(t)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz")
+
+	// self-signed, so not issued by the CA the server accepts.
+	clientCert, clientKey := writeClientCert(t, "client")
+	upload := config.Upload{
+		Name:           "a",
+		Mode:           ModeArchive,
+		Method:         http.MethodPut,
+		Target:         srv.URL,
+		TrustedCerts:   cert(srv),
+		ClientX509Cert: clientCert,
+		ClientX509Key:  clientKey,
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll), "the server accepts client certificates from: CN=Uploads CA,O=GoReleaser")
+}
+
+func TestUploadClientX509Unsupported(t *testing.T) {
+	var mu sync.Mutex
+	var peerCerts []int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		peerCerts = append(peerCerts, len(r.TLS.PeerCertificates))
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	// asks for a certificate from a CA the configured one isn't issued by,
+	// but doesn't require it.
+	srv.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: newClientCA(t)}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	var logs bytes.Buffer
+	log.Log = log.New(&logs)
+	t.Cleanup(func() { log.Log = log.New(os.Stderr) })
+
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz")
+
+	clientCert, clientKey := writeClientCert(t, "client")
+	upload := config.Upload{
+		Name:           "a",
+		Mode:           ModeArchive,
+		Method:         http.MethodPut,
+		Target:         srv.URL,
+		TrustedCerts:   cert(srv),
+		ClientX509Cert: clientCert,
+		ClientX509Key:  clientKey,
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []int{0}, peerCerts, "no client certificate should be sent")
+	require.Contains(t, logs.String(), "server does not support the configured client certificate")
+}
+
+func TestClientCertRejected(t *testing.T) {
+	require.True(t, clientCertRejected(errors.New("remote error: tls: certificate required")))
+	require.True(t, clientCertRejected(errors.New("remote error: tls: unknown certificate authority")))
+	require.False(t, clientCertRejected(errors.New("tls: failed to verify certificate")))
+}
+
+func TestClientX509(t *testing.T) {
+	upload := &config.Upload{
+		ClientX509Cert: "default.pem",
+		ClientX509Key:  "default.key",
+		ClientX509ByHost: map[string]config.UploadClientX509{
+			"Example.com":      {Cert: "host.pem", Key: "host.key"},
+			"example.com:8443": {Cert: "port.pem", Key: "port.key"},
+		},
+	}
+	require.Equal(t, "port.pem", clientX509(upload, "example.com:8443").Cert)
+	require.Equal(t, "host.pem", clientX509(upload, "example.com:443").Cert)
+	require.Equal(t, "host.pem", clientX509(upload, "example.com").Cert)
+	require.Equal(t, "default.pem", clientX509(upload, "other.com").Cert)
+}
+
+func TestUploadTimeouts(t *testing.T) {
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz")
+
+	t.Run("connect timeout", func(t *testing.T) {
+		// 10.255.255.1 is not routable, so connecting to it hangs, unless the
+		// network fails right away.
+		upload := config.Upload{
+			Name:           "a",
+			Mode:           ModeArchive,
+			Method:         http.MethodPut,
+			Target:         "http://10.255.255.1:8080/",
+			ConnectTimeout: "100ms",
+		}
+		require.NoError(t, CheckConfig(ctx, &upload, "test"))
+		start := time.Now()
+		require.Error(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+		require.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		done := make(chan struct{})
+		srv := newRecorder(t, func(w http.ResponseWriter, _ *http.Request) {
+			<-done
+			w.WriteHeader(http.StatusCreated)
+		})
+		t.Cleanup(func() { close(done) })
+
+		upload := config.Upload{
+			Name:           "a",
+			Mode:           ModeArchive,
+			Method:         http.MethodPut,
+			Target:         srv.URL,
+			Timeout:        "100ms",
+			ConnectTimeout: "5s",
+		}
+		require.NoError(t, CheckConfig(ctx, &upload, "test"))
+		require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll), "Client.Timeout exceeded")
+	})
+}
+
+// countingListener counts the bytes read from all its connections.
+type countingListener struct {
+	net.Listener
+	read *atomic.Int64
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{Conn: conn, read: l.read}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+func TestUploadExpect100Continue(t *testing.T) {
+	var read atomic.Int64
+	var expect string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the body is not read, so the server doesn't ask for it.
+		expect = r.Header.Get("Expect")
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	srv.Listener = countingListener{Listener: srv.Listener, read: &read}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, strings.Repeat("\x00", 1<<20), "a.tar.gz")
+
+	upload := config.Upload{
+		Name:              "a",
+		Mode:              ModeArchive,
+		Method:            http.MethodPut,
+		Target:            srv.URL,
+		Expect100Continue: true,
+	}
+	require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", func(r *http.Response) error {
+		if r.StatusCode != http.StatusCreated {
+			return errors.New(r.Status)
+		}
+		return nil
+	}), "401 Unauthorized")
+	require.Equal(t, "100-continue", expect)
+	// only the request headers were sent.
+	require.Less(t, read.Load(), int64(1024))
+}
+
+func TestUploadUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "upload.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	ctx := newArchivesCtx(t)
+	upload := config.Upload{
+		Name:       "a",
+		Mode:       ModeArchive,
+		Method:     http.MethodPut,
+		Target:     "http://localhost/artifacts/",
+		UnixSocket: socket,
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	require.ElementsMatch(t, []string{"/artifacts/a.tar.gz", "/artifacts/b.tar.gz"}, paths)
+}
+
+func TestUploadGroups(t *testing.T) {
+	var mu sync.Mutex
+	groups := map[string]map[string]string{}
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		files := map[string]string{}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil || part.FormName() != groupFormField {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			bts, err := io.ReadAll(part)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			files[part.FileName()] = string(bts)
+		}
+		mu.Lock()
+		groups[r.URL.Path] = files
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	ctx := testctx.Wrap(t.Context())
+	for _, a := range []struct{ name, goos string }{
+		{"a_linux_amd64.tar.gz", "linux"},
+		{"a_linux_arm64.tar.gz", "linux"},
+		{"a_darwin_arm64.tar.gz", "darwin"},
+	} {
+		art := addArtifacts(t, ctx, artifact.UploadableArchive, a.name, a.name)[0]
+		art.Goos = a.goos
+		art.Goarch = "amd64"
+	}
+
+	upload := config.Upload{
+		Name:          "a",
+		Mode:          ModeArchive,
+		Method:        http.MethodPost,
+		Target:        srv.URL + "/{{ .Group }}",
+		GroupTemplate: "{{ .Os }}",
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", func(r *http.Response) error {
+		if r.StatusCode != http.StatusCreated {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}))
+
+	require.Equal(t, map[string]map[string]string{
+		"/linux": {
+			"a_linux_amd64.tar.gz": "a_linux_amd64.tar.gz",
+			"a_linux_arm64.tar.gz": "a_linux_arm64.tar.gz",
+		},
+		"/darwin": {
+			"a_darwin_arm64.tar.gz": "a_darwin_arm64.tar.gz",
+		},
+	}, groups)
+
+	t.Run("invalid template", func(t *testing.T) {
+		upload := upload
+		upload.GroupTemplate = "{{ .Os }"
+		require.Error(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	})
+}
+
+func TestUploadCaptureCID(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"cid":"bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"}}`))
+	})
+
+	ctx := testctx.Wrap(t.Context())
+	art := addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")[0]
+
+	upload := config.Upload{
+		Name:               "a",
+		Mode:               ModeArchive,
+		Target:             srv.URL,
+		CaptureCIDJSONPath: "$.data.cid",
+	}
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	require.Equal(t, "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi", art.Extra[artifact.ExtraCID])
+
+	upload.CaptureCIDJSONPath = "$.data.nope"
+	require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll), "failed to capture CID")
+}
+
+func TestUploadCaptureHeaders(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("ETag", `"abc123"`)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	ctx := testctx.Wrap(t.Context())
+	art := addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")[0]
+
+	upload := config.Upload{
+		Name:           "a",
+		Mode:           ModeArchive,
+		Method:         http.MethodPut,
+		Target:         srv.URL,
+		CaptureHeaders: []string{"ETag", "X-Checksum-Sha256"},
+	}
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	require.Equal(t, `"abc123"`, art.Extra["UploadHeader.ETag"])
+	require.NotContains(t, art.Extra, "UploadHeader.X-Checksum-Sha256")
+}
+
+func TestJSONPathString(t *testing.T) {
+	for name, tt := range map[string]struct {
+		body, path, cid, err string
+	}{
+		"top level":   {`{"Hash":"Qm1"}`, "Hash", "Qm1", ""},
+		"nested":      {`{"a":{"b":"Qm1"}}`, "$.a.b", "Qm1", ""},
+		"missing":     {`{"a":{}}`, "a.b", "", "a.b: not found in response"},
+		"not object":  {`{"a":"b"}`, "a.b", "", "a.b: not found in response"},
+		"not string":  {`{"a":1}`, "a", "", "a: not a string"},
+		"invalid":     {`nope`, "a", "", "invalid json response"},
+		"empty value": {`{"a":""}`, "a", "", "a: not a string"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cid, err := jsonPathString(strings.NewReader(tt.body), tt.path)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.cid, cid)
+		})
+	}
+}
+
+// newSFTPServer starts an SFTP server accepting the given user and password,
+// and returns its address and a known hosts file for it.
+func newSFTPServer(tb testing.TB, user, password string) (string, string) {
+	tb.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(tb, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(tb, err)
+
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == user && string(pass) == password {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	cfg.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(tb, err)
+	tb.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, cfg)
+		}
+	}()
+
+	knownHosts := filepath.Join(tb.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(ln.Addr().String())}, signer.PublicKey())
+	require.NoError(tb, os.WriteFile(knownHosts, []byte(line+"\n"), 0o600))
+	return ln.Addr().String(), knownHosts
+}
+
+func serveSFTP(conn net.Conn, cfg *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for ch := range chans {
+		if ch.ChannelType() != "session" {
+			_ = ch.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := ch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+			}
+		}()
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			return
+		}
+		_ = server.Serve()
+		_ = server.Close()
+	}
+}
+
+func TestUploadSFTP(t *testing.T) {
+	addr, knownHosts := newSFTPServer(t, "user", "pass")
+
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		Env: []string{"TEST_A_SECRET=pass"},
+	}, testctx.WithVersion("2.1.0"))
+	addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")
+
+	dir := t.TempDir()
+	upload := config.Upload{
+		Name:          "a",
+		Mode:          ModeArchive,
+		Target:        "sftp://" + addr + filepath.ToSlash(dir) + "/{{ .Version }}",
+		Username:      "user",
+		SSHKnownHosts: knownHosts,
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+
+	bts, err := os.ReadFile(filepath.Join(dir, "2.1.0", "a.tar.gz"))
+	require.NoError(t, err)
+	require.Equal(t, "blah!", string(bts))
+
+	t.Run("wrong password", func(t *testing.T) {
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			Env: []string{"TEST_A_SECRET=nope"},
+		}, testctx.WithVersion("2.1.0"))
+		addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")
+		require.Error(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	})
+
+	t.Run("unknown host", func(t *testing.T) {
+		upload := upload
+		upload.SSHKnownHosts = filepath.Join(t.TempDir(), "known_hosts")
+		require.NoError(t, os.WriteFile(upload.SSHKnownHosts, nil, 0o600))
+		require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll), "knownhosts")
+	})
+}
+
+func TestValidate(t *testing.T) {
+	ctx := testctx.Wrap(t.Context())
+
+	t.Run("valid", func(t *testing.T) {
+		require.NoError(t, Validate(ctx, []config.Upload{{
+			Name:          "a",
+			Target:        "https://example.com/{{ .ProjectName }}/{{ .Os }}/{{ .HashFanout }}/{{ .SHA256 }}",
+			HashFanout:    2,
+			Username:      "{{ .Env.UPLOAD_USER }}",
+			Password:      "{{ .Env.UPLOAD_PASSWORD }}",
+			Skip:          "{{ gt .Patch 0 }}",
+			NameTemplate:  "{{ tolower .ArtifactName }}",
+			GroupTemplate: "{{ .Os }}",
+			CustomHeaders: map[string]string{
+				"JOB-TOKEN": "{{ .Env.CI_JOB_TOKEN }}",
+			},
+			JSONEnvelope: map[string]string{
+				"name": "{{ .ArtifactName }}",
+			},
+		}}))
+	})
+
+	for name, upload := range map[string]config.Upload{
+		"target":               {Target: "{{ .ProjectName }"},
+		"username":             {Username: "{{ .Nope }}"},
+		"password":             {Password: "{{ .Env.FOO | nope }}"},
+		"skip":                 {Skip: "{{ .Skip }"},
+		"custom_headers":       {CustomHeaders: map[string]string{"x-custom-header-name": "{{ .Env.NONEXISTINGVARIABLE and some bad expressions }}"}},
+		"name_template":        {NameTemplate: "{{ .ArtifactName }"},
+		"group_template":       {GroupTemplate: "{{ .Os }"},
+		"json_envelope":        {JSONEnvelope: map[string]string{"name": "{{ .Name }"}},
+		"raw_request_template": {RawRequestTemplate: "PUT https://example.com/{{ .Nope }}\n\n{{ .Body }}"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			upload.Name = "a"
+			err := Validate(ctx, []config.Upload{upload})
+			testlib.RequireTemplateError(t, err)
+			require.ErrorContains(t, err, "a: invalid "+name)
+		})
+	}
+}
+
+func TestUploadOAuth2SharedToken(t *testing.T) {
+	var fetches atomic.Int32
+	tokenSrv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"tok","token_type":"bearer","expires_in":3600}`))
+	})
+
+	srv := newRecorder(t, nil)
+	auths := func() []string {
+		var auths []string
+		for _, r := range srv.requests {
+			auths = append(auths, r.Header.Values("Authorization")...)
+		}
+		return auths
+	}
+
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		Env: []string{"CLIENT_SECRET=secret"},
+	})
+	addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")
+
+	oauth2 := config.UploadOAuth2{
+		TokenURL:     tokenSrv.URL,
+		ClientID:     "id",
+		ClientSecret: "{{ .Env.CLIENT_SECRET }}",
+	}
+	uploads := []config.Upload{
+		{Name: "a", Mode: ModeArchive, Target: srv.URL + "/a", OAuth2: oauth2},
+		{Name: "b", Mode: ModeArchive, Target: srv.URL + "/b", OAuth2: oauth2},
+	}
+	for i := range uploads {
+		require.NoError(t, CheckConfig(ctx, &uploads[i], "test"))
+	}
+	require.NoError(t, Upload(ctx, uploads, "test", acceptAll))
+
+	require.Equal(t, int32(1), fetches.Load())
+	require.Equal(t, []string{"Bearer tok", "Bearer tok"}, auths())
+
+	t.Run("with username and password", func(t *testing.T) {
+		srv.reset()
+		upload := config.Upload{
+			Name:     "a",
+			Mode:     ModeArchive,
+			Target:   srv.URL + "/a",
+			Username: "user",
+			Password: "pass",
+			OAuth2:   oauth2,
+		}
+		require.NoError(t, CheckConfig(ctx, &upload, "test"))
+		require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+		require.Equal(t, []string{"Bearer tok"}, auths())
+	})
+}
+
+func TestUploadCompress(t *testing.T) {
+	srv := newRecorder(t, nil)
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz", "a.txt")
+
+	uploads := []config.Upload{{
+		Name:     "a",
+		Target:   srv.URL,
+		Compress: true,
+	}}
+	require.NoError(t, Defaults(uploads))
+	require.Equal(t, compressSkipExtsDefault, uploads[0].CompressSkipExts)
+	require.NoError(t, CheckConfig(ctx, &uploads[0], "test"))
+	require.NoError(t, Upload(ctx, uploads, "test", acceptAll))
+
+	encodings := map[string]string{}
+	bodies := map[string]string{}
+	for i, r := range srv.requests {
+		var body io.Reader = strings.NewReader(srv.bodies[i])
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(body)
+			require.NoError(t, err)
+			body = gz
+		}
+		bts, err := io.ReadAll(body)
+		require.NoError(t, err)
+		encodings[r.URL.Path] = r.Header.Get("Content-Encoding")
+		bodies[r.URL.Path] = string(bts)
+	}
+	require.Equal(t, map[string]string{
+		"/a.tar.gz": "",
+		"/a.txt":    "gzip",
+	}, encodings)
+	require.Equal(t, map[string]string{
+		"/a.tar.gz": "blah!",
+		"/a.txt":    "blah!",
+	}, bodies)
+}
+
+func TestUploadCompressBrotli(t *testing.T) {
+	srv := newRecorder(t, nil)
+	content := strings.Repeat("blah!", 1000)
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, content, "a.txt")
+
+	uploads := []config.Upload{{
+		Name:           "a",
+		Target:         srv.URL,
+		Compress:       true,
+		CompressAlgo:   CompressAlgoBrotli,
+		ChecksumHeader: "X-SHA256",
+	}}
+	require.NoError(t, Defaults(uploads))
+	require.NoError(t, CheckConfig(ctx, &uploads[0], "test"))
+	require.NoError(t, Upload(ctx, uploads, "test", acceptAll))
+
+	r := srv.last()
+	body, err := io.ReadAll(brotli.NewReader(strings.NewReader(srv.files()["/a.txt"])))
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte(content))
+	require.Equal(t, "br", r.Header.Get("Content-Encoding"))
+	require.Equal(t, content, string(body))
+	// the checksum is always the one of the uncompressed file.
+	require.Equal(t, hex.EncodeToString(sum[:]), r.Header.Get("X-SHA256"))
+}
+
+func TestUploadForm(t *testing.T) {
+	var mu sync.Mutex
+	fields := map[string]string{}
+	var filename, content string
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			bts, err := io.ReadAll(part)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if part.FormName() == formFileField {
+				filename = part.FileName()
+				content = string(bts)
+				continue
+			}
+			fields[part.FormName()] = string(bts)
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	ctx := testctx.Wrap(t.Context(), testctx.WithVersion("1.2.3"))
+	addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")
+
+	upload := config.Upload{
+		Name:     "a",
+		Mode:     ModeArchive,
+		Target:   srv.URL,
+		BodyMode: BodyModeForm,
+		FormFields: map[string]string{
+			"version": "{{ .Version }}",
+		},
+		FormChecksumField: "sha256",
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+
+	mu.Lock()
+	defer mu.Unlock()
+	sum := sha256.Sum256([]byte("blah!"))
+	require.Equal(t, map[string]string{
+		"version": "1.2.3",
+		"sha256":  hex.EncodeToString(sum[:]),
+	}, fields)
+	require.Equal(t, "a.tar.gz", filename)
+	require.Equal(t, "blah!", content)
+}
+
+// newVerifyServer starts a server storing the uploaded files, and serving
+// them back with the given corruption applied.
+func newVerifyServer(tb testing.TB, corrupt func([]byte) []byte) (*recorder, func() []string) {
+	tb.Helper()
+	var mu sync.Mutex
+	files := map[string][]byte{}
+	var ranges []string
+	srv := newRecorder(tb, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			bts, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			files[r.URL.Path] = bts
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet, http.MethodHead:
+			ranges = append(ranges, r.Header.Get("Range"))
+			bts, ok := files[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(corrupt(bts)))
+		}
+	})
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return ranges
+	}
+}
+
+func TestUploadVerify(t *testing.T) {
+	data := make([]byte, 5*verifySampleSize+7)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	newCtx := func(t *testing.T) *context.Context {
+		t.Helper()
+		ctx := testctx.Wrap(t.Context())
+		addArtifacts(t, ctx, artifact.UploadableArchive, string(data), "a.tar.gz")
+		return ctx
+	}
+	noop := func(b []byte) []byte { return b }
+	flip := func(b []byte) []byte {
+		b = bytes.Clone(b)
+		b[len(b)-1]++
+		return b
+	}
+	upload := func(srv *recorder, mode string) config.Upload {
+		return config.Upload{
+			Name:              "a",
+			Mode:              ModeArchive,
+			Method:            http.MethodPut,
+			Target:            srv.URL,
+			VerifyAfterUpload: true,
+			VerifyMode:        mode,
+		}
+	}
+
+	t.Run("full", func(t *testing.T) {
+		srv, ranges := newVerifyServer(t, noop)
+		ctx := newCtx(t)
+		u := upload(srv, VerifyModeFull)
+		require.NoError(t, CheckConfig(ctx, &u, "test"))
+		require.NoError(t, Upload(ctx, []config.Upload{u}, "test", acceptAll))
+		require.Equal(t, []string{""}, ranges())
+	})
+
+	t.Run("full mismatch", func(t *testing.T) {
+		srv, _ := newVerifyServer(t, flip)
+		ctx := newCtx(t)
+		err := Upload(ctx, []config.Upload{upload(srv, VerifyModeFull)}, "test", acceptAll)
+		require.ErrorContains(t, err, "checksum mismatch")
+	})
+
+	t.Run("sample", func(t *testing.T) {
+		srv, ranges := newVerifyServer(t, noop)
+		ctx := newCtx(t)
+		u := upload(srv, VerifyModeSample)
+		require.NoError(t, CheckConfig(ctx, &u, "test"))
+		require.NoError(t, Upload(ctx, []config.Upload{u}, "test", acceptAll))
+		size := int64(len(data))
+		mid := size/2 - verifySampleSize/2
+		require.Equal(t, []string{
+			"bytes=0-65535",
+			fmt.Sprintf("bytes=%d-%d", mid, mid+verifySampleSize-1),
+			fmt.Sprintf("bytes=%d-%d", size-verifySampleSize, size-1),
+		}, ranges())
+	})
+
+	t.Run("sample mismatch", func(t *testing.T) {
+		srv, _ := newVerifyServer(t, flip)
+		ctx := newCtx(t)
+		err := Upload(ctx, []config.Upload{upload(srv, VerifyModeSample)}, "test", acceptAll)
+		require.ErrorContains(t, err, "contents mismatch")
+	})
+
+	t.Run("sample size mismatch", func(t *testing.T) {
+		srv, _ := newVerifyServer(t, func(b []byte) []byte { return append(bytes.Clone(b), 0) })
+		ctx := newCtx(t)
+		err := Upload(ctx, []config.Upload{upload(srv, VerifyModeSample)}, "test", acceptAll)
+		require.ErrorContains(t, err, "size mismatch")
+	})
+
+	t.Run("size", func(t *testing.T) {
+		srv, _ := newVerifyServer(t, noop)
+		ctx := newCtx(t)
+		u := upload(srv, "")
+		u.VerifyAfterUpload = false
+		u.VerifySize = true
+		require.NoError(t, CheckConfig(ctx, &u, "test"))
+		require.NoError(t, Upload(ctx, []config.Upload{u}, "test", acceptAll))
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		srv, _ := newVerifyServer(t, func(b []byte) []byte { return b[:len(b)-1] })
+		ctx := newCtx(t)
+		u := upload(srv, "")
+		u.VerifyAfterUpload = false
+		u.VerifySize = true
+		err := Upload(ctx, []config.Upload{u}, "test", acceptAll)
+		require.ErrorContains(t, err, fmt.Sprintf("verify size failed: size mismatch: expected %d, got %d", len(data), len(data)-1))
+	})
+}
+
+func TestUploadVerifyAcceptGzip(t *testing.T) {
+	var mu sync.Mutex
+	files := map[string][]byte{}
+	var gzipped int
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			bts, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			files[r.URL.Path] = bts
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			if r.Header.Get("Accept-Encoding") != "gzip" {
+				_, _ = w.Write(files[r.URL.Path])
+				return
+			}
+			gzipped++
+			w.Header().Set("Content-Encoding", "gzip")
+			gw := gzip.NewWriter(w)
+			_, _ = gw.Write(files[r.URL.Path])
+			_ = gw.Close()
+		}
+	})
+
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, strings.Repeat("compressible ", 1024), "a.txt")
+	upload := config.Upload{
+		Name:              "a",
+		Mode:              ModeArchive,
+		Method:            http.MethodPut,
+		Target:            srv.URL,
+		VerifyAfterUpload: true,
+		VerifyAcceptGzip:  true,
+	}
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	require.Equal(t, 1, gzipped)
+}
+
+func TestSampleRanges(t *testing.T) {
+	require.Equal(t, []byteRange{{0, 9}}, sampleRanges(10))
+	require.Equal(t, []byteRange{{0, 3*verifySampleSize - 1}}, sampleRanges(3*verifySampleSize))
+	require.Equal(t, []byteRange{
+		{0, verifySampleSize - 1},
+		{verifySampleSize * 3 / 2, verifySampleSize*5/2 - 1},
+		{3 * verifySampleSize, 4*verifySampleSize - 1},
+	}, sampleRanges(4*verifySampleSize))
+}
+
+const multistatusTemplate = `<?xml version="1.0" encoding="utf-8"?>
+<D:multistatus xmlns:D="DAV:">
+  <D:response>
+    <D:href>%s</D:href>
+    <D:propstat>
+      <D:prop><D:resourcetype/></D:prop>
+      <D:status>HTTP/1.1 %s</D:status>
+    </D:propstat>
+  </D:response>
+</D:multistatus>`
+
+func TestUploadSkipExisting(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			if r.URL.Path == "/a.tar.gz" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		case http.MethodPut:
+			w.WriteHeader(http.StatusCreated)
+		}
+	})
+
+	ctx := newArchivesCtx(t)
+	upload := config.Upload{
+		Name:         "a",
+		Mode:         ModeArchive,
+		Method:       http.MethodPut,
+		Target:       srv.URL,
+		SkipExisting: true,
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	require.Equal(t, []string{"/b.tar.gz"}, srv.paths(http.MethodPut))
+}
+
+func TestUploadSkipExistingPropfind(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case ExistsMethodPropfind:
+			if r.Header.Get("Depth") != "0" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if _, err := io.ReadAll(r.Body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			status := "404 Not Found"
+			if r.URL.Path == "/a.tar.gz" {
+				status = "200 OK"
+			}
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			w.WriteHeader(http.StatusMultiStatus)
+			_, _ = fmt.Fprintf(w, multistatusTemplate, r.URL.Path, status)
+		case http.MethodPut:
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	ctx := newArchivesCtx(t)
+	upload := config.Upload{
+		Name:         "a",
+		Mode:         ModeArchive,
+		Method:       http.MethodPut,
+		Target:       srv.URL,
+		SkipExisting: true,
+		ExistsMethod: ExistsMethodPropfind,
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	require.Equal(t, []string{"/b.tar.gz"}, srv.paths(http.MethodPut))
+}
+
+func TestUploadDeltaFrom(t *testing.T) {
+	manifest := strings.Join([]string{
+		deltaSum + "  a.tar.gz",
+		strings.Repeat("0", 64) + "  b.tar.gz",
+		"",
+	}, "\n")
+
+	t.Run("path", func(t *testing.T) {
+		srv := newDeltaServer(t, "")
+		path := filepath.Join(t.TempDir(), "checksums.txt")
+		require.NoError(t, os.WriteFile(path, []byte(manifest), 0o644))
+
+		ctx := newArchivesCtx(t)
+		upload := config.Upload{
+			Name:      "a",
+			Mode:      ModeArchive,
+			Method:    http.MethodPut,
+			Target:    srv.URL,
+			DeltaFrom: path,
+		}
+		require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+		require.Equal(t, []string{"/b.tar.gz"}, srv.paths(http.MethodPut))
+	})
+
+	t.Run("url", func(t *testing.T) {
+		srv := newDeltaServer(t, manifest)
+		ctx := newArchivesCtx(t)
+		upload := config.Upload{
+			Name:      "a",
+			Mode:      ModeArchive,
+			Method:    http.MethodPut,
+			Target:    srv.URL,
+			DeltaFrom: srv.URL + "/checksums.txt",
+		}
+		require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+		require.Equal(t, []string{"/b.tar.gz"}, srv.paths(http.MethodPut))
+	})
+
+	t.Run("url not found", func(t *testing.T) {
+		srv := newDeltaServer(t, "")
+		ctx := newArchivesCtx(t)
+		upload := config.Upload{
+			Name:      "a",
+			Mode:      ModeArchive,
+			Method:    http.MethodPut,
+			Target:    srv.URL,
+			DeltaFrom: srv.URL + "/checksums.txt",
+		}
+		require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+		require.Equal(t, []string{"/a.tar.gz", "/b.tar.gz"}, srv.paths(http.MethodPut))
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		ctx := newArchivesCtx(t)
+		upload := config.Upload{
+			Name:      "a",
+			Mode:      ModeArchive,
+			Method:    http.MethodPut,
+			Target:    "http://localhost",
+			DeltaFrom: filepath.Join(t.TempDir(), "nope.txt"),
+		}
+		require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll), "could not load delta_from manifest")
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		ctx := testctx.Wrap(t.Context())
+		upload := config.Upload{
+			Name:      "a",
+			Mode:      ModeArchive,
+			Target:    "http://localhost",
+			DeltaFrom: "{{ .Nope }",
+		}
+		require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll), "could not load delta_from manifest")
+	})
+}
+
+func TestParseDeltaManifest(t *testing.T) {
+	sums, err := parseDeltaManifest(strings.NewReader("ABC  a.tar.gz\n\ndef *b.zip\n"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"a.tar.gz": "abc", "b.zip": "def"}, sums)
+
+	_, err = parseDeltaManifest(strings.NewReader("abc\n"))
+	require.ErrorContains(t, err, "invalid line")
+}
+
+func TestRetryJitter(t *testing.T) {
+	const d = 10 * time.Second
+
+	t.Run("none", func(t *testing.T) {
+		require.Nil(t, retryJitter(""))
+		require.Nil(t, retryJitter(RetryJitterNone))
+	})
+
+	t.Run("full", func(t *testing.T) {
+		jitter := retryJitter(RetryJitterFull)
+		for range 1000 {
+			got := jitter(d)
+			require.GreaterOrEqual(t, got, time.Duration(0))
+			require.LessOrEqual(t, got, d)
+		}
+		require.Zero(t, jitter(0))
+	})
+
+	t.Run("equal", func(t *testing.T) {
+		jitter := retryJitter(RetryJitterEqual)
+		for range 1000 {
+			got := jitter(d)
+			require.GreaterOrEqual(t, got, d/2)
+			require.LessOrEqual(t, got, d)
+		}
+		require.Zero(t, jitter(0))
+	})
+}
+
+// rangeServer assembles the ranges it receives, and keeps the first range
+// waiting until all the others arrived, so they are always out of order.
+type rangeServer struct {
+	ranges int
+	others chan struct{}
+
+	mu        sync.Mutex
+	data      []byte
+	received  []int64
+	finalized string
+	plain     int
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bts, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	cr := r.Header.Get("Content-Range")
+	switch {
+	case r.Method == http.MethodPost:
+		s.mu.Lock()
+		s.finalized = cr
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		return
+	case cr == "":
+		s.mu.Lock()
+		s.plain++
+		s.data = bts
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	var start, end, size int64
+	if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &size); err != nil || end-start+1 != int64(len(bts)) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if start == 0 {
+		for range s.ranges - 1 {
+			<-s.others
+		}
+	} else {
+		defer func() { s.others <- struct{}{} }()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		s.data = make([]byte, size)
+	}
+	copy(s.data[start:], bts)
+	s.received = append(s.received, start)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func TestUploadRanges(t *testing.T) {
+	content := make([]byte, 4500)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	newCtx := func(t *testing.T) *context.Context {
+		t.Helper()
+		ctx := testctx.Wrap(t.Context())
+		addArtifacts(t, ctx, artifact.UploadableArchive, string(content), "a.tar.gz")
+		return ctx
+	}
+
+	t.Run("out of order", func(t *testing.T) {
+		s := &rangeServer{ranges: 5, others: make(chan struct{})}
+		srv := httptest.NewServer(s)
+		t.Cleanup(srv.Close)
+
+		ctx := newCtx(t)
+		uploads := []config.Upload{{
+			Name:             "a",
+			Mode:             ModeArchive,
+			Target:           srv.URL,
+			RangeChunkSize:   "1KB",
+			RangeParallelism: 5,
+		}}
+		require.NoError(t, Defaults(uploads))
+		require.NoError(t, CheckConfig(ctx, &uploads[0], "test"))
+		require.NoError(t, Upload(ctx, uploads, "test", acceptAll))
+
+		require.Len(t, s.received, 5)
+		require.NotEqual(t, int64(0), s.received[0])
+		require.True(t, bytes.Equal(content, s.data))
+		require.Equal(t, "bytes */4500", s.finalized)
+		require.Zero(t, s.plain)
+	})
+
+	t.Run("smaller than a range", func(t *testing.T) {
+		s := &rangeServer{}
+		srv := httptest.NewServer(s)
+		t.Cleanup(srv.Close)
+
+		ctx := newCtx(t)
+		uploads := []config.Upload{{
+			Name:           "a",
+			Mode:           ModeArchive,
+			Target:         srv.URL,
+			RangeChunkSize: "1MB",
+		}}
+		require.NoError(t, Defaults(uploads))
+		require.NoError(t, Upload(ctx, uploads, "test", acceptAll))
+
+		require.Equal(t, 1, s.plain)
+		require.Empty(t, s.finalized)
+		require.True(t, bytes.Equal(content, s.data))
+	})
+
+	t.Run("chunk checksum", func(t *testing.T) {
+		var mu sync.Mutex
+		sums := map[string]string{}
+		srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+			bts, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			defer mu.Unlock()
+			if r.Method == http.MethodPut {
+				sum := sha256.Sum256(bts)
+				if r.Header.Get("X-Sum") != hex.EncodeToString(sum[:]) {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				sums[r.Header.Get("Content-Range")] = r.Header.Get("X-Sum")
+			}
+			w.WriteHeader(http.StatusCreated)
+		})
+
+		ctx := newCtx(t)
+		uploads := []config.Upload{{
+			Name:           "a",
+			Mode:           ModeArchive,
+			Method:         http.MethodPut,
+			Target:         srv.URL,
+			RangeChunkSize: "2KB",
+			ChecksumHeader: "X-Sum",
+			ChunkChecksum:  true,
+		}}
+		require.NoError(t, Defaults(uploads))
+		require.NoError(t, CheckConfig(ctx, &uploads[0], "test"))
+		require.NoError(t, Upload(ctx, uploads, "test", func(r *http.Response) error {
+			if r.StatusCode >= 300 {
+				return errors.New(r.Status)
+			}
+			return nil
+		}))
+
+		expected := map[string]string{}
+		for _, r := range [][2]int{{0, 2000}, {2000, 4000}, {4000, 4500}} {
+			sum := sha256.Sum256(content[r[0]:r[1]])
+			expected[fmt.Sprintf("bytes %d-%d/4500", r[0], r[1]-1)] = hex.EncodeToString(sum[:])
+		}
+		require.Equal(t, expected, sums)
+	})
+}
+
+func TestUploadSidecarTemplate(t *testing.T) {
+	srv := newRecorder(t, nil)
+
+	newCtx := func(t *testing.T) *context.Context {
+		t.Helper()
+		ctx := testctx.Wrap(t.Context(), testctx.WithVersion("1.2.3"))
+		a := addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")[0]
+		a.Goos = "linux"
+		a.Goarch = "amd64"
+		return ctx
+	}
+
+	t.Run("default ext", func(t *testing.T) {
+		srv.reset()
+		uploads := []config.Upload{{
+			Name:            "a",
+			Mode:            ModeArchive,
+			Target:          srv.URL + "/{{ .Version }}/",
+			SidecarTemplate: `{"name":"{{ .ArtifactName }}","os":"{{ .Os }}","arch":"{{ .Arch }}"}`,
+		}}
+		require.NoError(t, Defaults(uploads))
+		require.NoError(t, Upload(newCtx(t), uploads, "test", acceptAll))
+		require.Equal(t, map[string]string{
+			"/1.2.3/a.tar.gz":      "blah!",
+			"/1.2.3/a.tar.gz.json": `{"name":"a.tar.gz","os":"linux","arch":"amd64"}`,
+		}, srv.files())
+	})
+
+	t.Run("custom ext", func(t *testing.T) {
+		srv.reset()
+		uploads := []config.Upload{{
+			Name:            "a",
+			Mode:            ModeArchive,
+			Target:          srv.URL,
+			SidecarTemplate: `{"version":"{{ .Version }}"}`,
+			SidecarExt:      "meta.json",
+		}}
+		require.NoError(t, Defaults(uploads))
+		require.NoError(t, Upload(newCtx(t), uploads, "test", acceptAll))
+		require.Equal(t, `{"version":"1.2.3"}`, srv.files()["/a.tar.gz.meta.json"])
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		uploads := []config.Upload{{
+			Name:            "a",
+			Mode:            ModeArchive,
+			Target:          srv.URL,
+			SidecarTemplate: `{"name":{{ .ArtifactName }}}`,
+		}}
+		require.NoError(t, Defaults(uploads))
+		require.ErrorContains(t, Upload(newCtx(t), uploads, "test", acceptAll), "sidecar_template for a.tar.gz is not valid JSON")
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		uploads := []config.Upload{{
+			Name:            "a",
+			Mode:            ModeArchive,
+			Target:          srv.URL,
+			SidecarTemplate: `{{ .Nope }`,
+		}}
+		require.NoError(t, Defaults(uploads))
+		require.ErrorContains(t, Upload(newCtx(t), uploads, "test", acceptAll), "failed to resolve sidecar_template")
+	})
+}
+
+func TestUploadFailureThreshold(t *testing.T) {
+	var calls atomic.Int32
+	srv := newRecorder(t, func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	ctx := testctx.Wrap(t.Context())
+	ctx.Parallelism = 1
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "0.tar.gz", "1.tar.gz", "2.tar.gz", "3.tar.gz", "4.tar.gz")
+
+	check := func(r *http.Response) error {
+		if r.StatusCode/100 != 2 {
+			return fmt.Errorf("unexpected status %s", r.Status)
+		}
+		return nil
+	}
+
+	upload := config.Upload{
+		Name:             "a",
+		Mode:             ModeArchive,
+		Method:           http.MethodPut,
+		Target:           srv.URL,
+		FailureThreshold: 2,
+		ContinueOnError:  true,
+	}
+	err := Upload(ctx, []config.Upload{upload}, "test", check)
+	require.True(t, pipe.IsSkip(err), err)
+	require.Equal(t, int32(2), calls.Load())
+
+	t.Run("disabled", func(t *testing.T) {
+		calls.Store(0)
+		upload := upload
+		upload.FailureThreshold = 0
+		err := Upload(ctx, []config.Upload{upload}, "test", check)
+		require.True(t, pipe.IsSkip(err), err)
+		require.Equal(t, int32(5), calls.Load())
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		calls.Store(0)
+		upload := upload
+		upload.ContinueOnError = false
+		upload.FailureThreshold = 1
+		require.Error(t, Upload(ctx, []config.Upload{upload}, "test", check))
+		require.Equal(t, int32(1), calls.Load())
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker()
+	upload := &config.Upload{FailureThreshold: 2}
+	require.NoError(t, b.allow(upload, "https://example.com/a"))
+	b.record(upload, "https://example.com/a", fmt.Errorf("fail"))
+	b.record(upload, "https://example.com/b", nil)
+	b.record(upload, "https://example.com/c", fmt.Errorf("fail"))
+	require.NoError(t, b.allow(upload, "https://example.com/d"))
+	b.record(upload, "https://example.com/d", fmt.Errorf("fail"))
+	require.EqualError(t, b.allow(upload, "https://EXAMPLE.com/e"), "giving up on example.com after 2 consecutive failures")
+	require.NoError(t, b.allow(upload, "https://other.example.com/e"))
+}
+
+func TestUploadMirrors(t *testing.T) {
+	primary := newRecorder(t, nil)
+	mirror := newRecorder(t, nil)
+	bodies := func() map[string]string {
+		bodies := map[string]string{}
+		for name, srv := range map[string]*recorder{"primary": primary, "mirror": mirror} {
+			for path, body := range srv.files() {
+				bodies[name+path] = body
+			}
+		}
+		return bodies
+	}
+	reset := func() {
+		primary.reset()
+		mirror.reset()
+	}
+	broken := newRecorder(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	ctx := testctx.Wrap(t.Context(), testctx.WithVersion("1.2.3"))
+	addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")
+	check := func(r *http.Response) error {
+		if r.StatusCode/100 != 2 {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+
+	upload := config.Upload{
+		Name:    "a",
+		Mode:    ModeArchive,
+		Method:  http.MethodPut,
+		Target:  primary.URL + "/{{ .Version }}/",
+		Mirrors: []string{mirror.URL + "/mirror/{{ .Version }}/"},
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", check))
+	require.Equal(t, map[string]string{
+		"primary/1.2.3/a.tar.gz":       "blah!",
+		"mirror/mirror/1.2.3/a.tar.gz": "blah!",
+	}, bodies())
+
+	t.Run("failed mirror", func(t *testing.T) {
+		upload := upload
+		upload.Mirrors = []string{broken.URL, mirror.URL}
+		require.Error(t, Upload(ctx, []config.Upload{upload}, "test", check))
+	})
+
+	t.Run("failed mirror best effort", func(t *testing.T) {
+		reset()
+		upload := upload
+		upload.Mirrors = []string{broken.URL, mirror.URL}
+		upload.MirrorBestEffort = true
+		require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", check))
+		require.Equal(t, map[string]string{
+			"primary/1.2.3/a.tar.gz": "blah!",
+			"mirror/a.tar.gz":        "blah!",
+		}, bodies())
+	})
+
+	t.Run("failed target best effort", func(t *testing.T) {
+		upload := upload
+		upload.Target = broken.URL
+		upload.MirrorBestEffort = true
+		require.Error(t, Upload(ctx, []config.Upload{upload}, "test", check))
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		reset()
+		upload := upload
+		upload.Target = broken.URL
+		upload.Mirrors = nil
+		upload.FallbackTarget = mirror.URL + "/fallback/{{ .Version }}/"
+		require.NoError(t, CheckConfig(ctx, &upload, "test"))
+		require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", check))
+		require.Equal(t, map[string]string{
+			"mirror/fallback/1.2.3/a.tar.gz": "blah!",
+		}, bodies())
+	})
+
+	t.Run("fallback not needed", func(t *testing.T) {
+		reset()
+		upload := upload
+		upload.Mirrors = nil
+		upload.FallbackTarget = mirror.URL + "/fallback/{{ .Version }}/"
+		require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", check))
+		require.Equal(t, map[string]string{
+			"primary/1.2.3/a.tar.gz": "blah!",
+		}, bodies())
+	})
+
+	t.Run("failed fallback", func(t *testing.T) {
+		upload := upload
+		upload.Target = broken.URL
+		upload.Mirrors = nil
+		upload.FallbackTarget = broken.URL + "/fallback/"
+		require.Error(t, Upload(ctx, []config.Upload{upload}, "test", check))
+	})
+
+	t.Run("checksum template", func(t *testing.T) {
+		upload := upload
+		upload.Mirrors = []string{"https://mirror.example.com/{{ .SHA256 }}"}
+		require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	})
+
+	// the mirrors are only rendered to check their hosts.
+	allowed := testctx.WrapWithCfg(t.Context(), config.Project{
+		UploadsAllowedHosts: []string{"mirror.example.com"},
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		upload := upload
+		upload.Target = "https://mirror.example.com/"
+		upload.Mirrors = []string{"{{ .Nope }"}
+		require.ErrorContains(t, CheckConfig(allowed, &upload, "test"), "error while building mirrors.0 URL")
+	})
+
+	t.Run("invalid fallback template", func(t *testing.T) {
+		upload := upload
+		upload.Target = "https://mirror.example.com/"
+		upload.Mirrors = nil
+		upload.FallbackTarget = "{{ .Nope }"
+		require.ErrorContains(t, CheckConfig(allowed, &upload, "test"), "error while building fallback_target URL")
+	})
+
+	t.Run("fallback checksum template", func(t *testing.T) {
+		upload := upload
+		upload.Mirrors = nil
+		upload.FallbackTarget = "https://mirror.example.com/{{ .HashFanout }}/{{ .SHA256 }}"
+		require.NoError(t, CheckConfig(ctx, &upload, "test"))
+
+		upload.Target = "https://mirror.example.com/"
+		require.NoError(t, CheckConfig(allowed, &upload, "test"))
+	})
+
+	t.Run("fallback host not allowed", func(t *testing.T) {
+		upload := upload
+		upload.Target = "https://mirror.example.com/"
+		upload.Mirrors = nil
+		upload.FallbackTarget = "https://prod.example.com/{{ .SHA256 }}"
+		err := CheckConfig(allowed, &upload, "test")
+		require.False(t, pipe.IsSkip(err), err)
+		require.ErrorContains(t, err, `host "prod.example.com" is not in uploads_allowed_hosts`)
+	})
+
+	t.Run("allowed host", func(t *testing.T) {
+		upload := upload
+		upload.Target = "https://mirror.example.com/"
+		upload.Mirrors = []string{"https://mirror.example.com/{{ .SHA256 }}"}
+		require.NoError(t, CheckConfig(allowed, &upload, "test"))
+	})
+
+	t.Run("host not allowed", func(t *testing.T) {
+		upload := upload
+		upload.Target = "https://mirror.example.com/"
+		upload.Mirrors = []string{"https://prod.example.com/{{ .SHA256 }}"}
+		err := CheckConfig(allowed, &upload, "test")
+		require.False(t, pipe.IsSkip(err), err)
+		require.ErrorContains(t, err, `host "prod.example.com" is not in uploads_allowed_hosts`)
+	})
+}
+
+func TestUploadBufferThreshold(t *testing.T) {
+	// the server removes the file and fails the first request, so retrying
+	// only works if the file was kept in memory.
+	newServer := func(t *testing.T, path string) *recorder {
+		t.Helper()
+		var calls atomic.Int32
+		return newRecorder(t, func(w http.ResponseWriter, _ *http.Request) {
+			if calls.Add(1) == 1 {
+				_ = os.Remove(path)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		})
+	}
+
+	newCtx := func(t *testing.T, content string) (*context.Context, string) {
+		t.Helper()
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			Retry: config.Retry{
+				Attempts: 2,
+				Delay:    time.Millisecond,
+			},
+		})
+		a := addArtifacts(t, ctx, artifact.UploadableArchive, content, "a.tar.gz")[0]
+		return ctx, a.Path
+	}
+
+	check := func(r *http.Response) error {
+		if r.StatusCode != http.StatusCreated {
+			return fmt.Errorf("unexpected status %s", r.Status)
+		}
+		return nil
+	}
+
+	t.Run("small", func(t *testing.T) {
+		ctx, path := newCtx(t, "blah!")
+		srv := newServer(t, path)
+		require.NoError(t, Upload(ctx, []config.Upload{{
+			Name:            "a",
+			Mode:            ModeArchive,
+			Method:          http.MethodPut,
+			Target:          srv.URL,
+			BufferThreshold: "10B",
+		}}, "test", check))
+		require.Equal(t, []string{"blah!", "blah!"}, srv.bodies)
+	})
+
+	t.Run("big", func(t *testing.T) {
+		ctx, path := newCtx(t, "more than ten bytes")
+		srv := newServer(t, path)
+		err := Upload(ctx, []config.Upload{{
+			Name:            "a",
+			Mode:            ModeArchive,
+			Method:          http.MethodPut,
+			Target:          srv.URL,
+			BufferThreshold: "10B",
+		}}, "test", check)
+		require.ErrorIs(t, err, os.ErrNotExist)
+		require.Equal(t, []string{"more than ten bytes"}, srv.bodies)
+	})
+}
+
+func TestUploadTmpDir(t *testing.T) {
+	tmp := filepath.Join(t.TempDir(), "scratch")
+	for name, status := range map[string]int{
+		"success": http.StatusCreated,
+		"failure": http.StatusServiceUnavailable,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			var during []string
+			var sizes []int64
+			srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+				matches, _ := filepath.Glob(filepath.Join(tmp, "*", "*"))
+				mu.Lock()
+				for _, m := range matches {
+					during = append(during, filepath.Base(m))
+				}
+				if r.URL.Path == "/a.bin" {
+					sizes = append(sizes, r.ContentLength)
+				}
+				mu.Unlock()
+				w.WriteHeader(status)
+			})
+
+			ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+				Retry: config.Retry{
+					Attempts: 2,
+					Delay:    time.Millisecond,
+				},
+			})
+			addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.bin")
+
+			// the compressed body is spooled to the tmp_dir, and sent with
+			// its size.
+			uploads := []config.Upload{{
+				Name:            "a",
+				Mode:            ModeArchive,
+				Method:          http.MethodPut,
+				Target:          srv.URL,
+				SidecarTemplate: `{"name":"{{ .ArtifactName }}"}`,
+				Compress:        true,
+				TmpDir:          tmp,
+			}}
+			require.NoError(t, Defaults(uploads))
+			err := Upload(ctx, uploads, "test", func(r *http.Response) error {
+				if r.StatusCode != http.StatusCreated {
+					return fmt.Errorf("unexpected status %s", r.Status)
+				}
+				return nil
+			})
+			if status == http.StatusCreated {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+
+			require.Contains(t, during, "a.bin.json")
+			require.Contains(t, during, "body")
+			require.NotEmpty(t, sizes)
+			for _, size := range sizes {
+				require.Positive(t, size)
+			}
+			entries, err := os.ReadDir(tmp)
+			require.NoError(t, err)
+			require.Empty(t, entries)
+		})
+	}
+}
+
+func TestUploadCredentialsByRealm(t *testing.T) {
+	users := func(srv *recorder) []string {
+		var users []string
+		for _, r := range srv.requests {
+			user, _, _ := r.BasicAuth()
+			users = append(users, user)
+		}
+		return users
+	}
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "releaser" || pass != "realm-secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="releases", charset="UTF-8"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	check := func(r *http.Response) error {
+		if r.StatusCode != http.StatusCreated {
+			return fmt.Errorf("unexpected status %s", r.Status)
+		}
+		return nil
+	}
+
+	ctx := newArchivesCtx(t)
+	ctx.Env["REALM_SECRET"] = "realm-secret"
+	upload := config.Upload{
+		Name:     "a",
+		Mode:     ModeArchive,
+		Method:   http.MethodPut,
+		Target:   srv.URL,
+		Username: "default",
+		Password: "secret",
+		CredentialsByRealm: map[string]config.UploadCredentials{
+			"releases": {Username: "releaser", Password: "{{ .Env.REALM_SECRET }}"},
+		},
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", check))
+	require.ElementsMatch(t, []string{"default", "releaser", "default", "releaser"}, users(srv))
+
+	t.Run("unknown realm", func(t *testing.T) {
+		srv.reset()
+		upload := upload
+		upload.CredentialsByRealm = map[string]config.UploadCredentials{
+			"other": {Username: "releaser", Password: "realm-secret"},
+		}
+		require.Error(t, Upload(ctx, []config.Upload{upload}, "test", check))
+		require.Equal(t, []string{"default", "default"}, users(srv))
+	})
+
+	t.Run("alternating realms", func(t *testing.T) {
+		srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+			user, _, _ := r.BasicAuth()
+			realm := "a"
+			if user == "a" {
+				realm = "b"
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+		upload := upload
+		upload.Target = srv.URL
+		upload.CredentialsByRealm = map[string]config.UploadCredentials{
+			"a": {Username: "a", Password: "a"},
+			"b": {Username: "b", Password: "b"},
+		}
+		require.Error(t, Upload(ctx, []config.Upload{upload}, "test", check))
+		require.ElementsMatch(t, []string{"default", "a", "b", "default", "a", "b"}, users(srv))
+	})
+}
+
+func TestChallengeRealm(t *testing.T) {
+	for challenge, expected := range map[string]string{
+		`Basic realm="releases"`:                  "releases",
+		`Basic charset="UTF-8", realm="releases"`: "releases",
+		`Basic realm=releases, charset="UTF-8"`:   "releases",
+		`Digest REALM="a, b", nonce="abc"`:        "a, b",
+		`Bearer realm=""`:                         "",
+	} {
+		realm, ok := challengeRealm(challenge)
+		require.True(t, ok, challenge)
+		require.Equal(t, expected, realm, challenge)
+	}
+	for _, challenge := range []string{`Basic`, `Basic charset="UTF-8"`, `Basic realm="nope`} {
+		_, ok := challengeRealm(challenge)
+		require.False(t, ok, challenge)
+	}
+}
+
+func TestUploadDedupe(t *testing.T) {
+	for name, tt := range map[string]struct {
+		dedupe   bool
+		expected []string
+	}{
+		"enabled":  {true, []string{"/a.tar.gz", "/b.tar.gz"}},
+		"disabled": {false, []string{"/a.tar.gz", "/a.tar.gz", "/b.tar.gz"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := newRecorder(t, nil)
+
+			// the same file registered twice, plus another one with the same
+			// contents but a different name.
+			ctx := testctx.Wrap(t.Context())
+			addArtifacts(t, ctx, artifact.UploadableArchive, "same", "a.tar.gz", "a.tar.gz", "b.tar.gz")
+
+			upload := config.Upload{
+				Name:   "a",
+				Mode:   ModeArchive,
+				Method: http.MethodPut,
+				Target: srv.URL,
+				Dedupe: tt.dedupe,
+			}
+			require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+			require.Equal(t, tt.expected, srv.paths(http.MethodPut))
+		})
+	}
+}
+
+func TestUploadRemoteURL(t *testing.T) {
+	source := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "reader" || pass != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/images/image.tar" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("remote contents"))
+	})
+
+	target := newRecorder(t, nil)
+
+	newCtx := func(t *testing.T, url string) *context.Context {
+		t.Helper()
+		ctx := testctx.Wrap(t.Context())
+		ctx.Env["REGISTRY_TOKEN"] = "token"
+		ctx.Artifacts.Add(&artifact.Artifact{
+			Name: "image.tar",
+			Type: artifact.UploadableArchive,
+			Extra: map[string]any{
+				artifact.ExtraRemoteURL: url,
+			},
+		})
+		return ctx
+	}
+	upload := config.Upload{
+		Name:   "a",
+		Mode:   ModeArchive,
+		Method: http.MethodPut,
+		Target: target.URL,
+		RemoteCredentials: config.UploadCredentials{
+			Username: "reader",
+			Password: "{{ .Env.REGISTRY_TOKEN }}",
+		},
+	}
+
+	ctx := newCtx(t, source.URL+"/images/image.tar")
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	require.Equal(t, map[string]string{"/image.tar": "remote contents"}, target.files())
+
+	t.Run("not found", func(t *testing.T) {
+		ctx := newCtx(t, source.URL+"/images/nope.tar")
+		require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll), "unexpected http response status: 404")
+	})
+
+	t.Run("wrong credentials", func(t *testing.T) {
+		upload := upload
+		upload.RemoteCredentials.Password = "nope"
+		require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll), "unexpected http response status: 401")
+	})
+
+	t.Run("checksums", func(t *testing.T) {
+		upload := upload
+		upload.ChecksumHeader = "X-Checksum"
+		require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll), "remote artifacts can't be uploaded with checksums")
+	})
+}
+
+func TestUploadsParallelism(t *testing.T) {
+	var mu sync.Mutex
+	var inflight, peak, total int
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inflight++
+		total++
+		peak = max(peak, inflight)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		UploadsParallelism: 2,
+	})
+	ctx.Parallelism = 10
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "0.tar.gz", "1.tar.gz", "2.tar.gz", "3.tar.gz", "4.tar.gz", "5.tar.gz")
+
+	var uploads []config.Upload
+	for _, name := range []string{"a", "b"} {
+		uploads = append(uploads, config.Upload{
+			Name:   name,
+			Mode:   ModeArchive,
+			Method: http.MethodPut,
+			Target: srv.URL + "/" + name,
+			// the existence checks count against the limit too.
+			SkipExisting: true,
+		})
+	}
+	require.NoError(t, Upload(ctx, uploads, "test", acceptAll))
+	require.Equal(t, 24, total)
+	require.Equal(t, 2, peak)
+}
+
+func TestUploadIdempotencyKey(t *testing.T) {
+	// the first request of each file fails, so it is retried.
+	var mu sync.Mutex
+	keys := map[string][]string{}
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		keys[r.URL.Path] = append(keys[r.URL.Path], r.Header.Get("Idempotency-Key"))
+		if len(keys[r.URL.Path]) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		Retry: config.Retry{
+			Attempts: 2,
+			Delay:    time.Millisecond,
+		},
+	})
+	addArtifacts(t, ctx, artifact.UploadableArchive, "same", "a.tar.gz", "b.tar.gz")
+
+	upload := config.Upload{
+		Name:                 "a",
+		Mode:                 ModeArchive,
+		Method:               http.MethodPut,
+		Target:               srv.URL,
+		IdempotencyKeyHeader: "Idempotency-Key",
+	}
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", func(r *http.Response) error {
+		if r.StatusCode != http.StatusCreated {
+			return fmt.Errorf("unexpected status %s", r.Status)
+		}
+		return nil
+	}))
+
+	require.Len(t, keys, 2)
+	a, b := keys["/a.tar.gz"], keys["/b.tar.gz"]
+	require.Len(t, a, 2)
+	require.Len(t, b, 2)
+	require.Equal(t, a[0], a[1])
+	require.Equal(t, b[0], b[1])
+	// sha256 of "same".
+	require.Equal(t, idempotencyKey(srv.URL+"/a.tar.gz", "0967115f2813a3541eaef77de9d9d5773f1c0c04314b0bbfe4ff3b3b1c55b5d5"), a[0])
+	require.NotEqual(t, a[0], b[0])
+}
+
+func TestUploadTwoStep(t *testing.T) {
+	var mu sync.Mutex
+	var metadata []map[string]any
+	blobs := map[string]string{}
+	flaky := 0
+	var srv *recorder
+	srv = newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/flaky" {
+			flaky++
+			if flaky == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			r.URL.Path = "/initiate"
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/initiate":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "u" || pass != "p" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var m map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			metadata = append(metadata, m)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"upload": map[string]string{"url": srv.URL + "/blobs/" + m["name"].(string) + "?sig=abc"},
+			})
+		case r.Method == http.MethodPut && r.URL.Query().Get("sig") == "abc":
+			if r.Header.Get("Authorization") != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			bts, _ := io.ReadAll(r.Body)
+			blobs[r.URL.Path] = string(bts)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")
+
+	check := func(r *http.Response) error {
+		if r.StatusCode != http.StatusCreated {
+			return errors.New(r.Status)
+		}
+		return nil
+	}
+
+	t.Run("success", func(t *testing.T) {
+		upload := config.Upload{
+			Name:              "a",
+			Mode:              ModeArchive,
+			Username:          "u",
+			Password:          "p",
+			InitiateTarget:    srv.URL + "/initiate",
+			UploadURLJSONPath: "$.upload.url",
+		}
+		require.NoError(t, CheckConfig(ctx, &upload, "test"))
+		require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", check))
+		require.Equal(t, []map[string]any{{"name": "a.tar.gz", "size": float64(5)}}, metadata)
+		require.Equal(t, map[string]string{"/blobs/a.tar.gz": "blah!"}, blobs)
+	})
+
+	t.Run("initiate retried", func(t *testing.T) {
+		metadata = nil
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			Retry: config.Retry{
+				Attempts: 2,
+				Delay:    time.Millisecond,
+			},
+		})
+		addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")
+		upload := config.Upload{
+			Name:              "a",
+			Mode:              ModeArchive,
+			InitiateTarget:    srv.URL + "/flaky",
+			UploadURLJSONPath: "$.upload.url",
+		}
+		// the credentials are set by the mutator, so the initiate request
+		// goes through it too.
+		require.NoError(t, UploadWithOptions(ctx, []config.Upload{upload}, "test", check, Options{
+			RequestMutator: func(r *http.Request) error {
+				if r.Method == http.MethodPost {
+					r.SetBasicAuth("u", "p")
+				}
+				return nil
+			},
+		}))
+		require.Equal(t, 2, flaky)
+		require.Len(t, metadata, 1)
+	})
+
+	t.Run("missing url", func(t *testing.T) {
+		upload := config.Upload{
+			Name:              "a",
+			Mode:              ModeArchive,
+			Username:          "u",
+			Password:          "p",
+			InitiateTarget:    srv.URL + "/initiate",
+			UploadURLJSONPath: "$.nope",
+		}
+		require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", check), "could not initiate upload: $.nope: not found in response")
+	})
+
+	t.Run("initiate fails", func(t *testing.T) {
+		upload := config.Upload{
+			Name:              "a",
+			Mode:              ModeArchive,
+			InitiateTarget:    srv.URL + "/initiate",
+			UploadURLJSONPath: "$.upload.url",
+		}
+		require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", check), "could not initiate upload: unexpected status 401 Unauthorized")
+	})
+}
+
+func TestUploadTwoStepResumableSession(t *testing.T) {
+	tokenSrv := newRecorder(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"tok","token_type":"bearer","expires_in":3600}`))
+	})
+
+	var mu sync.Mutex
+	sessions := map[string]string{}
+	objects := map[string]string{}
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/bucket/o":
+			if r.URL.Query().Get("uploadType") != "resumable" || r.Header.Get("Authorization") != "Bearer tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			id := fmt.Sprintf("session-%d", len(sessions))
+			sessions[id] = r.URL.Query().Get("name")
+			// relative, to check it is resolved against the initiate target.
+			w.Header().Set("Location", "/upload/storage/v1/b/bucket/o?uploadType=resumable&upload_id="+id)
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodPut && r.URL.Query().Get("upload_id") != "":
+			name, ok := sessions[r.URL.Query().Get("upload_id")]
+			if !ok || r.Header.Get("Authorization") != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			bts, _ := io.ReadAll(r.Body)
+			if r.Header.Get("Content-Range") != fmt.Sprintf("bytes 0-%d/%d", len(bts)-1, len(bts)) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			objects[name] = string(bts)
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "blah!", "a.tar.gz")
+
+	upload := config.Upload{
+		Name:            "gcs",
+		Mode:            ModeArchive,
+		InitiateTarget:  srv.URL + "/upload/storage/v1/b/bucket/o?uploadType=resumable&name={{ .ArtifactName }}",
+		UploadURLHeader: "Location",
+		OAuth2: config.UploadOAuth2{
+			TokenURL:     tokenSrv.URL,
+			ClientID:     "id",
+			ClientSecret: "secret",
+		},
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", func(r *http.Response) error {
+		if r.StatusCode != http.StatusOK {
+			return errors.New(r.Status)
+		}
+		return nil
+	}))
+	require.Equal(t, map[string]string{"a.tar.gz": "blah!"}, objects)
+
+	t.Run("missing header", func(t *testing.T) {
+		upload := upload
+		upload.UploadURLHeader = "X-Nope"
+		require.ErrorContains(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll), "could not initiate upload: missing X-Nope response header")
+	})
+}
+
+func TestSessionContentRange(t *testing.T) {
+	require.Equal(t, "bytes 0-4/5", sessionContentRange(5))
+	require.Equal(t, "bytes */0", sessionContentRange(0))
+}
+
+func TestTraceRequest(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(srv.Close)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPut, srv.URL, http.NoBody)
+	require.NoError(t, err)
+	req, trace := traceRequest(req)
+	res, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+
+	require.False(t, trace.connectStart.IsZero())
+	require.False(t, trace.connectDone.IsZero())
+	require.False(t, trace.tlsStart.IsZero())
+	require.False(t, trace.tlsDone.IsZero())
+	require.False(t, trace.gotConn.IsZero())
+	require.False(t, trace.firstByte.IsZero())
+	require.False(t, trace.reused)
+	// the target is an IP, so there is no DNS lookup.
+	require.Zero(t, since(trace.dnsStart, trace.dnsDone))
+	require.Positive(t, since(trace.start, trace.firstByte))
+}
+
+func TestUploadTrace(t *testing.T) {
+	srv := newRecorder(t, nil)
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, "a", "a.tar.gz")
+
+	upload := config.Upload{
+		Name:   "a",
+		Mode:   ModeArchive,
+		Method: http.MethodPut,
+		Target: srv.URL,
+		Trace:  true,
+	}
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	require.Len(t, srv.requests, 1)
+}
+
+func TestUploadMaxBytesPerSecond(t *testing.T) {
+	content := strings.Repeat("a", 300)
+	srv := newRecorder(t, nil)
+	ctx := testctx.Wrap(t.Context())
+	addArtifacts(t, ctx, artifact.UploadableArchive, content, "a.tar.gz")
+
+	// 300 bytes at 1000 bytes per second.
+	start := time.Now()
+	require.NoError(t, Upload(ctx, []config.Upload{{
+		Name:              "a",
+		Mode:              ModeArchive,
+		Method:            http.MethodPut,
+		Target:            srv.URL,
+		MaxBytesPerSecond: 1000,
+	}}, "test", acceptAll))
+	require.GreaterOrEqual(t, time.Since(start), 290*time.Millisecond)
+	require.Equal(t, map[string]string{"/a.tar.gz": content}, srv.files())
+}
+
+func TestThrottlesSharedByCopies(t *testing.T) {
+	throttles := newThrottles()
+	upload := config.Upload{Name: "a", MaxBytesPerSecond: 1000}
+	mirror := upload
+	mirror.Target = "https://mirror.example.com"
+	l := throttles.limiter(&upload)
+	require.NotNil(t, l)
+	require.Same(t, l, throttles.limiter(&mirror))
+	require.Len(t, throttles.limiters, 1)
+	require.Nil(t, throttles.limiter(&config.Upload{Name: "b"}))
+}
+
+func writeTestTarGz(tb testing.TB, path string, mtime time.Time, files ...string) {
+	tb.Helper()
+	f, err := os.Create(path)
+	require.NoError(tb, err)
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, name := range files {
+		require.NoError(tb, tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    int64(len(name)),
+			ModTime: mtime,
+		}))
+		_, err := tw.Write([]byte(name))
+		require.NoError(tb, err)
+	}
+	require.NoError(tb, tw.Close())
+	require.NoError(tb, gw.Close())
+}
+
+func writeTestZip(tb testing.TB, path string, mtime time.Time, files ...string) {
+	tb.Helper()
+	f, err := os.Create(path)
+	require.NoError(tb, err)
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, name := range files {
+		hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: mtime}
+		hdr.SetMode(0o644)
+		w, err := zw.CreateHeader(hdr)
+		require.NoError(tb, err)
+		_, err = w.Write([]byte(name))
+		require.NoError(tb, err)
+	}
+	require.NoError(tb, zw.Close())
+}
+
+func TestCanonicalArchiveSum(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for name, write := range map[string]func(testing.TB, string, time.Time, ...string){
+		"a.tar.gz": writeTestTarGz,
+		"a.zip":    writeTestZip,
+	} {
+		t.Run(name, func(t *testing.T) {
+			first := filepath.Join(dir, "first-"+name)
+			second := filepath.Join(dir, "second-"+name)
+			other := filepath.Join(dir, "other-"+name)
+			write(t, first, now, "a.txt", "b/c.txt")
+			write(t, second, now.Add(-time.Hour), "b/c.txt", "a.txt")
+			write(t, other, now, "a.txt", "b/d.txt")
+
+			firstRaw, err := sumFile(first)
+			require.NoError(t, err)
+			secondRaw, err := sumFile(second)
+			require.NoError(t, err)
+			require.NotEqual(t, firstRaw, secondRaw)
+
+			firstSum, err := canonicalArchiveSum(first)
+			require.NoError(t, err)
+			secondSum, err := canonicalArchiveSum(second)
+			require.NoError(t, err)
+			otherSum, err := canonicalArchiveSum(other)
+			require.NoError(t, err)
+			require.Equal(t, firstSum, secondSum)
+			require.NotEqual(t, firstSum, otherSum)
+		})
+	}
+
+	t.Run("invalid archive", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.tar.gz")
+		require.NoError(t, os.WriteFile(path, []byte("nope"), 0o644))
+		_, err := canonicalArchiveSum(path)
+		require.ErrorContains(t, err, "failed to checksum")
+	})
+}
+
+func sumFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return sumReader(f)
+}
+
+func TestUploadCanonicalizeArchiveChecksum(t *testing.T) {
+	srv := newRecorder(t, nil)
+
+	upload := config.Upload{
+		Name:                        "a",
+		Mode:                        ModeArchive,
+		Method:                      http.MethodPut,
+		Target:                      srv.URL,
+		ChecksumHeader:              "X-Sum",
+		CanonicalizeArchiveChecksum: true,
+	}
+	now := time.Now()
+	for _, files := range [][]string{
+		{"a.txt", "b.txt"},
+		{"b.txt", "a.txt"},
+	} {
+		path := filepath.Join(t.TempDir(), "a.tar.gz")
+		writeTestTarGz(t, path, now, files...)
+		now = now.Add(time.Hour)
+		ctx := testctx.Wrap(t.Context())
+		ctx.Artifacts.Add(&artifact.Artifact{
+			Name: "a.tar.gz",
+			Path: path,
+			Type: artifact.UploadableArchive,
+		})
+		require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+	}
+	require.Len(t, srv.requests, 2)
+	sum := srv.requests[0].Header.Get("X-Sum")
+	require.NotEmpty(t, sum)
+	require.Equal(t, sum, srv.requests[1].Header.Get("X-Sum"))
+}
+
+func TestUploadOnCollision(t *testing.T) {
+	for policy, tt := range map[string]struct {
+		err      string
+		expected []string
+	}{
+		"":                   {"", []string{"/mybin", "/mybin"}},
+		OnCollisionOverwrite: {"", []string{"/mybin", "/mybin"}},
+		OnCollisionError:     {"mybin resolves to the same target as mybin", []string{"/mybin"}},
+		OnCollisionRename:    {"", []string{"/mybin", "/mybin-1"}},
+	} {
+		t.Run("policy="+policy, func(t *testing.T) {
+			srv := newRecorder(t, nil)
+
+			// binaries of different architectures with the same name, and so
+			// the same target.
+			ctx := testctx.Wrap(t.Context())
+			for _, arch := range []string{"amd64", "arm64"} {
+				a := addArtifacts(t, ctx, artifact.UploadableBinary, arch, "mybin")[0]
+				a.Goos = "linux"
+				a.Goarch = arch
+			}
+
+			err := Upload(ctx, []config.Upload{{
+				Name:        "a",
+				Mode:        ModeBinary,
+				Method:      http.MethodPut,
+				Target:      srv.URL,
+				OnCollision: policy,
+			}}, "test", acceptAll)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.expected, srv.paths(http.MethodPut))
+		})
+	}
+}
+
+func TestRenameTarget(t *testing.T) {
+	for target, expected := range map[string]string{
+		"https://example.com/a/foo":                "https://example.com/a/foo-2",
+		"https://example.com/a/foo.zip":            "https://example.com/a/foo-2.zip",
+		"https://example.com/a/foo_1.0.0.tar.gz":   "https://example.com/a/foo_1.0.0-2.tar.gz",
+		"https://example.com/a/foo.tar.gz?x=y":     "https://example.com/a/foo-2.tar.gz?x=y",
+		"sftp://user@example.com/a/foo.sha256.txt": "sftp://user@example.com/a/foo.sha256-2.txt",
+	} {
+		t.Run(target, func(t *testing.T) {
+			renamed, err := renameTarget(target, 2)
+			require.NoError(t, err)
+			require.Equal(t, expected, renamed)
+		})
+	}
+}
+
+func TestUploadRawRequest(t *testing.T) {
+	type request struct {
+		method, uri, contentType, apiKey, body string
+		size                                   int64
+	}
+	srv := newRecorder(t, nil)
+
+	ctx := newArchivesCtx(t)
+	ctx.Env["API_KEY"] = "secret"
+	upload := config.Upload{
+		Name: "a",
+		Mode: ModeArchive,
+		RawRequestTemplate: "POST " + srv.URL + "/v1/files/{{ .ArtifactName }}?sha256={{ .SHA256 }} HTTP/1.1\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"X-Api-Key: {{ .Env.API_KEY }}\r\n" +
+			"\r\n" +
+			"--start\n{{ .Body }}\n--end\n",
+	}
+	require.NoError(t, CheckConfig(ctx, &upload, "test"))
+	require.NoError(t, Upload(ctx, []config.Upload{upload}, "test", acceptAll))
+
+	var requests []request
+	for i, r := range srv.requests {
+		requests = append(requests, request{
+			method:      r.Method,
+			uri:         r.RequestURI,
+			contentType: r.Header.Get("Content-Type"),
+			apiKey:      r.Header.Get("X-Api-Key"),
+			body:        srv.bodies[i],
+			size:        r.ContentLength,
+		})
+	}
+	slices.SortFunc(requests, func(a, b request) int {
+		return strings.Compare(a.uri, b.uri)
+	})
+	body := "--start\na\n--end"
+	require.Equal(t, []request{
+		{http.MethodPost, "/v1/files/a.tar.gz?sha256=" + deltaSum, "text/plain", "secret", body, int64(len(body))},
+		{http.MethodPost, "/v1/files/b.tar.gz?sha256=" + deltaSum, "text/plain", "secret", body, int64(len(body))},
+	}, requests)
+}
+
+func TestParseRawRequest(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		req, err := parseRawRequest("\nPATCH https://example.com/a\nX-Foo:  bar \n\n" + rawRequestBody + "\n")
+		require.NoError(t, err)
+		require.Equal(t, &rawRequest{
+			method:  http.MethodPatch,
+			target:  "https://example.com/a",
+			headers: map[string]string{"X-Foo": "bar"},
+		}, req)
+	})
+
+	for name, tt := range map[string]struct {
+		raw, err string
+	}{
+		"no headers end":       {"PUT https://example.com/a", "missing empty line after the headers"},
+		"invalid request line": {"PUT\n\n" + rawRequestBody, "invalid request line"},
+		"invalid protocol":     {"PUT https://example.com/a foo\n\n" + rawRequestBody, "invalid request line"},
+		"invalid header":       {"PUT https://example.com/a\nfoo\n\n" + rawRequestBody, "invalid header line"},
+		"no body":              {"PUT https://example.com/a\n\nfoo", "the body must contain {{ .Body }}"},
+		"multiple bodies":      {"PUT https://example.com/a\n\n" + rawRequestBody + rawRequestBody, "only once"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseRawRequest(tt.raw)
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
 }
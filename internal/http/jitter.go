@@ -0,0 +1,47 @@
+package http
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/goreleaser/goreleaser/v2/internal/retryx"
+)
+
+const (
+	// RetryJitterNone uses the exponential backoff delays as is.
+	RetryJitterNone = "none"
+	// RetryJitterFull waits a random duration between zero and the backoff
+	// delay.
+	RetryJitterFull = "full"
+	// RetryJitterEqual waits half the backoff delay, plus a random duration
+	// between zero and the other half.
+	RetryJitterEqual = "equal"
+)
+
+// retryJitter returns the jitter for the given retry_jitter strategy, or nil
+// if no jitter should be applied.
+func retryJitter(strategy string) retryx.Jitter {
+	switch strategy {
+	case RetryJitterFull:
+		return fullJitter
+	case RetryJitterEqual:
+		return equalJitter
+	default:
+		return nil
+	}
+}
+
+func fullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d + 1)
+}
+
+func equalJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
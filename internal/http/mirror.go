@@ -0,0 +1,52 @@
+package http
+
+import (
+	"errors"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// uploadMirrored uploads the artifact to the target, or its fallback, and
+// then to each of the mirrors, returning all the errors.
+// Mirror errors are only logged if mirror_best_effort is set.
+func uploadMirrored(ctx *context.Context, upload *config.Upload, a *artifact.Artifact, kind string, check ResponseChecker, u *uploader) error {
+	errs := []error{uploadWithFallback(ctx, upload, a, kind, check, u)}
+	for _, target := range upload.Mirrors {
+		mirror := *upload
+		mirror.Target = target
+		mirror.Mirrors = nil
+		err := uploadAsset(ctx, &mirror, a, kind, check, u)
+		if err != nil && upload.MirrorBestEffort {
+			log.WithField("instance", upload.Name).
+				WithField("file", a.Name).
+				WithError(err).
+				Warn("mirror upload failed")
+			continue
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// uploadWithFallback uploads the artifact to the target, and, if that fails
+// after all retries, to the fallback_target.
+func uploadWithFallback(ctx *context.Context, upload *config.Upload, a *artifact.Artifact, kind string, check ResponseChecker, u *uploader) error {
+	err := uploadAsset(ctx, upload, a, kind, check, u)
+	if err == nil || upload.FallbackTarget == "" {
+		return err
+	}
+	log.WithField("instance", upload.Name).
+		WithField("file", a.Name).
+		WithError(err).
+		Warn("upload failed, trying fallback_target")
+	fallback := *upload
+	fallback.Target = upload.FallbackTarget
+	fallback.FallbackTarget = ""
+	if ferr := uploadAsset(ctx, &fallback, a, kind, check, u); ferr != nil {
+		return errors.Join(err, ferr)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// tokenCache shares OAuth2 tokens between the upload configurations of a
+// run, so configurations uploading to the same host with the same
+// credentials only fetch a token once.
+// Tokens are fetched again once they expire.
+type tokenCache struct {
+	mu      sync.Mutex
+	sources map[string]oauth2.TokenSource
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{sources: map[string]oauth2.TokenSource{}}
+}
+
+// token returns the access token to upload to the given target, or an empty
+// string if the upload doesn't use OAuth2.
+func (c *tokenCache) token(ctx *context.Context, upload *config.Upload, target string) (string, error) {
+	cfg := upload.OAuth2
+	if cfg.TokenURL == "" {
+		return "", nil
+	}
+	secret, err := tmpl.New(ctx).Apply(cfg.ClientSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve oauth2 client_secret: %w", err)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid target: %w", err)
+	}
+
+	key := strings.Join(append([]string{u.Host, cfg.TokenURL, cfg.ClientID, secret}, cfg.Scopes...), "\x00")
+	c.mu.Lock()
+	src, ok := c.sources[key]
+	if !ok {
+		src = (&clientcredentials.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: secret,
+			TokenURL:     cfg.TokenURL,
+			Scopes:       cfg.Scopes,
+		}).TokenSource(ctx)
+		c.sources[key] = src
+	}
+	c.mu.Unlock()
+
+	// the token source is safe for concurrent use, and fetches the token
+	// only once.
+	token, err := src.Token()
+	if err != nil {
+		return "", fmt.Errorf("failed to get oauth2 token: %w", err)
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	h "net/http"
+	"os"
+
+	"github.com/caarlos0/log"
+	"github.com/dustin/go-humanize"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/internal/semerrgroup"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// rangeParallelismDefault is the default number of ranges uploaded at the
+// same time.
+const rangeParallelismDefault = 4
+
+// uploadRanges uploads the artifact in ranges of range_chunk_size bytes,
+// range_parallelism at a time, each with a Content-Range header, and then
+// sends a POST request with a `Content-Range: bytes */<size>` header so the
+// server can assemble them.
+// With chunk_checksum, each range is sent with its own checksum in the
+// checksum_header, instead of the one of the whole file.
+// Artifacts smaller than a single range are not uploaded, and false is
+// returned, so they are uploaded in a single request instead.
+func uploadRanges(ctx *context.Context, upload *config.Upload, artifact *artifact.Artifact, target, username, secret string, headers map[string]string, open func() (*asset, error), check ResponseChecker, u *uploader) (*h.Response, bool, error) {
+	chunk, err := humanize.ParseBytes(upload.RangeChunkSize)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid range_chunk_size: %w", err)
+	}
+
+	// opened only to get its size and check it against max_file_size.
+	a, err := open()
+	if err != nil {
+		return nil, false, err
+	}
+	_ = a.ReadCloser.Close()
+	size := a.Size
+	if size <= int64(chunk) {
+		return nil, false, nil
+	}
+
+	log.WithField("file", artifact.Name).
+		WithField("ranges", (size+int64(chunk)-1)/int64(chunk)).
+		Debug("uploading in ranges")
+
+	g := semerrgroup.New(max(upload.RangeParallelism, 1))
+	for start := int64(0); start < size; start += int64(chunk) {
+		end := min(start+int64(chunk), size) - 1
+		g.Go(func() error {
+			rangeHeaders := maps.Clone(headers)
+			rangeHeaders["Content-Range"] = fmt.Sprintf("bytes %d-%d/%d", start, end, size)
+			open := rangeOpen(artifact.Path, start, end-start+1)
+			if upload.ChunkChecksum {
+				sum, err := rangeChecksum(open, upload.ChecksumEncoding)
+				if err != nil {
+					return err
+				}
+				rangeHeaders[upload.ChecksumHeader] = sum
+			}
+			res, err := uploadAssetToServer(ctx, upload, target, username, secret, rangeHeaders, open, check, u)
+			if err != nil {
+				return err
+			}
+			return res.Body.Close()
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, true, err
+	}
+
+	finalize := *upload
+	finalize.Method = h.MethodPost
+	finalizeHeaders := maps.Clone(headers)
+	finalizeHeaders["Content-Range"] = fmt.Sprintf("bytes */%d", size)
+	res, err := uploadAssetToServer(ctx, &finalize, target, username, secret, finalizeHeaders, func() (*asset, error) {
+		return &asset{ReadCloser: h.NoBody}, nil
+	}, check, u)
+	return res, true, err
+}
+
+// rangeOpen opens the given range of the file, so it can be reopened on
+// retries.
+func rangeOpen(path string, offset, n int64) func() (*asset, error) {
+	return func() (*asset, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return &asset{
+			ReadCloser: struct {
+				io.Reader
+				io.Closer
+			}{io.NewSectionReader(f, offset, n), f},
+			Size: n,
+		}, nil
+	}
+}
+
+// rangeChecksum returns the SHA256 of the range, in the given encoding.
+func rangeChecksum(open func() (*asset, error), encoding string) (string, error) {
+	a, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer a.ReadCloser.Close()
+	sum, err := sumReader(a.ReadCloser)
+	if err != nil {
+		return "", fmt.Errorf("failed to checksum: %w", err)
+	}
+	return (&hashedAsset{sum: sum}).encode(encoding)
+}
@@ -0,0 +1,167 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/internal/redact"
+	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// rawRequestBody is what the `.Body` field of the raw_request_template
+// resolves to, and is replaced by the artifact contents when sending the
+// request.
+const rawRequestBody = "\x00goreleaser-raw-request-body\x00"
+
+// rawRequest is an upload request rendered from the raw_request_template.
+type rawRequest struct {
+	method  string
+	target  string
+	headers map[string]string
+	// before and after are the parts of the body around the artifact
+	// contents.
+	before, after string
+}
+
+// parseRawRequest parses a rendered raw_request_template: a request line with
+// the method and the target URL, the headers, an empty line, and the body,
+// which must contain the artifact contents exactly once.
+// A single line break after the artifact contents is dropped, as YAML block
+// scalars always end with one.
+func parseRawRequest(s string) (*rawRequest, error) {
+	rest := strings.TrimLeft(s, "\r\n")
+	var lines []string
+	for {
+		line, tail, ok := strings.Cut(rest, "\n")
+		if !ok {
+			return nil, errors.New("missing empty line after the headers")
+		}
+		rest = tail
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	fields := strings.Fields(lines[0])
+	if len(fields) < 2 || len(fields) > 3 || (len(fields) == 3 && !strings.HasPrefix(fields[2], "HTTP/")) {
+		return nil, fmt.Errorf("invalid request line %q", lines[0])
+	}
+	req := &rawRequest{
+		method:  fields[0],
+		target:  fields[1],
+		headers: map[string]string{},
+	}
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header line %q", line)
+		}
+		req.headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	before, after, ok := strings.Cut(rest, rawRequestBody)
+	if !ok {
+		return nil, errors.New("the body must contain {{ .Body }}")
+	}
+	if strings.Contains(after, rawRequestBody) {
+		return nil, errors.New("the body must contain {{ .Body }} only once")
+	}
+	req.before = before
+	req.after = strings.TrimSuffix(strings.TrimSuffix(after, "\n"), "\r")
+	return req, nil
+}
+
+// uploadRawRequest uploads the artifact with the request rendered from the
+// raw_request_template, using its method, target and headers as they are.
+func uploadRawRequest(ctx *context.Context, upload *config.Upload, a *artifact.Artifact, tpl *tmpl.Template, kind, username, secret string, check ResponseChecker, u *uploader) error {
+	rendered, err := tpl.WithExtraFields(tmpl.Fields{
+		"Body": rawRequestBody,
+	}).Apply(upload.RawRequestTemplate)
+	if err != nil {
+		return fmt.Errorf("%s: %s: failed to resolve raw_request_template: %w", upload.Name, kind, err)
+	}
+	req, err := parseRawRequest(rendered)
+	if err != nil {
+		return fmt.Errorf("%s: %s: invalid raw_request_template: %w", upload.Name, kind, err)
+	}
+
+	log.Debugf("generated target url: %s", redact.String(req.target, ctx.Env.Strings()))
+	if err := checkScheme(req.target); err != nil || isSFTP(req.target) {
+		return fmt.Errorf("%s: %s: raw_request_template requires a http(s) target", upload.Name, kind)
+	}
+	if err := checkAllowedHost(ctx, req.target); err != nil {
+		return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+	}
+	if err := u.breaker.allow(upload, req.target); err != nil {
+		return fmt.Errorf("%s: %s: %s: %w", upload.Name, kind, a.Name, err)
+	}
+	if !hasHeader(req.headers, "Authorization") {
+		token, err := u.tokens.token(ctx, upload, req.target)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", upload.Name, kind, err)
+		}
+		if token != "" {
+			req.headers["Authorization"] = "Bearer " + token
+		}
+	}
+
+	log.WithField("instance", upload.Name).
+		WithField("method", req.method).
+		WithField("file", a.Name).
+		Info("uploading")
+
+	if codes := successCodesFor(upload, a); len(codes) > 0 {
+		check = successCodesChecker(codes, check)
+	}
+	if upload.SuccessHeader != "" {
+		check = successHeaderChecker(upload, check)
+	}
+
+	open := func() (*asset, error) {
+		var body *asset
+		var err error
+		if url := remoteURL(a); url != "" {
+			body, err = remoteAssetOpen(ctx, upload, url)
+		} else {
+			body, err = assetOpen(kind, a)
+		}
+		if err != nil {
+			return nil, err
+		}
+		size := int64(-1)
+		if body.Size >= 0 {
+			size = int64(len(req.before)) + body.Size + int64(len(req.after))
+		}
+		return &asset{
+			ReadCloser: struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(
+				strings.NewReader(req.before),
+				body.ReadCloser,
+				strings.NewReader(req.after),
+			), body.ReadCloser},
+			Size: size,
+		}, nil
+	}
+
+	raw := *upload
+	raw.Method = req.method
+	res, err := uploadAssetToServer(ctx, &raw, req.target, username, secret, req.headers, open, check, u)
+	u.breaker.record(upload, req.target, err)
+	if err != nil {
+		return newUploadError(ctx, upload, kind, a, req.target, res, err)
+	}
+	if err := res.Body.Close(); err != nil {
+		log.WithError(err).Warn("failed to close response body")
+	}
+	return nil
+}
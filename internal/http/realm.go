@@ -0,0 +1,71 @@
+package http
+
+import (
+	h "net/http"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// realmCredentials returns the realm the server challenged the request with,
+// and its credentials_by_realm entry, if any.
+func realmCredentials(ctx *context.Context, upload *config.Upload, res *h.Response) (string, string, string, bool, error) {
+	if len(upload.CredentialsByRealm) == 0 || res == nil || res.StatusCode != h.StatusUnauthorized {
+		return "", "", "", false, nil
+	}
+	for _, challenge := range res.Header.Values("WWW-Authenticate") {
+		realm, ok := challengeRealm(challenge)
+		if !ok {
+			continue
+		}
+		creds, ok := upload.CredentialsByRealm[realm]
+		if !ok {
+			continue
+		}
+		username, err := tmpl.New(ctx).Apply(creds.Username)
+		if err != nil {
+			return "", "", "", false, err
+		}
+		password, err := tmpl.New(ctx).Apply(creds.Password)
+		if err != nil {
+			return "", "", "", false, err
+		}
+		log.WithField("instance", upload.Name).
+			WithField("realm", realm).
+			Debug("using realm credentials")
+		return realm, username, password, true, nil
+	}
+	return "", "", "", false, nil
+}
+
+// challengeRealm extracts the realm parameter of a WWW-Authenticate
+// challenge, e.g. `Basic realm="artifacts", charset="UTF-8"`.
+func challengeRealm(challenge string) (string, bool) {
+	_, params, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	for params != "" {
+		var param string
+		params = strings.TrimLeft(params, " ,")
+		key, rest, ok := strings.Cut(params, "=")
+		if !ok {
+			return "", false
+		}
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return "", false
+			}
+			param, params = rest[1:end+1], rest[end+2:]
+		} else {
+			param, params, _ = strings.Cut(rest, ",")
+			param = strings.TrimSpace(param)
+		}
+		if strings.EqualFold(strings.TrimSpace(key), "realm") {
+			return param, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,60 @@
+package http
+
+import (
+	"fmt"
+	h "net/http"
+
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// remoteURL returns the URL the artifact contents should be streamed from,
+// if it references a remote file instead of a local one.
+func remoteURL(a *artifact.Artifact) string {
+	return artifact.ExtraOr(*a, artifact.ExtraRemoteURL, "")
+}
+
+// checkRemoteArtifact errors if the upload uses settings which need the
+// contents of the artifact before uploading it, as remote artifacts are only
+// streamed.
+func checkRemoteArtifact(upload *config.Upload) error {
+	if usesChecksum(upload) || upload.ChecksumHeader != "" || upload.FormChecksumField != "" || upload.IdempotencyKeyHeader != "" ||
+		upload.VerifyAfterUpload || upload.VerifySize || upload.RangeChunkSize != "" || upload.Dedupe {
+		return fmt.Errorf("remote artifacts can't be uploaded with checksums, verify_after_upload, verify_size, range_chunk_size or dedupe")
+	}
+	return nil
+}
+
+// remoteAssetOpen streams the contents of the given URL, authenticating with
+// the remote_credentials.
+func remoteAssetOpen(ctx *context.Context, upload *config.Upload, url string) (*asset, error) {
+	req, err := h.NewRequestWithContext(ctx, h.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	username, err := tmpl.New(ctx).Apply(upload.RemoteCredentials.Username)
+	if err != nil {
+		return nil, err
+	}
+	password, err := tmpl.New(ctx).Apply(upload.RemoteCredentials.Password)
+	if err != nil {
+		return nil, err
+	}
+	if username != "" && password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	res, err := h.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not download %s: %w", url, err)
+	}
+	if res.StatusCode != h.StatusOK {
+		_ = res.Body.Close()
+		return nil, fmt.Errorf("could not download %s: unexpected http response status: %s", url, res.Status)
+	}
+	return &asset{
+		ReadCloser: res.Body,
+		Size:       res.ContentLength,
+	}, nil
+}
@@ -0,0 +1,165 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/goreleaser/goreleaser/v2/internal/retryx"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// isSFTP tells whether the given target should be uploaded to using SFTP
+// instead of HTTP.
+func isSFTP(target string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(target)), "sftp://")
+}
+
+// checkSFTP validates the SFTP specific settings of an upload.
+func checkSFTP(kind string, upload *config.Upload, username, password string) error {
+	if username == "" {
+		if u, err := url.Parse(upload.Target); err != nil || u.User == nil || u.User.Username() == "" {
+			return misconfigured(kind, upload, "sftp targets require a username")
+		}
+	}
+	if upload.SSHKey == "" && password == "" {
+		return misconfigured(kind, upload, "sftp targets require either 'ssh_key' or a password")
+	}
+	if upload.SSHKey != "" {
+		if _, err := sshSigner(upload.SSHKey); err != nil {
+			return misconfigured(kind, upload, err.Error())
+		}
+	}
+	if upload.GroupTemplate != "" {
+		return misconfigured(kind, upload, "group_template can't be used with sftp targets")
+	}
+	if len(upload.CredentialsByRealm) > 0 {
+		return misconfigured(kind, upload, "credentials_by_realm can't be used with sftp targets")
+	}
+	if upload.ChecksumTrailer || upload.Compress || upload.VerifyAfterUpload || upload.VerifySize || upload.SkipExisting || upload.RangeChunkSize != "" {
+		return misconfigured(kind, upload, "checksum_trailer, compress, verify_after_upload, verify_size, skip_existing and range_chunk_size can't be used with sftp targets")
+	}
+	return nil
+}
+
+func sshSigner(path string) (ssh.Signer, error) {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read ssh_key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(bts)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse ssh_key: %w", err)
+	}
+	return signer, nil
+}
+
+// sshClientConfig returns the configuration to connect to the given target,
+// verifying the server against the known hosts file.
+func sshClientConfig(upload *config.Upload, u *url.URL, username, secret string) (*ssh.ClientConfig, error) {
+	if u.User != nil && u.User.Username() != "" {
+		username = u.User.Username()
+	}
+	var auth []ssh.AuthMethod
+	if upload.SSHKey != "" {
+		signer, err := sshSigner(upload.SSHKey)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if secret != "" {
+		auth = append(auth, ssh.Password(secret))
+	}
+
+	knownHosts := upload.SSHKnownHosts
+	if knownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("could not find known hosts file: %w", err)
+		}
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("could not read known hosts file: %w", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+// uploadSFTP uploads the asset to the given sftp:// target, creating its
+// parent directories as needed.
+func uploadSFTP(ctx *context.Context, upload *config.Upload, target, username, secret string, open func() (*asset, error), up *uploader) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid target: %w", err)
+	}
+	cfg, err := sshClientConfig(upload, u, username, secret)
+	if err != nil {
+		return err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	return retryx.DoWithJitter(ctx, ctx.Config.Retry, func() error {
+		// the whole transfer counts as a single request.
+		if err := up.acquire(ctx); err != nil {
+			return retryx.Unrecoverable(err)
+		}
+		defer up.release()
+		conn, err := ssh.Dial("tcp", addr, cfg)
+		if err != nil {
+			if _, ok := errors.AsType[*knownhosts.KeyError](err); ok {
+				return retryx.Unrecoverable(err)
+			}
+			return err
+		}
+		defer conn.Close()
+
+		client, err := sftp.NewClient(conn)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if err := client.MkdirAll(path.Dir(u.Path)); err != nil {
+			return retryx.Unrecoverable(fmt.Errorf("could not create %q: %w", path.Dir(u.Path), err))
+		}
+
+		a, err := open()
+		if err != nil {
+			return retryx.Unrecoverable(err)
+		}
+		defer a.ReadCloser.Close()
+
+		f, err := client.Create(u.Path)
+		if err != nil {
+			return retryx.Unrecoverable(fmt.Errorf("could not create %q: %w", u.Path, err))
+		}
+		if _, err := io.Copy(f, a.ReadCloser); err != nil {
+			_ = f.Close()
+			if errors.Is(err, errCorruptedGzip) {
+				return retryx.Unrecoverable(err)
+			}
+			return err
+		}
+		return f.Close()
+	}, retryx.IsRetriable, retryJitter(upload.RetryJitter))
+}
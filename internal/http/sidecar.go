@@ -0,0 +1,53 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// sidecarExtDefault is the default extension of the sidecar_template files.
+const sidecarExtDefault = "json"
+
+// templateSidecars writes a `<name>.<sidecar_ext>` file for each of the given
+// artifacts into dir, with the evaluated sidecar_template, returning them as
+// artifacts.
+func templateSidecars(ctx *context.Context, upload *config.Upload, dir string, artifacts []*artifact.Artifact) ([]*artifact.Artifact, error) {
+	var result []*artifact.Artifact
+	for _, a := range artifacts {
+		switch a.Type {
+		case artifact.Checksum, artifact.Signature, artifact.Certificate, artifact.Metadata:
+			continue
+		}
+		tpl, err := artifactTemplate(ctx, upload, a, upload.SidecarTemplate)
+		if err != nil {
+			return nil, err
+		}
+		content, err := tpl.Apply(upload.SidecarTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve sidecar_template: %w", err)
+		}
+		if !json.Valid([]byte(content)) {
+			return nil, fmt.Errorf("sidecar_template for %s is not valid JSON", a.Name)
+		}
+		name := a.Name + "." + upload.SidecarExt
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return nil, err
+		}
+		result = append(result, &artifact.Artifact{
+			Name: name,
+			Path: path,
+			Type: artifact.Metadata,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+	"golang.org/x/time/rate"
+)
+
+// throttles holds the bandwidth limiter of each upload block, keyed by its
+// name, so all the requests of a block share its max_bytes_per_second, even
+// the ones sent with a modified copy of the block, e.g. to a mirror.
+type throttles struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newThrottles() *throttles {
+	return &throttles{limiters: map[string]*rate.Limiter{}}
+}
+
+// limiter returns the bandwidth limiter of the given upload, or nil if its
+// bandwidth is not limited.
+func (t *throttles) limiter(upload *config.Upload) *rate.Limiter {
+	if upload.MaxBytesPerSecond <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if l, ok := t.limiters[upload.Name]; ok {
+		return l
+	}
+	// at most a second worth of bytes can be read at once, and the bucket
+	// starts empty, so there's no initial burst.
+	burst := int(upload.MaxBytesPerSecond)
+	l := rate.NewLimiter(rate.Limit(upload.MaxBytesPerSecond), burst)
+	l.AllowN(time.Now(), burst)
+	t.limiters[upload.Name] = l
+	return l
+}
+
+// throttledReader reads from the underlying reader no faster than its
+// limiter allows.
+type throttledReader struct {
+	io.ReadCloser
+	ctx     *context.Context
+	limiter *rate.Limiter
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if burst := r.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"crypto/tls"
+	h "net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+)
+
+// requestTrace records when each phase of a request happened, so their
+// durations can be logged.
+type requestTrace struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	firstByte    time.Time
+	reused       bool
+}
+
+// traceRequest returns a copy of the request which records its phases in the
+// returned trace.
+func traceRequest(req *h.Request) (*h.Request, *requestTrace) {
+	t := &requestTrace{start: time.Now()}
+	record := func(at *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if at.IsZero() {
+			*at = time.Now()
+		}
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { record(&t.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { record(&t.dnsDone) },
+		ConnectStart:      func(string, string) { record(&t.connectStart) },
+		ConnectDone:       func(string, string, error) { record(&t.connectDone) },
+		TLSHandshakeStart: func() { record(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { record(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(&t.gotConn)
+			t.mu.Lock()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() { record(&t.firstByte) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), t
+}
+
+// log logs the duration of each phase of the request at debug level.
+// Phases which didn't happen, e.g. DNS lookups of IP targets, are logged
+// as zero.
+func (t *requestTrace) log(upload *config.Upload, req *h.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	log.WithField("instance", upload.Name).
+		WithField("method", req.Method).
+		WithField("host", req.URL.Host).
+		WithField("dns", since(t.dnsStart, t.dnsDone)).
+		WithField("connect", since(t.connectStart, t.connectDone)).
+		WithField("tls", since(t.tlsStart, t.tlsDone)).
+		WithField("reused", t.reused).
+		WithField("ttfb", since(t.gotConn, t.firstByte)).
+		WithField("total", since(t.start, t.firstByte)).
+		Debug("request timings")
+}
+
+func since(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
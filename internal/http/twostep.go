@@ -0,0 +1,125 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	h "net/http"
+	"os"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/internal/redact"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// uploadTwoStep posts the artifact metadata to the initiate_target, and then
+// uploads the artifact to the URL assigned by the server with a PUT request.
+// The assigned URL is expected to carry its own authorization, so the
+// credentials are only sent to the initiate_target.
+// URLs read from the upload_url_header are resumable sessions, e.g. Google
+// Cloud Storage ones, which are sent the whole file as a single range.
+func uploadTwoStep(ctx *context.Context, upload *config.Upload, a *artifact.Artifact, name, target, username, secret string, headers map[string]string, open func() (*asset, error), check ResponseChecker, u *uploader) (*h.Response, error) {
+	assigned, err := initiateUpload(ctx, upload, a, name, target, username, secret, remoteHeaders(upload, headers), u)
+	if err != nil {
+		return nil, fmt.Errorf("could not initiate upload: %w", err)
+	}
+	log.Debugf("assigned upload url: %s", redact.String(assigned, ctx.Env.Strings()))
+
+	headers = maps.Clone(headers)
+	delete(headers, "Authorization")
+	if upload.UploadURLHeader != "" {
+		s, err := os.Stat(a.Path)
+		if err != nil {
+			return nil, err
+		}
+		headers["Content-Range"] = sessionContentRange(s.Size())
+	}
+	put := *upload
+	put.Method = h.MethodPut
+	return uploadAssetToServer(ctx, &put, assigned, "", "", headers, open, check, u)
+}
+
+// initiateUpload posts the artifact name and size as JSON to the target,
+// and returns the upload URL read from the response upload_url_header, or
+// from its body at the upload_url_json_path.
+// The request is sent like the uploads themselves, so it is retried, traced
+// and counts against the uploads_parallelism, but any 2xx status is accepted,
+// as the success_codes are the ones of the uploads.
+func initiateUpload(ctx *context.Context, upload *config.Upload, a *artifact.Artifact, name, target, username, secret string, headers map[string]string, u *uploader) (string, error) {
+	metadata := map[string]any{"name": name}
+	if s, err := os.Stat(a.Path); err == nil {
+		metadata["size"] = s.Size()
+	}
+	body, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	headers = maps.Clone(headers)
+	if !hasHeader(headers, "Content-Type") {
+		headers["Content-Type"] = "application/json"
+	}
+
+	post := *upload
+	post.Method = h.MethodPost
+	open := func() (*asset, error) {
+		return &asset{
+			ReadCloser: io.NopCloser(bytes.NewReader(body)),
+			Size:       int64(len(body)),
+		}, nil
+	}
+	check := func(res *h.Response) error {
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return fmt.Errorf("unexpected status %s", res.Status)
+		}
+		return nil
+	}
+	res, err := uploadAssetToServer(ctx, &post, target, username, secret, headers, open, check, u)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var assigned string
+	if upload.UploadURLHeader != "" {
+		assigned, err = headerURL(res, upload.UploadURLHeader)
+	} else {
+		assigned, err = jsonPathString(res.Body, upload.UploadURLJSONPath)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := checkScheme(assigned); err != nil {
+		return "", err
+	}
+	if err := checkAllowedHost(ctx, assigned); err != nil {
+		return "", err
+	}
+	return assigned, nil
+}
+
+// headerURL returns the URL in the given response header, resolved against
+// the request URL, as Location headers might be relative.
+func headerURL(res *h.Response, header string) (string, error) {
+	value := res.Header.Get(header)
+	if value == "" {
+		return "", fmt.Errorf("missing %s response header", header)
+	}
+	u, err := res.Request.URL.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s response header: %w", header, err)
+	}
+	return u.String(), nil
+}
+
+// sessionContentRange returns the Content-Range header to send a whole file
+// of the given size to a resumable session.
+func sessionContentRange(size int64) string {
+	if size == 0 {
+		return "bytes */0"
+	}
+	return fmt.Sprintf("bytes 0-%d/%d", size-1, size)
+}
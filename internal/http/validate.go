@@ -0,0 +1,106 @@
+package http
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+var envRe = regexp.MustCompile(`\.Env\.([A-Za-z_][A-Za-z0-9_]*)`)
+
+// Validate applies the templates of the given uploads against a sample
+// artifact, so mistakes can be caught before releasing.
+// Environment variables used by the templates are set to placeholder values
+// if missing, as they are usually only available when releasing.
+func Validate(ctx *context.Context, uploads []config.Upload) error {
+	for _, upload := range uploads {
+		if err := validateUpload(ctx, &upload); err != nil {
+			return fmt.Errorf("%s: %w", upload.Name, err)
+		}
+	}
+	return nil
+}
+
+// placeholderSum is the sha256 the templates are checked with, as the actual
+// checksums are only known when uploading.
+const placeholderSum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// placeholderFields returns the fields only available when uploading, set to
+// placeholder values, so templates using them can be checked beforehand.
+func placeholderFields(upload *config.Upload) tmpl.Fields {
+	fields := checksumFields(upload, placeholderSum)
+	fields["Group"] = "example"
+	fields["Body"] = rawRequestBody
+	return fields
+}
+
+func validateUpload(ctx *context.Context, upload *config.Upload) error {
+	fields := map[string]string{
+		"target":                      upload.Target,
+		"username":                    upload.Username,
+		"password":                    upload.Password,
+		"name_template":               upload.NameTemplate,
+		"group_template":              upload.GroupTemplate,
+		"sidecar_template":            upload.SidecarTemplate,
+		"fallback_target":             upload.FallbackTarget,
+		"initiate_target":             upload.InitiateTarget,
+		"raw_request_template":        upload.RawRequestTemplate,
+		"remote_credentials.username": upload.RemoteCredentials.Username,
+		"remote_credentials.password": upload.RemoteCredentials.Password,
+	}
+	for name, value := range upload.CustomHeaders {
+		fields["custom_headers."+name] = value
+	}
+	for name, value := range upload.JSONEnvelope {
+		fields["json_envelope."+name] = value
+	}
+	for name, value := range upload.FormFields {
+		fields["form_fields."+name] = value
+	}
+	for i, value := range upload.Mirrors {
+		fields[fmt.Sprintf("mirrors.%d", i)] = value
+	}
+	for realm, creds := range upload.CredentialsByRealm {
+		fields["credentials_by_realm."+realm+".username"] = creds.Username
+		fields["credentials_by_realm."+realm+".password"] = creds.Password
+	}
+
+	env := maps.Clone(ctx.Env)
+	if env == nil {
+		env = map[string]string{}
+	}
+	for _, s := range append(slices.Collect(maps.Values(fields)), upload.Skip) {
+		for _, m := range envRe.FindAllStringSubmatch(s, -1) {
+			if _, ok := env[m[1]]; !ok {
+				env[m[1]] = "placeholder"
+			}
+		}
+	}
+
+	tpl := tmpl.New(ctx).
+		WithEnv(env).
+		WithArtifact(&artifact.Artifact{
+			Name:   "example.tar.gz",
+			Path:   "example.tar.gz",
+			Goos:   "linux",
+			Goarch: "amd64",
+			Type:   artifact.UploadableArchive,
+		}).
+		WithExtraFields(placeholderFields(upload))
+
+	if _, err := tpl.Bool(upload.Skip); err != nil {
+		return fmt.Errorf("invalid skip: %w", err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		if _, err := tpl.Apply(fields[name]); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return nil
+}
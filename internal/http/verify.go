@@ -0,0 +1,244 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	h "net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+const (
+	// VerifyModeFull downloads the whole uploaded file and compares its
+	// checksum.
+	VerifyModeFull = "full"
+	// VerifyModeSample downloads a few ranges of the uploaded file and
+	// compares them, as well as its size.
+	VerifyModeSample = "sample"
+)
+
+// verifySampleSize is the size of each of the ranges downloaded when using the
+// sample verify mode.
+const verifySampleSize = 64 << 10
+
+// remote is an uploaded artifact, which can be downloaded to check it matches
+// the local file, or checked for existence.
+type remote struct {
+	ctx      *context.Context
+	upload   *config.Upload
+	target   string
+	username string
+	secret   string
+	headers  map[string]string
+	u        *uploader
+}
+
+// verify checks the uploaded artifact according to the verify_mode.
+func (v remote) verify(a *artifact.Artifact) error {
+	log.WithField("file", a.Name).Debug("verifying upload")
+	if v.upload.VerifyMode == VerifyModeSample {
+		return v.sample(a)
+	}
+	return v.full(a)
+}
+
+func (v remote) full(a *artifact.Artifact) error {
+	want, err := a.Checksum("sha256")
+	if err != nil {
+		return err
+	}
+	res, err := v.get("")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != h.StatusOK {
+		return fmt.Errorf("verify failed: unexpected http response status: %s", res.Status)
+	}
+	body := io.Reader(res.Body)
+	if v.upload.VerifyAcceptGzip && strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return fmt.Errorf("verify failed: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+	sum := sha256.New()
+	if _, err := io.Copy(sum, body); err != nil {
+		return fmt.Errorf("verify failed: %w", err)
+	}
+	if got := hex.EncodeToString(sum.Sum(nil)); got != want {
+		return fmt.Errorf("verify failed: checksum mismatch: expected %s, got %s", want, got)
+	}
+	return nil
+}
+
+func (v remote) sample(a *artifact.Artifact) error {
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := s.Size()
+	if size == 0 {
+		return v.full(a)
+	}
+
+	for _, r := range sampleRanges(size) {
+		want := make([]byte, r.end-r.start+1)
+		if _, err := f.ReadAt(want, r.start); err != nil {
+			return err
+		}
+		if err := v.verifyRange(r, size, want); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifySize checks the size of the uploaded file, as reported by the
+// server in the Content-Length of a HEAD request, matches the local file.
+func (v remote) verifySize(a *artifact.Artifact) error {
+	s, err := os.Stat(a.Path)
+	if err != nil {
+		return err
+	}
+	req, err := v.newRequest(h.MethodHead, nil)
+	if err != nil {
+		return err
+	}
+	res, err := v.do(req)
+	if err != nil {
+		return fmt.Errorf("verify size failed: %w", err)
+	}
+	_ = res.Body.Close()
+	switch {
+	case res.StatusCode != h.StatusOK:
+		return fmt.Errorf("verify size failed: unexpected http response status: %s", res.Status)
+	case res.ContentLength < 0:
+		return fmt.Errorf("verify size failed: server did not report the file size")
+	case res.ContentLength != s.Size():
+		return fmt.Errorf("verify size failed: size mismatch: expected %d, got %d", s.Size(), res.ContentLength)
+	}
+	return nil
+}
+
+// byteRange is an inclusive range of bytes, as used in Range headers.
+type byteRange struct {
+	start, end int64
+}
+
+// sampleRanges returns the ranges to verify: the start, the middle and the end
+// of the file, or the whole file if it is small enough.
+func sampleRanges(size int64) []byteRange {
+	if size <= 3*verifySampleSize {
+		return []byteRange{{0, size - 1}}
+	}
+	mid := size/2 - verifySampleSize/2
+	return []byteRange{
+		{0, verifySampleSize - 1},
+		{mid, mid + verifySampleSize - 1},
+		{size - verifySampleSize, size - 1},
+	}
+}
+
+func (v remote) verifyRange(r byteRange, size int64, want []byte) error {
+	res, err := v.get(fmt.Sprintf("bytes=%d-%d", r.start, r.end))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != h.StatusPartialContent {
+		return fmt.Errorf("verify failed: server does not support range requests: %s", res.Status)
+	}
+	if total := contentRangeSize(res.Header.Get("Content-Range")); total != size {
+		return fmt.Errorf("verify failed: size mismatch: expected %d, got %d", size, total)
+	}
+	got, err := io.ReadAll(io.LimitReader(res.Body, int64(len(want))+1))
+	if err != nil {
+		return fmt.Errorf("verify failed: %w", err)
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("verify failed: contents mismatch in range %d-%d", r.start, r.end)
+	}
+	return nil
+}
+
+// contentRangeSize returns the complete length from a Content-Range header,
+// or -1 if unknown.
+func contentRangeSize(header string) int64 {
+	_, total, ok := strings.Cut(header, "/")
+	if !ok {
+		return -1
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// remoteHeaders returns the upload headers which are also sent when verifying
+// it or checking for its existence, i.e. the custom and authorization ones.
+func remoteHeaders(upload *config.Upload, headers map[string]string) map[string]string {
+	result := map[string]string{}
+	for k, v := range headers {
+		if _, ok := upload.CustomHeaders[k]; ok || k == "Authorization" {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// get downloads the target, with the given Range header if not empty.
+// Whole downloads ask for gzip if verify_accept_gzip is set, in which case
+// the caller must decompress the body.
+func (v remote) get(byteRange string) (*h.Response, error) {
+	req, err := v.newRequest(h.MethodGet, nil)
+	if err != nil {
+		return nil, err
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	} else if v.upload.VerifyAcceptGzip {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	res, err := v.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("verify failed: %w", err)
+	}
+	return res, nil
+}
+
+func (v remote) newRequest(method string, body io.Reader) (*h.Request, error) {
+	req, err := h.NewRequestWithContext(v.ctx, method, v.target, body)
+	if err != nil {
+		return nil, err
+	}
+	if v.username != "" && v.secret != "" && !hasHeader(v.headers, "Authorization") {
+		req.SetBasicAuth(v.username, v.secret)
+	}
+	for k, value := range v.headers {
+		req.Header.Set(k, value)
+	}
+	return req, nil
+}
+
+func (v remote) do(req *h.Request) (*h.Response, error) {
+	return v.u.do(v.ctx, v.upload, req)
+}
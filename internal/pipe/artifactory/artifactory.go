@@ -36,8 +36,10 @@ func (Pipe) Publish(ctx *context.Context) error {
 	// Check requirements for every instance we have configured.
 	// If not fulfilled, we can skip this pipeline
 	for _, instance := range ctx.Config.Artifactories {
-		if skip := http.CheckConfig(ctx, &instance, "artifactory"); skip != nil {
-			return pipe.Skip(skip.Error())
+		if err := http.CheckConfig(ctx, &instance, "artifactory"); pipe.IsSkip(err) {
+			return pipe.Skip(err.Error())
+		} else if err != nil {
+			return err
 		}
 	}
 
@@ -0,0 +1,133 @@
+package sourcearchive
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/archivefiles"
+	"github.com/goreleaser/goreleaser/v2/internal/gio"
+	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// cacheDir is the directory, inside dist, the cached source archives are
+// kept in.
+const cacheDir = ".source-cache"
+
+// cacheInputs is everything that changes the contents of a source archive.
+type cacheInputs struct {
+	Args      []string      `json:"args"`
+	Commit    string        `json:"commit"`
+	Format    string        `json:"format"`
+	ZipMethod string        `json:"zip_method"`
+	Prefix    string        `json:"prefix"`
+	MTime     time.Time     `json:"mtime"`
+	Files     []config.File `json:"files"`
+	InfoFile  string        `json:"info_file"`
+	// the info file also has the release date, which is left out, as it
+	// changes on every run.
+	Tag       string `json:"tag"`
+	Vendor    bool   `json:"vendor"`
+	ZeroAttrs bool   `json:"zero_attrs"`
+	// the given extra files are temporary, so only their destinations are
+	// part of the key, along with their contents.
+	Extra []string `json:"extra"`
+}
+
+// cacheKey returns the key of the source archive for the given inputs.
+// The contents of the configured and given extra files are part of it, so
+// changing them invalidates the cached archive, as are the go.mod and go.sum
+// files when vendoring the go modules.
+func cacheKey(ctx *context.Context, args []string, format, prefix, commit string, mtime time.Time, extra ...config.File) (string, error) {
+	files, err := archivefiles.Eval(tmpl.New(ctx), ctx.Config.Source.Files)
+	if err != nil {
+		return "", err
+	}
+
+	inputs := cacheInputs{
+		Args:      args,
+		Commit:    commit,
+		Format:    format,
+		ZipMethod: ctx.Config.Source.ZipMethod,
+		Prefix:    prefix,
+		MTime:     mtime.UTC(),
+		Files:     files,
+		InfoFile:  ctx.Config.Source.InfoFile,
+		Vendor:    ctx.Config.Source.VendorGoModules,
+		ZeroAttrs: ctx.Config.Source.ZipZeroExternalAttrs,
+	}
+	for _, f := range extra {
+		inputs.Extra = append(inputs.Extra, f.Destination)
+	}
+	if inputs.InfoFile != "" {
+		inputs.Tag = ctx.Git.CurrentTag
+	}
+
+	h := sha256.New()
+	if err := json.NewEncoder(h).Encode(inputs); err != nil {
+		return "", err
+	}
+	for _, f := range append(files, extra...) {
+		if err := hashFile(h, f.Source); err != nil {
+			return "", fmt.Errorf("could not compute source cache key: %w", err)
+		}
+	}
+	if inputs.Vendor {
+		root := cmp.Or(ctx.Config.Source.WorkTree, ".")
+		for _, name := range []string{"go.mod", "go.sum"} {
+			if err := hashFile(h, filepath.Join(root, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return "", fmt.Errorf("could not compute source cache key: %w", err)
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// restoreCache copies the cached archive with the given key to path,
+// returning whether there was one.
+func restoreCache(ctx *context.Context, key, path string) (bool, error) {
+	cached := filepath.Join(ctx.Config.Dist, cacheDir, key)
+	if _, err := os.Stat(cached); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := gio.Copy(cached, path); err != nil {
+		return false, fmt.Errorf("could not restore cached source archive: %w", err)
+	}
+	log.WithField("key", key).Info("reusing cached source archive")
+	return true, nil
+}
+
+// storeCache keeps a copy of the archive at path under the given key.
+func storeCache(ctx *context.Context, key, path string) error {
+	dir := filepath.Join(ctx.Config.Dist, cacheDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("could not cache source archive: %w", err)
+	}
+	if err := gio.Copy(path, filepath.Join(dir, key)); err != nil {
+		return fmt.Errorf("could not cache source archive: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package sourcearchive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goreleaser/goreleaser/v2/internal/git"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// changelogFile is the name of the changelog added to the source archive.
+const changelogFile = "CHANGELOG.md"
+
+// writeChangelog writes the release notes to a temporary CHANGELOG.md,
+// returning its path.
+// If there are none, e.g. because the changelog is disabled, the git log
+// since the previous tag is used instead.
+func writeChangelog(ctx *context.Context, args []string, commit string) (string, error) {
+	content := ctx.ReleaseNotes
+	if strings.TrimSpace(content) == "" {
+		rng := commit
+		if ctx.Git.PreviousTag != "" {
+			rng = ctx.Git.PreviousTag + ".." + commit
+		}
+		out, err := git.RunWithBinary(ctx, ctx.Env["GIT_BINARY"], append(slices.Clone(args), "log", "--pretty=format:* %H %s", rng)...)
+		if err != nil {
+			return "", fmt.Errorf("could not create source changelog: %w", err)
+		}
+		content = "## Changelog\n\n" + strings.TrimSpace(out)
+	}
+
+	dir, err := os.MkdirTemp("", "goreleaser-source-changelog")
+	if err != nil {
+		return "", fmt.Errorf("could not create source changelog: %w", err)
+	}
+	path := filepath.Join(dir, changelogFile)
+	if err := os.WriteFile(path, []byte(strings.TrimSpace(content)+"\n"), 0o644); err != nil {
+		return "", fmt.Errorf("could not create source changelog: %w", err)
+	}
+	return path, nil
+}
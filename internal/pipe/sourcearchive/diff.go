@@ -0,0 +1,74 @@
+package sourcearchive
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/internal/git"
+	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// diffArchive creates a tar.gz with only the files changed between the
+// configured diff_from ref and the archived commit, and adds it as an
+// uploadable file.
+// Deleted files can't be represented in an archive, so they are left out.
+func diffArchive(ctx *context.Context, args []string, name, prefix, commit string) error {
+	if ctx.Config.Source.DiffFrom == "" {
+		return nil
+	}
+	from, err := tmpl.New(ctx).Apply(ctx.Config.Source.DiffFrom)
+	if err != nil {
+		return err
+	}
+
+	out, err := git.RunWithBinary(ctx, ctx.Env["GIT_BINARY"], append(
+		slices.Clone(args),
+		"diff", "--name-only", "-z", "--no-renames", "--diff-filter=d", from, commit,
+	)...)
+	if err != nil {
+		return fmt.Errorf("could not diff source from %q: %w", from, err)
+	}
+	var files []string
+	for file := range strings.SplitSeq(out, "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		log.WithField("from", from).Warn("no files changed, skipping diff archive")
+		return nil
+	}
+
+	filename := name + ".diff.tar.gz"
+	path := filepath.Join(ctx.Config.Dist, filename)
+	log.WithField("file", path).
+		WithField("from", from).
+		WithField("files", len(files)).
+		Info("creating source diff archive")
+
+	archive := append(slices.Clone(args), "archive", "--format", "tar.gz", "-o", path)
+	if prefix != "" {
+		archive = append(archive, "--prefix", prefix)
+	}
+	archive = append(archive, commit, "--")
+	archive = append(archive, files...)
+	if _, err := git.Clean(git.RunWithBinary(ctx, ctx.Env["GIT_BINARY"], archive...)); err != nil {
+		return err
+	}
+
+	// it is not a source archive, as other pipes expect a single one.
+	ctx.Artifacts.Add(&artifact.Artifact{
+		Type: artifact.UploadableFile,
+		Name: filename,
+		Path: path,
+		Extra: map[string]any{
+			artifact.ExtraFormat: "tar.gz",
+		},
+	})
+	return nil
+}
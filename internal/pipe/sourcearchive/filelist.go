@@ -0,0 +1,92 @@
+package sourcearchive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// writeFileList writes the list of entries of the archive, with their modes
+// and sizes, next to it, and adds it as a metadata artifact.
+// Each line is in the `<mode> <size> <path>` format, in the archive order.
+func writeFileList(ctx *context.Context, name, path, format string) error {
+	var buf bytes.Buffer
+	add := func(name string, mode fs.FileMode, size int64) {
+		fmt.Fprintf(&buf, "%s %d %s\n", mode, size, name)
+	}
+
+	var err error
+	if format == "zip" {
+		err = listZip(path, add)
+	} else {
+		err = listTar(path, format, add)
+	}
+	if err != nil {
+		return fmt.Errorf("could not list source archive files: %w", err)
+	}
+
+	filename := name + ".files.txt"
+	listPath := filepath.Join(ctx.Config.Dist, filename)
+	if err := os.WriteFile(listPath, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("could not write source archive file list: %w", err)
+	}
+	ctx.Artifacts.Add(&artifact.Artifact{
+		Type: artifact.Metadata,
+		Name: filename,
+		Path: listPath,
+	})
+	return nil
+}
+
+func listZip(path string, add func(string, fs.FileMode, int64)) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		add(f.Name, f.Mode(), int64(f.UncompressedSize64))
+	}
+	return nil
+}
+
+func listTar(path, format string, add func(string, fs.FileMode, int64)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if format != "tar" {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// the global header holds the commit id, and is not a file.
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		add(header.Name, header.FileInfo().Mode(), header.Size)
+	}
+}
@@ -0,0 +1,67 @@
+package sourcearchive
+
+import (
+	"fmt"
+
+	"github.com/caarlos0/log"
+	"github.com/goreleaser/go-shellwords"
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/internal/shell"
+	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// runPreArchiveHooks runs the source.pre_archive_hooks, before the archive
+// is created, e.g. to generate files to include in it.
+func runPreArchiveHooks(ctx *context.Context) error {
+	return runHooks(ctx, "pre archive", ctx.Config.Source.PreArchiveHooks, func() *tmpl.Template {
+		return tmpl.New(ctx)
+	})
+}
+
+// runPostArchiveHooks runs the source.post_archive_hooks, with the archive
+// available to the templates as the artifact.
+func runPostArchiveHooks(ctx *context.Context, a *artifact.Artifact) error {
+	return runHooks(ctx, "post archive", ctx.Config.Source.PostArchiveHooks, func() *tmpl.Template {
+		return tmpl.New(ctx).WithArtifact(a)
+	})
+}
+
+func runHooks(ctx *context.Context, kind string, hooks config.Hooks, newTemplate func() *tmpl.Template) error {
+	for _, hook := range hooks {
+		var envs []string
+		envs = append(envs, ctx.Env.Strings()...)
+
+		tpl := newTemplate()
+		for _, rawEnv := range hook.Env {
+			env, err := tpl.Apply(rawEnv)
+			if err != nil {
+				return fmt.Errorf("%s hook failed: %w", kind, err)
+			}
+			envs = append(envs, env)
+		}
+
+		tpl = tpl.WithEnvS(envs)
+		dir, err := tpl.Apply(hook.Dir)
+		if err != nil {
+			return fmt.Errorf("%s hook failed: %w", kind, err)
+		}
+
+		sh, err := tpl.Apply(hook.Cmd)
+		if err != nil {
+			return fmt.Errorf("%s hook failed: %w", kind, err)
+		}
+
+		log.WithField("hook", sh).Info("running hook")
+		cmd, err := shellwords.Parse(sh)
+		if err != nil {
+			return fmt.Errorf("%s hook failed: %w", kind, err)
+		}
+
+		if err := shell.Run(ctx, dir, cmd, envs, hook.Output); err != nil {
+			return fmt.Errorf("%s hook failed: %w", kind, err)
+		}
+	}
+	return nil
+}
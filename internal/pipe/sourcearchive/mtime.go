@@ -0,0 +1,177 @@
+package sourcearchive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// sourceDate returns the time the archive entries should be pinned to, and
+// whether it was explicitly set with SOURCE_DATE_EPOCH.
+// It falls back to the commit date, which may be zero.
+func sourceDate(ctx *context.Context) (time.Time, bool, error) {
+	epoch, ok := ctx.Env["SOURCE_DATE_EPOCH"]
+	if !ok || epoch == "" {
+		return ctx.Git.CommitDate, false, nil
+	}
+	sec, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid SOURCE_DATE_EPOCH: %w", err)
+	}
+	return time.Unix(sec, 0).UTC(), true, nil
+}
+
+// pinMTimes rewrites the given tar archive setting the modification time of
+// all its entries to mtime.
+// Zip archives are handled by normalizeZip instead.
+func pinMTimes(path, format string, mtime time.Time) error {
+	err := rewriteArchive(path, func(src *os.File, dst io.Writer) error {
+		if format == "tar" {
+			return pinTar(src, dst, mtime)
+		}
+		return pinTarGz(src, dst, mtime)
+	})
+	if err != nil {
+		return fmt.Errorf("could not set source archive mtimes: %w", err)
+	}
+	return nil
+}
+
+// normalizeZip rewrites the given zip archive so it is byte-identical across
+// runs: its entries are sorted by name, and their modification times set to
+// mtime, in UTC so the DOS times don't depend on the time zone.
+// The external attributes, i.e. the file modes, are zeroed if asked for.
+func normalizeZip(path string, mtime time.Time, zeroAttrs bool) error {
+	err := rewriteArchive(path, func(src *os.File, dst io.Writer) error {
+		return writeNormalizedZip(src, dst, mtime, zeroAttrs)
+	})
+	if err != nil {
+		return fmt.Errorf("could not normalize source archive: %w", err)
+	}
+	return nil
+}
+
+// rewriteArchive replaces the archive at path with the one written by fn.
+func rewriteArchive(path string, fn func(src *os.File, dst io.Writer) error) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open %q: %w", path, err)
+	}
+	defer src.Close()
+
+	tmp := path + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("could not create %q: %w", tmp, err)
+	}
+	defer os.Remove(tmp)
+	defer dst.Close()
+
+	if err := fn(src, dst); err != nil {
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("could not close %q: %w", tmp, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func pinTarGz(src io.Reader, dst io.Writer, mtime time.Time) error {
+	gr, err := gzip.NewReader(src)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	gw, err := gzip.NewWriterLevel(dst, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	gw.ModTime = mtime
+	if err := pinTar(gr, gw, mtime); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func pinTar(src io.Reader, dst io.Writer, mtime time.Time) error {
+	tr := tar.NewReader(src)
+	tw := tar.NewWriter(dst)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// the global header holds the commit id, and has no times.
+		if header.Typeflag != tar.TypeXGlobalHeader {
+			header.ModTime = mtime
+			header.AccessTime = time.Time{}
+			header.ChangeTime = time.Time{}
+			delete(header.PAXRecords, "mtime")
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeNormalizedZip(src *os.File, dst io.Writer, mtime time.Time, zeroAttrs bool) error {
+	s, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(src, s.Size())
+	if err != nil {
+		return err
+	}
+	files := slices.Clone(zr.File)
+	slices.SortFunc(files, func(a, b *zip.File) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	zw := zip.NewWriter(dst)
+	if err := zw.SetComment(zr.Comment); err != nil {
+		return err
+	}
+	for _, f := range files {
+		header := f.FileHeader
+		if !mtime.IsZero() {
+			header.Modified = mtime.UTC()
+		}
+		// drop the extended timestamps, they are set again from Modified.
+		header.Extra = nil
+		if zeroAttrs {
+			header.CreatorVersion = 0
+			header.ExternalAttrs = 0
+		}
+		w, err := zw.CreateHeader(&header)
+		if err != nil {
+			return err
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, r)
+		_ = r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -2,10 +2,16 @@
 package sourcearchive
 
 import (
+	stdzip "archive/zip"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/log"
 	"github.com/goreleaser/goreleaser/v2/internal/archivefiles"
@@ -14,6 +20,8 @@ import (
 	"github.com/goreleaser/goreleaser/v2/internal/git"
 	"github.com/goreleaser/goreleaser/v2/internal/tmpl"
 	"github.com/goreleaser/goreleaser/v2/pkg/archive"
+	"github.com/goreleaser/goreleaser/v2/pkg/archive/zip"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
 	"github.com/goreleaser/goreleaser/v2/pkg/context"
 )
 
@@ -34,51 +42,332 @@ func (Pipe) Run(ctx *context.Context) error {
 	if format != "zip" && format != "tar" && format != "tgz" && format != "tar.gz" {
 		return fmt.Errorf("invalid source archive format: %s", format)
 	}
-	name, err := tmpl.New(ctx).Apply(ctx.Config.Source.NameTemplate)
+	if m := ctx.Config.Source.ZipMethod; m != "" && m != zipMethodDeflate && m != zipMethodStore {
+		return fmt.Errorf("invalid source archive zip_method: %s", m)
+	}
+	name, err := tmpl.New(ctx).WithExtraFields(tmpl.Fields{
+		"Format": format,
+	}).Apply(ctx.Config.Source.NameTemplate)
 	if err != nil {
 		return err
 	}
 	filename := name + "." + format
 	path := filepath.Join(ctx.Config.Dist, filename)
 	log.WithField("file", path).Info("creating source archive")
-	args := []string{
-		"archive",
-		"-o", path,
+	args, err := gitArgs(ctx)
+	if err != nil {
+		return err
+	}
+	uncommitted := ctx.Config.Source.IncludeUncommitted
+	if uncommitted && ctx.Config.Source.Ref != "" {
+		return errors.New("source.ref can't be used with source.include_uncommitted")
+	}
+	if uncommitted && ctx.Config.Source.DiffFrom != "" {
+		return errors.New("source.diff_from can't be used with source.include_uncommitted")
+	}
+	if !uncommitted {
+		if err := checkShallow(ctx, args); err != nil {
+			return err
+		}
+	}
+	commit, err := sourceCommit(ctx, args)
+	if err != nil {
+		return err
 	}
 
 	prefix := ""
-	if ctx.Config.Source.PrefixTemplate != "" {
+	if ctx.Config.Source.PrefixTemplate != "" && !ctx.Config.Source.NoPrefix {
 		pt, err := tmpl.New(ctx).Apply(ctx.Config.Source.PrefixTemplate)
 		if err != nil {
 			return err
 		}
 		prefix = pt
-		args = append(args, "--prefix", prefix)
 	}
-	args = append(args, ctx.Git.FullCommit)
 
-	if _, err := git.Clean(git.Run(ctx, args...)); err != nil {
+	// the git options are kept, as args is replaced by the archive command
+	// below.
+	opts := args
+
+	mtime, pinned, err := sourceDate(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := runPreArchiveHooks(ctx); err != nil {
 		return err
 	}
 
-	if len(ctx.Config.Source.Files) > 0 {
-		if err := appendExtraFilesToArchive(ctx, prefix, path, format); err != nil {
+	// files added to the archive along with the configured ones.
+	var extra []config.File
+	if ctx.Config.Source.EmbedChangelog {
+		changelog, err := writeChangelog(ctx, opts, commit)
+		if err != nil {
 			return err
 		}
+		defer os.RemoveAll(filepath.Dir(changelog))
+		extra = append(extra, config.File{
+			Source:      changelog,
+			Destination: changelogFile,
+		})
 	}
 
-	ctx.Artifacts.Add(&artifact.Artifact{
+	// a cached archive is reused as it is, before any post archive hooks ran.
+	var key string
+	cached := false
+	if ctx.Config.Source.Cache {
+		if uncommitted {
+			return errors.New("source.cache can't be used with source.include_uncommitted")
+		}
+		key, err = cacheKey(ctx, opts, format, prefix, commit, mtime, extra...)
+		if err != nil {
+			return err
+		}
+		cached, err = restoreCache(ctx, key, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case cached:
+		args = gitArchiveArgs(ctx, args, path, prefix, commit)
+	case uncommitted:
+		args, err = archiveWorkTree(ctx, args, path, format, prefix, mtime)
+	default:
+		args, err = gitArchive(ctx, args, path, prefix, commit)
+	}
+	if err != nil {
+		return err
+	}
+
+	if ctx.Config.Source.WriteArchiveInfo {
+		if err := writeArchiveInfo(ctx, name, archiveInfo{
+			Args:   args,
+			Commit: commit,
+			Prefix: prefix,
+			Format: format,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if !cached {
+		if err := completeArchive(ctx, path, format, prefix, commit, mtime, pinned && !uncommitted, extra...); err != nil {
+			return err
+		}
+		if key != "" {
+			if err := storeCache(ctx, key, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	art := &artifact.Artifact{
 		Type: artifact.UploadableSourceArchive,
 		Name: filename,
 		Path: path,
 		Extra: map[string]any{
 			artifact.ExtraFormat: format,
 		},
+	}
+	ctx.Artifacts.Add(art)
+	if err := runPostArchiveHooks(ctx, art); err != nil {
+		return err
+	}
+	// listed after the hooks, as they might change the archive.
+	if ctx.Config.Source.FileList {
+		if err := writeFileList(ctx, name, path, format); err != nil {
+			return err
+		}
+	}
+	return diffArchive(ctx, opts, name, prefix, commit)
+}
+
+// gitArchive archives the given commit using git-archive, returning the git
+// arguments used.
+func gitArchive(ctx *context.Context, args []string, path, prefix, commit string) ([]string, error) {
+	args = gitArchiveArgs(ctx, args, path, prefix, commit)
+	if _, err := git.Clean(git.RunWithBinary(ctx, ctx.Env["GIT_BINARY"], args...)); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// gitArchiveArgs returns the git arguments to archive the given commit.
+func gitArchiveArgs(ctx *context.Context, args []string, path, prefix, commit string) []string {
+	args = append(slices.Clone(args), "archive", "-o", path)
+	if ctx.Config.Source.Format == "zip" && ctx.Config.Source.ZipMethod == zipMethodStore {
+		args = append(args, "-0")
+	}
+	if prefix != "" {
+		args = append(args, "--prefix", prefix)
+	}
+	return append(args, commit)
+}
+
+// completeArchive pins the modification times of the archive entries, if
+// asked for, and adds the given and configured extra files, info file and
+// vendored go modules to it.
+// Zip archives are then normalized, so they are reproducible.
+func completeArchive(ctx *context.Context, path, format, prefix, commit string, mtime time.Time, pin bool, extra ...config.File) error {
+	if format == "zip" {
+		if err := appendExtras(ctx, path, format, prefix, commit, mtime, extra...); err != nil {
+			return err
+		}
+		return normalizeZip(path, mtime, ctx.Config.Source.ZipZeroExternalAttrs)
+	}
+
+	// git-archive uses the commit date for the entries, so they only need
+	// to be rewritten if another date was asked for.
+	if pin {
+		if err := pinMTimes(path, format, mtime); err != nil {
+			return err
+		}
+	}
+	return appendExtras(ctx, path, format, prefix, commit, mtime, extra...)
+}
+
+// appendExtras adds the given and configured extra files, info file and
+// vendored go modules to the archive of the given commit.
+func appendExtras(ctx *context.Context, path, format, prefix, commit string, mtime time.Time, extra ...config.File) error {
+	if ctx.Config.Source.InfoFile != "" {
+		info, err := writeInfoFile(ctx, commit)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(filepath.Dir(info))
+		extra = append(extra, config.File{
+			Source:      info,
+			Destination: ctx.Config.Source.InfoFile,
+		})
+	}
+
+	if ctx.Config.Source.VendorGoModules {
+		dir, vendored, err := vendorGoModules(ctx)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		extra = append(extra, vendored...)
+	}
+
+	if len(ctx.Config.Source.Files) > 0 || len(extra) > 0 {
+		return appendExtraFilesToArchive(ctx, prefix, path, format, mtime, extra...)
+	}
+	return nil
+}
+
+// gitArgs returns the global git arguments for the configured git directory
+// and work tree, if any.
+func gitArgs(ctx *context.Context) ([]string, error) {
+	var args []string
+	for _, opt := range []struct {
+		flag, path string
+	}{
+		{"--git-dir", ctx.Config.Source.GitDir},
+		{"--work-tree", ctx.Config.Source.WorkTree},
+	} {
+		if opt.path == "" {
+			continue
+		}
+		if _, err := os.Stat(opt.path); err != nil {
+			return nil, fmt.Errorf("invalid source %s: %w", strings.TrimPrefix(opt.flag, "--"), err)
+		}
+		args = append(args, opt.flag, opt.path)
+	}
+	return args, nil
+}
+
+// sourceCommit returns the commit to archive: the configured ref, resolved to
+// a commit (dereferencing annotated tags), or the current commit.
+func sourceCommit(ctx *context.Context, args []string) (string, error) {
+	if ctx.Config.Source.Ref == "" {
+		return ctx.Git.FullCommit, nil
+	}
+	ref, err := tmpl.New(ctx).Apply(ctx.Config.Source.Ref)
+	if err != nil {
+		return "", err
+	}
+	commit, err := git.Clean(git.RunWithBinary(ctx, ctx.Env["GIT_BINARY"], append(slices.Clone(args), "rev-parse", "--verify", "--quiet", ref+"^{commit}")...))
+	if err != nil || commit == "" {
+		return "", fmt.Errorf("unknown source ref %q", ref)
+	}
+	return commit, nil
+}
+
+// checkShallow errors if the repository is a shallow clone, as archiving it
+// might fail or miss history, unless allowed by the configuration.
+func checkShallow(ctx *context.Context, args []string) error {
+	out, err := git.Clean(git.RunWithBinary(ctx, ctx.Env["GIT_BINARY"], append(slices.Clone(args), "rev-parse", "--is-shallow-repository")...))
+	if err != nil {
+		return err
+	}
+	if out != "true" {
+		return nil
+	}
+	if ctx.Config.Source.AllowShallow {
+		log.Warn("repository is a shallow clone, archiving the available tree")
+		return nil
+	}
+	return errors.New("source archives require the full git history, but the repository is a shallow clone: run 'git fetch --unshallow' or set 'source.allow_shallow'")
+}
+
+// archiveInfo records how the source archive was created, for reproducibility
+// audits.
+type archiveInfo struct {
+	Args   []string `json:"args"`
+	Commit string   `json:"commit"`
+	Prefix string   `json:"prefix"`
+	Format string   `json:"format"`
+}
+
+// writeArchiveInfo writes the archive info next to the archive, and adds it
+// as a metadata artifact.
+func writeArchiveInfo(ctx *context.Context, name string, info archiveInfo) error {
+	bts, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := name + ".archive-info.json"
+	path := filepath.Join(ctx.Config.Dist, filename)
+	if err := os.WriteFile(path, append(bts, '\n'), 0o644); err != nil {
+		return fmt.Errorf("could not write archive info: %w", err)
+	}
+	ctx.Artifacts.Add(&artifact.Artifact{
+		Type: artifact.Metadata,
+		Name: filename,
+		Path: path,
 	})
-	return err
+	return nil
 }
 
-func appendExtraFilesToArchive(ctx *context.Context, prefix, name, format string) error {
+const infoFileTemplate = `commit: {{ .FullCommit }}
+tag: {{ .Tag }}
+date: {{ .Date }}
+`
+
+// writeInfoFile writes the source info file of the archived commit, which is
+// not the current one when using source.ref, to a temporary directory,
+// returning its path.
+func writeInfoFile(ctx *context.Context, commit string) (string, error) {
+	content, err := tmpl.New(ctx).
+		WithExtraFields(tmpl.Fields{"FullCommit": commit}).
+		Apply(infoFileTemplate)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "goreleaser-source-info")
+	if err != nil {
+		return "", fmt.Errorf("could not create source info file: %w", err)
+	}
+	info := filepath.Join(dir, filepath.Base(ctx.Config.Source.InfoFile))
+	if err := os.WriteFile(info, []byte(content), 0o644); err != nil {
+		return "", fmt.Errorf("could not create source info file: %w", err)
+	}
+	return info, nil
+}
+
+func appendExtraFilesToArchive(ctx *context.Context, prefix, name, format string, mtime time.Time, extra ...config.File) error {
 	oldPath := name + ".bkp"
 	if err := gio.Copy(name, oldPath); err != nil {
 		return fmt.Errorf("failed make a backup of %q: %w", name, err)
@@ -98,7 +387,12 @@ func appendExtraFilesToArchive(ctx *context.Context, prefix, name, format string
 	}
 	defer af.Close()
 
-	arch, err := archive.Copy(of, af, format)
+	var arch archive.Archive
+	if format == "zip" {
+		arch, err = zip.CopyWithMethod(of, af, zipMethod(ctx))
+	} else {
+		arch, err = archive.Copy(of, af, format)
+	}
 	if err != nil {
 		return err
 	}
@@ -107,8 +401,11 @@ func appendExtraFilesToArchive(ctx *context.Context, prefix, name, format string
 	if err != nil {
 		return err
 	}
-	for _, f := range files {
+	for _, f := range append(files, extra...) {
 		f.Destination = path.Join(prefix, f.Destination)
+		if f.Info.ParsedMTime.IsZero() {
+			f.Info.ParsedMTime = mtime
+		}
 		if err := arch.Add(f); err != nil {
 			return fmt.Errorf("could not add %q to archive: %w", f.Source, err)
 		}
@@ -132,5 +429,23 @@ func (Pipe) Default(ctx *context.Context) error {
 	if archive.NameTemplate == "" {
 		archive.NameTemplate = "{{ .ProjectName }}-{{ .Version }}"
 	}
+	if archive.ZipMethod == "" {
+		archive.ZipMethod = zipMethodDeflate
+	}
 	return nil
 }
+
+// Compression methods of zip source archives.
+const (
+	zipMethodDeflate = "deflate"
+	zipMethodStore   = "store"
+)
+
+// zipMethod returns the compression method of the files in zip source
+// archives.
+func zipMethod(ctx *context.Context) uint16 {
+	if ctx.Config.Source.ZipMethod == zipMethodStore {
+		return stdzip.Store
+	}
+	return stdzip.Deflate
+}
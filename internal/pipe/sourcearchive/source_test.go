@@ -1,11 +1,24 @@
 package sourcearchive
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/internal/git"
 	"github.com/goreleaser/goreleaser/v2/internal/testctx"
 	"github.com/goreleaser/goreleaser/v2/internal/testlib"
 	"github.com/goreleaser/goreleaser/v2/pkg/config"
@@ -150,6 +163,1049 @@ func doVerifyTestArchive(tb testing.TB, ctx *context.Context, tmp, format string
 	require.Equal(tb, " (HEAD -> main, tag: v1.0.0)", string(version))
 }
 
+func TestArchiveGitDirAndWorkTree(t *testing.T) {
+	testlib.Mktmp(t)
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+
+	worktree := filepath.Join(t.TempDir(), "wt")
+	_, err := git.Run(t.Context(), "worktree", "add", worktree)
+	require.NoError(t, err)
+
+	// run from outside of the repository.
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	gitBin, err := exec.LookPath("git")
+	require.NoError(t, err)
+
+	newCtx := func(tb testing.TB, source config.Source) *context.Context {
+		tb.Helper()
+		source.Enabled = true
+		source.Format = "tar"
+		ctx := testctx.WrapWithCfg(tb.Context(), config.Project{
+			ProjectName: "foo",
+			Dist:        "dist",
+			Env:         []string{"GIT_BINARY=" + gitBin},
+			Source:      source,
+		}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.0.0"))
+		require.NoError(tb, Pipe{}.Default(ctx))
+		return ctx
+	}
+
+	t.Run("worktree", func(t *testing.T) {
+		ctx := newCtx(t, config.Source{
+			GitDir:   filepath.Join(worktree, ".git"),
+			WorkTree: worktree,
+		})
+		require.NoError(t, Pipe{}.Run(ctx))
+		require.Equal(t, []string{"code.txt"}, testlib.LsArchive(t, "dist/foo-1.0.0.tar", "tar"))
+	})
+
+	t.Run("missing git dir", func(t *testing.T) {
+		ctx := newCtx(t, config.Source{
+			GitDir: filepath.Join(worktree, "nope"),
+		})
+		require.ErrorIs(t, Pipe{}.Run(ctx), os.ErrNotExist)
+	})
+
+	t.Run("missing work tree", func(t *testing.T) {
+		ctx := newCtx(t, config.Source{
+			GitDir:   filepath.Join(worktree, ".git"),
+			WorkTree: filepath.Join(worktree, "nope"),
+		})
+		require.ErrorContains(t, Pipe{}.Run(ctx), "invalid source work-tree")
+	})
+
+	t.Run("invalid git binary", func(t *testing.T) {
+		ctx := newCtx(t, config.Source{
+			GitDir:   filepath.Join(worktree, ".git"),
+			WorkTree: worktree,
+		})
+		ctx.Env["GIT_BINARY"] = "/nope/git"
+		require.ErrorContains(t, Pipe{}.Run(ctx), "/nope/git")
+	})
+}
+
+func TestArchiveInfoFile(t *testing.T) {
+	for _, format := range []string{"tar.gz", "zip"} {
+		for _, useRef := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/ref=%v", format, useRef), func(t *testing.T) {
+				testlib.Mktmp(t)
+				require.NoError(t, os.Mkdir("dist", 0o744))
+				testlib.GitInit(t)
+				require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+				testlib.GitAdd(t)
+				testlib.GitCommit(t, "feat: first")
+				first, err := git.Clean(git.Run(t.Context(), "rev-parse", "HEAD"))
+				require.NoError(t, err)
+				testlib.GitCommit(t, "feat: second")
+				commit, err := git.Clean(git.Run(t.Context(), "rev-parse", "HEAD"))
+				require.NoError(t, err)
+
+				// the info file has the archived commit, not the current
+				// one.
+				ref, expected := "", commit
+				if useRef {
+					ref, expected = first, first
+				}
+				ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+					ProjectName: "foo",
+					Dist:        "dist",
+					Source: config.Source{
+						Format:         format,
+						Enabled:        true,
+						PrefixTemplate: "{{ .ProjectName }}-{{ .Version }}/",
+						InfoFile:       "SOURCE_INFO",
+						Ref:            ref,
+					},
+				},
+					testctx.WithCommit(commit),
+					testctx.WithVersion("1.0.0"),
+					testctx.WithCurrentTag("v1.0.0"))
+				require.NoError(t, Pipe{}.Default(ctx))
+				require.NoError(t, Pipe{}.Run(ctx))
+
+				path := "dist/foo-1.0.0." + format
+				require.ElementsMatch(t, []string{
+					"foo-1.0.0/",
+					"foo-1.0.0/code.txt",
+					"foo-1.0.0/SOURCE_INFO",
+				}, testlib.LsArchive(t, path, format))
+				info := string(testlib.GetFileFromArchive(t, path, format, "foo-1.0.0/SOURCE_INFO"))
+				require.Contains(t, info, "commit: "+expected+"\n")
+				require.Contains(t, info, "tag: v1.0.0\n")
+			})
+		}
+	}
+}
+
+func TestArchiveTemplatedFileDestination(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+	commit, err := git.Clean(git.Run(t.Context(), "rev-parse", "HEAD"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile("x", []byte("vendored"), 0o655))
+
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		ProjectName: "foo",
+		Dist:        "dist",
+		Source: config.Source{
+			Format:         "tar.gz",
+			Enabled:        true,
+			PrefixTemplate: "{{ .ProjectName }}-{{ .Version }}/",
+			Files: []config.File{{
+				Source:      "x",
+				Destination: "vendor/{{ .Version }}/x",
+			}},
+		},
+	},
+		testctx.WithCommit(commit),
+		testctx.WithVersion("1.0.0"),
+		testctx.WithCurrentTag("v1.0.0"))
+	require.NoError(t, Pipe{}.Default(ctx))
+	require.NoError(t, Pipe{}.Run(ctx))
+
+	path := "dist/foo-1.0.0.tar.gz"
+	require.ElementsMatch(t, []string{
+		"foo-1.0.0/",
+		"foo-1.0.0/code.txt",
+		"foo-1.0.0/vendor/1.0.0/x",
+	}, testlib.LsArchive(t, path, "tar.gz"))
+	require.Equal(t, "vendored", string(testlib.GetFileFromArchive(t, path, "tar.gz", "foo-1.0.0/vendor/1.0.0/x")))
+}
+
+func TestArchiveRef(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("first"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+	testlib.GitAnnotatedTag(t, "v1.0.0", "first release")
+	require.NoError(t, os.WriteFile("code.txt", []byte("second"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: second")
+	commit, err := git.Clean(git.Run(t.Context(), "rev-parse", "HEAD"))
+	require.NoError(t, err)
+
+	newCtx := func(t *testing.T, ref string) *context.Context {
+		t.Helper()
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			ProjectName: "foo",
+			Dist:        "dist",
+			Source: config.Source{
+				Format:  "tar.gz",
+				Enabled: true,
+				Ref:     ref,
+			},
+		}, testctx.WithCommit(commit), testctx.WithVersion("1.0.0"))
+		require.NoError(t, Pipe{}.Default(ctx))
+		return ctx
+	}
+
+	t.Run("annotated tag", func(t *testing.T) {
+		require.NoError(t, Pipe{}.Run(newCtx(t, "v1.0.0")))
+		require.Equal(t, "first", string(testlib.GetFileFromArchive(t, "dist/foo-1.0.0.tar.gz", "tar.gz", "code.txt")))
+	})
+
+	t.Run("unknown tag", func(t *testing.T) {
+		require.EqualError(t, Pipe{}.Run(newCtx(t, "v9.9.9")), `unknown source ref "v9.9.9"`)
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		testlib.RequireTemplateError(t, Pipe{}.Run(newCtx(t, "{{ .Nope }")))
+	})
+}
+
+func TestArchiveWriteArchiveInfo(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+	commit, err := git.Clean(git.Run(t.Context(), "rev-parse", "HEAD"))
+	require.NoError(t, err)
+
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		ProjectName: "foo",
+		Dist:        "dist",
+		Source: config.Source{
+			Format:           "tar.gz",
+			Enabled:          true,
+			PrefixTemplate:   "{{ .ProjectName }}-{{ .Version }}/",
+			WriteArchiveInfo: true,
+		},
+	}, testctx.WithCommit(commit), testctx.WithVersion("1.0.0"))
+	require.NoError(t, Pipe{}.Default(ctx))
+	require.NoError(t, Pipe{}.Run(ctx))
+
+	bts, err := os.ReadFile("dist/foo-1.0.0.archive-info.json")
+	require.NoError(t, err)
+	var info archiveInfo
+	require.NoError(t, json.Unmarshal(bts, &info))
+	require.Equal(t, commit, info.Commit)
+	require.Equal(t, "foo-1.0.0/", info.Prefix)
+	require.Equal(t, "tar.gz", info.Format)
+	require.Equal(t, []string{
+		"archive",
+		"-o", filepath.Join("dist", "foo-1.0.0.tar.gz"),
+		"--prefix", "foo-1.0.0/",
+		commit,
+	}, info.Args)
+
+	metadata := ctx.Artifacts.Filter(artifact.ByType(artifact.Metadata)).List()
+	require.Len(t, metadata, 1)
+	require.Equal(t, "foo-1.0.0.archive-info.json", metadata[0].Name)
+}
+
+func TestArchiveIncludeUncommitted(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile(".gitignore", []byte("*.log\n"), 0o655))
+	require.NoError(t, os.WriteFile("code.txt", []byte("committed"), 0o655))
+	require.NoError(t, os.WriteFile("deleted.txt", []byte("deleted"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+	commit, err := git.Clean(git.Run(t.Context(), "rev-parse", "HEAD"))
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile("code.txt", []byte("changed"), 0o655))
+	require.NoError(t, os.Remove("deleted.txt"))
+	require.NoError(t, os.MkdirAll("sub", 0o755))
+	require.NoError(t, os.WriteFile("sub/new.txt", []byte("untracked"), 0o655))
+	require.NoError(t, os.WriteFile("debug.log", []byte("ignored"), 0o655))
+
+	for _, format := range []string{"tar.gz", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+				ProjectName: "foo",
+				Dist:        "dist",
+				Source: config.Source{
+					Format:             format,
+					Enabled:            true,
+					PrefixTemplate:     "{{ .ProjectName }}/",
+					IncludeUncommitted: true,
+				},
+			}, testctx.WithCommit(commit), testctx.WithVersion("1.0.0"))
+			require.NoError(t, Pipe{}.Default(ctx))
+			require.NoError(t, Pipe{}.Run(ctx))
+
+			archive := "dist/foo-1.0.0." + format
+			require.ElementsMatch(t, []string{
+				"foo/.gitignore",
+				"foo/code.txt",
+				"foo/sub/new.txt",
+			}, testlib.LsArchive(t, archive, format))
+			require.Equal(t, "changed", string(testlib.GetFileFromArchive(t, archive, format, "foo/code.txt")))
+		})
+	}
+
+	t.Run("with ref", func(t *testing.T) {
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			ProjectName: "foo",
+			Dist:        "dist",
+			Source: config.Source{
+				Format:             "tar.gz",
+				Enabled:            true,
+				Ref:                "HEAD",
+				IncludeUncommitted: true,
+			},
+		}, testctx.WithCommit(commit), testctx.WithVersion("1.0.0"))
+		require.NoError(t, Pipe{}.Default(ctx))
+		require.EqualError(t, Pipe{}.Run(ctx), "source.ref can't be used with source.include_uncommitted")
+	})
+}
+
+func TestIsGitDir(t *testing.T) {
+	require.True(t, isGitDir(".git/config"))
+	require.True(t, isGitDir("vendor/foo/.git/HEAD"))
+	require.False(t, isGitDir(".github/workflows/ci.yml"))
+	require.False(t, isGitDir(".gitignore"))
+}
+
+func TestArchiveShallowClone(t *testing.T) {
+	origin := testlib.Mktmp(t)
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+	require.NoError(t, os.WriteFile("code.txt", []byte("still not code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: second")
+
+	folder := t.TempDir()
+	require.NoError(t, exec.CommandContext(
+		t.Context(),
+		"git", "clone", "--depth", "1", "file://"+filepath.ToSlash(origin), folder,
+	).Run())
+	t.Chdir(folder)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	commit, err := git.Clean(git.Run(t.Context(), "rev-parse", "HEAD"))
+	require.NoError(t, err)
+
+	newCtx := func(t *testing.T, allow bool) *context.Context {
+		t.Helper()
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			ProjectName: "foo",
+			Dist:        "dist",
+			Source: config.Source{
+				Format:       "tar.gz",
+				Enabled:      true,
+				AllowShallow: allow,
+			},
+		}, testctx.WithCommit(commit), testctx.WithVersion("1.0.0"))
+		require.NoError(t, Pipe{}.Default(ctx))
+		return ctx
+	}
+
+	t.Run("not allowed", func(t *testing.T) {
+		require.ErrorContains(t, Pipe{}.Run(newCtx(t, false)), "git fetch --unshallow")
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		ctx := newCtx(t, true)
+		require.NoError(t, Pipe{}.Run(ctx))
+		path := "dist/foo-1.0.0.tar.gz"
+		require.Equal(t, []string{"code.txt"}, testlib.LsArchive(t, path, "tar.gz"))
+		require.Equal(t, "still not code", string(testlib.GetFileFromArchive(t, path, "tar.gz", "code.txt")))
+	})
+}
+
+func TestArchiveNameWithShortCommit(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+	short, err := git.Clean(git.Run(t.Context(), "rev-parse", "--short", "HEAD"))
+	require.NoError(t, err)
+
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		ProjectName: "proj",
+		Dist:        "dist",
+		Source: config.Source{
+			Enabled:      true,
+			NameTemplate: "{{ .ProjectName }}-{{ .Version }}-{{ .ShortCommit }}",
+		},
+	}, testctx.WithVersion("1.0"), testctx.WithGitInfo(context.GitInfo{
+		FullCommit:  "HEAD",
+		ShortCommit: short,
+	}))
+	require.NoError(t, Pipe{}.Default(ctx))
+	require.NoError(t, Pipe{}.Run(ctx))
+
+	artifacts := ctx.Artifacts.List()
+	require.Len(t, artifacts, 1)
+	require.Equal(t, "proj-1.0-"+short+".tar.gz", artifacts[0].Name)
+	require.FileExists(t, filepath.Join("dist", artifacts[0].Name))
+}
+
+func TestArchiveNameWithFormat(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+
+	for _, format := range []string{"tar.gz", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+				ProjectName: "proj",
+				Dist:        "dist",
+				Source: config.Source{
+					Enabled:      true,
+					Format:       format,
+					NameTemplate: "{{ .ProjectName }}-{{ .Version }}-src-{{ .Format }}",
+				},
+			}, testctx.WithVersion("1.0"), testctx.WithCommit("HEAD"))
+			require.NoError(t, Pipe{}.Default(ctx))
+			require.NoError(t, Pipe{}.Run(ctx))
+
+			artifacts := ctx.Artifacts.List()
+			require.Len(t, artifacts, 1)
+			require.Equal(t, "proj-1.0-src-"+format+"."+format, artifacts[0].Name)
+			require.FileExists(t, filepath.Join("dist", artifacts[0].Name))
+		})
+	}
+}
+
+func TestArchiveNoPrefix(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+
+	for name, tt := range map[string]struct {
+		source   config.Source
+		expected []string
+	}{
+		"default": {
+			source:   config.Source{Enabled: true},
+			expected: []string{"code.txt"},
+		},
+		"prefix": {
+			source: config.Source{
+				Enabled:        true,
+				PrefixTemplate: "{{ .ProjectName }}-{{ .Version }}/",
+			},
+			expected: []string{"foo-1.0.0/", "foo-1.0.0/code.txt"},
+		},
+		"no prefix": {
+			source: config.Source{
+				Enabled:        true,
+				PrefixTemplate: "{{ .ProjectName }}-{{ .Version }}/",
+				NoPrefix:       true,
+			},
+			expected: []string{"code.txt"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+				ProjectName: "foo",
+				Dist:        "dist",
+				Source:      tt.source,
+			}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.0.0"))
+			require.NoError(t, Pipe{}.Default(ctx))
+			require.NoError(t, Pipe{}.Run(ctx))
+
+			artifacts := ctx.Artifacts.List()
+			require.Len(t, artifacts, 1)
+			require.ElementsMatch(t, tt.expected, testlib.LsArchive(t, artifacts[0].Path, "tar.gz"))
+		})
+	}
+}
+
+func TestArchivePostArchiveHooks(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+
+	out := t.TempDir()
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		ProjectName: "foo",
+		Dist:        "dist",
+		Source: config.Source{
+			Enabled: true,
+			PostArchiveHooks: config.Hooks{
+				{
+					Cmd: "cp {{ .ArtifactPath }} {{ .Env.DEST }}/{{ .ArtifactName }}",
+					Env: []string{"DEST=" + out},
+				},
+			},
+		},
+	}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.0.0"))
+	require.NoError(t, Pipe{}.Default(ctx))
+	require.NoError(t, Pipe{}.Run(ctx))
+
+	artifacts := ctx.Artifacts.List()
+	require.Len(t, artifacts, 1)
+	expected, err := os.ReadFile(artifacts[0].Path)
+	require.NoError(t, err)
+	got, err := os.ReadFile(filepath.Join(out, artifacts[0].Name))
+	require.NoError(t, err)
+	require.Equal(t, expected, got)
+
+	t.Run("failing", func(t *testing.T) {
+		ctx.Config.Source.PostArchiveHooks = config.Hooks{{Cmd: "false"}}
+		require.ErrorContains(t, Pipe{}.Run(ctx), "post archive hook failed")
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		ctx.Config.Source.PostArchiveHooks = config.Hooks{{Cmd: "echo {{ .Nope }"}}
+		testlib.RequireTemplateError(t, Pipe{}.Run(ctx))
+	})
+}
+
+func TestArchivePreArchiveHooks(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	require.NoError(t, os.Mkdir("proto", 0o755))
+	require.NoError(t, os.WriteFile("proto/.gitkeep", nil, 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		ProjectName: "foo",
+		Dist:        "dist",
+		Source: config.Source{
+			Enabled:            true,
+			IncludeUncommitted: true,
+			PreArchiveHooks: config.Hooks{
+				{
+					Cmd: "touch {{ .Env.GENERATED }}",
+					Dir: "proto",
+					Env: []string{"GENERATED=api.pb.go"},
+				},
+			},
+		},
+	}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.0.0"))
+	require.NoError(t, Pipe{}.Default(ctx))
+	require.NoError(t, Pipe{}.Run(ctx))
+
+	artifacts := ctx.Artifacts.List()
+	require.Len(t, artifacts, 1)
+	require.ElementsMatch(t, []string{
+		"code.txt",
+		"proto/.gitkeep",
+		"proto/api.pb.go",
+	}, testlib.LsArchive(t, artifacts[0].Path, "tar.gz"))
+
+	t.Run("failing", func(t *testing.T) {
+		ctx.Config.Source.PreArchiveHooks = config.Hooks{{Cmd: "false"}}
+		require.ErrorContains(t, Pipe{}.Run(ctx), "pre archive hook failed")
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		ctx.Config.Source.PreArchiveHooks = config.Hooks{{Cmd: "echo {{ .Nope }"}}
+		testlib.RequireTemplateError(t, Pipe{}.Run(ctx))
+	})
+}
+
+func TestArchiveVendorGoModules(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("go.mod", []byte("module example.com/foo\n\ngo 1.21\n\nrequire example.com/dep v0.0.0\n\nreplace example.com/dep => ./dep\n"), 0o644))
+	require.NoError(t, os.WriteFile("main.go", []byte("package main\n\nimport _ \"example.com/dep\"\n\nfunc main() {}\n"), 0o644))
+	require.NoError(t, os.Mkdir("dep", 0o755))
+	require.NoError(t, os.WriteFile("dep/go.mod", []byte("module example.com/dep\n\ngo 1.21\n"), 0o644))
+	require.NoError(t, os.WriteFile("dep/dep.go", []byte("package dep\n"), 0o644))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		ProjectName: "foo",
+		Dist:        "dist",
+		Env:         []string{"GOTOOLCHAIN=local", "HOME=" + t.TempDir()},
+		Source: config.Source{
+			Enabled:         true,
+			PrefixTemplate:  "{{ .ProjectName }}-{{ .Version }}/",
+			VendorGoModules: true,
+		},
+	}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.0.0"))
+	require.NoError(t, Pipe{}.Default(ctx))
+	require.NoError(t, Pipe{}.Run(ctx))
+
+	artifacts := ctx.Artifacts.List()
+	require.Len(t, artifacts, 1)
+	files := testlib.LsArchive(t, artifacts[0].Path, "tar.gz")
+	require.Contains(t, files, "foo-1.0.0/vendor/modules.txt")
+	require.Contains(t, files, "foo-1.0.0/vendor/example.com/dep/dep.go")
+
+	t.Run("not a go module", func(t *testing.T) {
+		require.NoError(t, os.Remove("go.mod"))
+		require.ErrorContains(t, Pipe{}.Run(ctx), "requires a go module")
+	})
+}
+
+func TestArchiveEmbedChangelog(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+	testlib.GitTag(t, "v0.1.0")
+	require.NoError(t, os.WriteFile("code.txt", []byte("still not really code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "fix: second")
+	commit, err := git.Clean(git.Run(t.Context(), "rev-parse", "HEAD"))
+	require.NoError(t, err)
+
+	newCtx := func(tb testing.TB) *context.Context {
+		tb.Helper()
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			ProjectName: "foo",
+			Dist:        "dist",
+			Source: config.Source{
+				Enabled:        true,
+				PrefixTemplate: "{{ .ProjectName }}-{{ .Version }}/",
+				EmbedChangelog: true,
+			},
+		}, testctx.WithCommit(commit), testctx.WithVersion("1.0.0"), testctx.WithPreviousTag("v0.1.0"))
+		require.NoError(tb, Pipe{}.Default(ctx))
+		return ctx
+	}
+
+	t.Run("release notes", func(t *testing.T) {
+		ctx := newCtx(t)
+		ctx.ReleaseNotes = "## Changelog\n\n* fix: second\n"
+		require.NoError(t, Pipe{}.Run(ctx))
+		changelog := string(testlib.GetFileFromArchive(t, "dist/foo-1.0.0.tar.gz", "tar.gz", "foo-1.0.0/CHANGELOG.md"))
+		require.Equal(t, "## Changelog\n\n* fix: second\n", changelog)
+	})
+
+	t.Run("git log", func(t *testing.T) {
+		require.NoError(t, Pipe{}.Run(newCtx(t)))
+		changelog := string(testlib.GetFileFromArchive(t, "dist/foo-1.0.0.tar.gz", "tar.gz", "foo-1.0.0/CHANGELOG.md"))
+		require.Contains(t, changelog, commit+" fix: second")
+		require.NotContains(t, changelog, "feat: first")
+	})
+}
+
+func TestArchiveFileList(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o644))
+	require.NoError(t, os.Mkdir("bin", 0o755))
+	require.NoError(t, os.WriteFile("bin/run.sh", []byte("#!/bin/sh\n"), 0o755))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+
+	for _, format := range []string{"tar.gz", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+				ProjectName: "foo",
+				Dist:        "dist",
+				Source: config.Source{
+					Format:         format,
+					Enabled:        true,
+					PrefixTemplate: "{{ .ProjectName }}-{{ .Version }}/",
+					FileList:       true,
+				},
+			}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.0.0"))
+			require.NoError(t, Pipe{}.Default(ctx))
+			require.NoError(t, Pipe{}.Run(ctx))
+
+			bts, err := os.ReadFile("dist/foo-1.0.0.files.txt")
+			require.NoError(t, err)
+			var names []string
+			modes := map[string]string{}
+			sizes := map[string]string{}
+			for line := range strings.Lines(string(bts)) {
+				mode, rest, _ := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+				size, name, _ := strings.Cut(rest, " ")
+				names = append(names, name)
+				modes[name] = mode
+				sizes[name] = size
+			}
+			require.Equal(t, testlib.LsArchive(t, "dist/foo-1.0.0."+format, format), names)
+			require.Equal(t, "15", sizes["foo-1.0.0/code.txt"])
+			require.Equal(t, "10", sizes["foo-1.0.0/bin/run.sh"])
+			// the permissions depend on the git-archive umask, which differs
+			// between formats.
+			require.True(t, strings.HasPrefix(modes["foo-1.0.0/code.txt"], "-rw-"), modes)
+			require.True(t, strings.HasPrefix(modes["foo-1.0.0/bin/run.sh"], "-rwx"), modes)
+			require.True(t, strings.HasPrefix(modes["foo-1.0.0/bin/"], "d"), modes)
+
+			metadata := ctx.Artifacts.Filter(artifact.ByType(artifact.Metadata)).List()
+			require.Len(t, metadata, 1)
+			require.Equal(t, "foo-1.0.0.files.txt", metadata[0].Name)
+		})
+	}
+}
+
+func TestArchiveDiffFrom(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	require.NoError(t, os.WriteFile("gone.txt", []byte("bye"), 0o655))
+	require.NoError(t, os.WriteFile("same.txt", []byte("same"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+	testlib.GitTag(t, "v1.0.0")
+	require.NoError(t, os.WriteFile("code.txt", []byte("changed code"), 0o655))
+	require.NoError(t, os.WriteFile("new.txt", []byte("new"), 0o655))
+	require.NoError(t, os.Remove("gone.txt"))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: second")
+
+	newCtx := func(tb testing.TB, from string) *context.Context {
+		tb.Helper()
+		return testctx.WrapWithCfg(tb.Context(), config.Project{
+			ProjectName: "foo",
+			Dist:        "dist",
+			Source: config.Source{
+				Enabled:        true,
+				PrefixTemplate: "{{ .ProjectName }}-{{ .Version }}/",
+				DiffFrom:       from,
+			},
+		}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.1.0"), testctx.WithPreviousTag("v1.0.0"))
+	}
+
+	t.Run("changed files", func(t *testing.T) {
+		ctx := newCtx(t, "{{ .PreviousTag }}")
+		require.NoError(t, Pipe{}.Default(ctx))
+		require.NoError(t, Pipe{}.Run(ctx))
+
+		require.Len(t, ctx.Artifacts.Filter(artifact.ByType(artifact.UploadableSourceArchive)).List(), 1)
+		diffs := ctx.Artifacts.Filter(artifact.ByType(artifact.UploadableFile)).List()
+		require.Len(t, diffs, 1)
+		require.Equal(t, "foo-1.1.0.diff.tar.gz", diffs[0].Name)
+		require.ElementsMatch(t, []string{
+			"foo-1.1.0/",
+			"foo-1.1.0/code.txt",
+			"foo-1.1.0/new.txt",
+		}, testlib.LsArchive(t, diffs[0].Path, "tar.gz"))
+	})
+
+	t.Run("nothing changed", func(t *testing.T) {
+		ctx := newCtx(t, "HEAD")
+		require.NoError(t, Pipe{}.Default(ctx))
+		require.NoError(t, Pipe{}.Run(ctx))
+		require.Empty(t, ctx.Artifacts.Filter(artifact.ByType(artifact.UploadableFile)).List())
+	})
+
+	t.Run("unknown ref", func(t *testing.T) {
+		ctx := newCtx(t, "v0.0.1")
+		require.NoError(t, Pipe{}.Default(ctx))
+		require.ErrorContains(t, Pipe{}.Run(ctx), `could not diff source from "v0.0.1"`)
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		ctx := newCtx(t, "{{ .Nope }")
+		require.NoError(t, Pipe{}.Default(ctx))
+		testlib.RequireTemplateError(t, Pipe{}.Run(ctx))
+	})
+
+	t.Run("include uncommitted", func(t *testing.T) {
+		ctx := newCtx(t, "v1.0.0")
+		ctx.Config.Source.IncludeUncommitted = true
+		require.NoError(t, Pipe{}.Default(ctx))
+		require.EqualError(t, Pipe{}.Run(ctx), "source.diff_from can't be used with source.include_uncommitted")
+	})
+}
+
+func TestArchiveCache(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+	require.NoError(t, os.WriteFile("EXTRA.md", []byte("extra"), 0o655))
+
+	// wraps git to record whether git archive ran.
+	gitBin, err := exec.LookPath("git")
+	require.NoError(t, err)
+	calls := filepath.Join(t.TempDir(), "calls")
+	wrapper := filepath.Join(t.TempDir(), "git")
+	require.NoError(t, os.WriteFile(wrapper, []byte("#!/bin/sh\necho \"$*\" >> "+calls+"\nexec "+gitBin+" \"$@\"\n"), 0o755))
+	archived := func(tb testing.TB) bool {
+		tb.Helper()
+		bts, err := os.ReadFile(calls)
+		require.NoError(tb, err)
+		require.NoError(tb, os.Remove(calls))
+		return strings.Contains(string(bts), " archive ")
+	}
+
+	// the info file has the release date, which changes on every run.
+	date := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	run := func(tb testing.TB) {
+		tb.Helper()
+		date = date.Add(time.Hour)
+		ctx := testctx.WrapWithCfg(tb.Context(), config.Project{
+			ProjectName: "foo",
+			Dist:        "dist",
+			Env:         []string{"GIT_BINARY=" + wrapper},
+			Source: config.Source{
+				Enabled:  true,
+				Cache:    true,
+				Files:    []config.File{{Source: "EXTRA.md", Destination: "EXTRA.md"}},
+				InfoFile: "SOURCE_INFO",
+			},
+		}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.0.0"), testctx.WithDate(date))
+		require.NoError(tb, Pipe{}.Default(ctx))
+		require.NoError(tb, Pipe{}.Run(ctx))
+		require.ElementsMatch(tb, []string{"code.txt", "EXTRA.md", "SOURCE_INFO"}, testlib.LsArchive(tb, "dist/foo-1.0.0.tar.gz", "tar.gz"))
+		require.NoError(tb, os.Remove("dist/foo-1.0.0.tar.gz"))
+	}
+
+	run(t)
+	require.True(t, archived(t), "first run should archive")
+
+	run(t)
+	require.False(t, archived(t), "second run should reuse the cached archive")
+
+	require.NoError(t, os.WriteFile("EXTRA.md", []byte("changed"), 0o655))
+	run(t)
+	require.True(t, archived(t), "changed files should invalidate the cache")
+
+	t.Run("include uncommitted", func(t *testing.T) {
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			ProjectName: "foo",
+			Dist:        "dist",
+			Source: config.Source{
+				Enabled:            true,
+				Cache:              true,
+				IncludeUncommitted: true,
+			},
+		}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.0.0"))
+		require.NoError(t, Pipe{}.Default(ctx))
+		require.EqualError(t, Pipe{}.Run(ctx), "source.cache can't be used with source.include_uncommitted")
+	})
+}
+
+func TestArchiveZipMethod(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	// compressible enough for git to deflate it.
+	require.NoError(t, os.WriteFile("code.txt", bytes.Repeat([]byte("not really code\n"), 100), 0o655))
+	require.NoError(t, os.WriteFile(".gitignore", []byte("extra.txt\n"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+	require.NoError(t, os.WriteFile("extra.txt", []byte("an extra file"), 0o655))
+
+	for _, method := range []struct {
+		name     string
+		expected uint16
+	}{
+		{"deflate", zip.Deflate},
+		{"store", zip.Store},
+	} {
+		for name, source := range map[string]config.Source{
+			"git archive": {},
+			"extra files": {Files: []config.File{{Source: "extra.txt"}}},
+			"uncommitted": {IncludeUncommitted: true},
+		} {
+			t.Run(method.name+" "+name, func(t *testing.T) {
+				source.Enabled = true
+				source.Format = "zip"
+				source.ZipMethod = method.name
+				ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+					ProjectName: "foo",
+					Dist:        "dist",
+					Source:      source,
+				}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.0.0"))
+				require.NoError(t, Pipe{}.Default(ctx))
+				require.NoError(t, Pipe{}.Run(ctx))
+
+				artifacts := ctx.Artifacts.List()
+				require.Len(t, artifacts, 1)
+				r, err := zip.OpenReader(artifacts[0].Path)
+				require.NoError(t, err)
+				t.Cleanup(func() { _ = r.Close() })
+				var found bool
+				for _, f := range r.File {
+					if f.Name == "code.txt" {
+						found = true
+						require.Equal(t, method.expected, f.Method)
+					}
+				}
+				require.True(t, found)
+			})
+		}
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			Dist: "dist",
+			Source: config.Source{
+				Enabled:   true,
+				Format:    "zip",
+				ZipMethod: "bzip2",
+			},
+		})
+		require.EqualError(t, Pipe{}.Run(ctx), "invalid source archive zip_method: bzip2")
+	})
+}
+
+func TestArchiveReproducibleZip(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	require.NoError(t, os.Mkdir("src", 0o755))
+	require.NoError(t, os.WriteFile("src/main.go", []byte("package main"), 0o644))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+	require.NoError(t, os.WriteFile("a-extra.txt", []byte("extra"), 0o655))
+
+	run := func(tb testing.TB, zeroAttrs bool) string {
+		tb.Helper()
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			ProjectName: "foo",
+			Dist:        "dist",
+			Source: config.Source{
+				Enabled:              true,
+				Format:               "zip",
+				PrefixTemplate:       "{{ .ProjectName }}/",
+				InfoFile:             "SOURCE_INFO",
+				Files:                []config.File{{Source: "a-extra.txt"}},
+				ZipZeroExternalAttrs: zeroAttrs,
+			},
+		}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.0.0"), testctx.WithCommitDate(time.Unix(1700000000, 0).In(time.FixedZone("X", 3600))))
+		require.NoError(tb, Pipe{}.Default(ctx))
+		require.NoError(tb, Pipe{}.Run(ctx))
+		bts, err := os.ReadFile("dist/foo-1.0.0.zip")
+		require.NoError(tb, err)
+		return fmt.Sprintf("%x", sha256.Sum256(bts))
+	}
+
+	first := run(t, false)
+	// extra files modification times don't matter.
+	require.NoError(t, os.Chtimes("a-extra.txt", time.Now(), time.Now().Add(-time.Hour)))
+	require.Equal(t, first, run(t, false))
+
+	zr, err := zip.OpenReader("dist/foo-1.0.0.zip")
+	require.NoError(t, err)
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		require.Equal(t, time.Unix(1700000000, 0).UTC(), f.Modified.UTC(), f.Name)
+	}
+	require.NoError(t, zr.Close())
+	require.True(t, slices.IsSorted(names), names)
+	require.Contains(t, names, "foo/a-extra.txt")
+
+	t.Run("zero external attrs", func(t *testing.T) {
+		sum := run(t, true)
+		require.NotEqual(t, first, sum)
+		require.Equal(t, sum, run(t, true))
+
+		zr, err := zip.OpenReader("dist/foo-1.0.0.zip")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = zr.Close() })
+		for _, f := range zr.File {
+			require.Zero(t, f.ExternalAttrs, f.Name)
+		}
+	})
+}
+
+func TestArchiveSourceDateEpoch(t *testing.T) {
+	testlib.Mktmp(t)
+	require.NoError(t, os.Mkdir("dist", 0o744))
+	testlib.GitInit(t)
+	require.NoError(t, os.WriteFile("code.txt", []byte("not really code"), 0o655))
+	testlib.GitAdd(t)
+	testlib.GitCommit(t, "feat: first")
+	require.NoError(t, os.WriteFile("extra.txt", []byte("extra"), 0o655))
+
+	epoch := time.Unix(1700000000, 0).UTC()
+	for _, format := range []string{"tar", "tar.gz", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+				ProjectName: "foo",
+				Dist:        "dist",
+				Env:         []string{"SOURCE_DATE_EPOCH=1700000000"},
+				Source: config.Source{
+					Format:         format,
+					Enabled:        true,
+					PrefixTemplate: "{{ .ProjectName }}/",
+					Files:          []config.File{{Source: "extra.txt"}},
+				},
+			}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.0.0"))
+			require.NoError(t, Pipe{}.Default(ctx))
+			require.NoError(t, Pipe{}.Run(ctx))
+
+			mtimes := archiveMTimes(t, "dist/foo-1.0.0."+format, format)
+			require.Len(t, mtimes, 3)
+			for name, mtime := range mtimes {
+				require.True(t, epoch.Equal(mtime), "%s: %s", name, mtime)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			ProjectName: "foo",
+			Dist:        "dist",
+			Env:         []string{"SOURCE_DATE_EPOCH=nope"},
+			Source:      config.Source{Enabled: true},
+		}, testctx.WithCommit("HEAD"), testctx.WithVersion("1.0.0"))
+		require.NoError(t, Pipe{}.Default(ctx))
+		require.ErrorContains(t, Pipe{}.Run(ctx), "invalid SOURCE_DATE_EPOCH")
+	})
+}
+
+func archiveMTimes(tb testing.TB, path, format string) map[string]time.Time {
+	tb.Helper()
+	result := map[string]time.Time{}
+	if format == "zip" {
+		zr, err := zip.OpenReader(path)
+		require.NoError(tb, err)
+		defer zr.Close()
+		for _, f := range zr.File {
+			result[f.Name] = f.Modified
+		}
+		return result
+	}
+
+	f, err := os.Open(path)
+	require.NoError(tb, err)
+	defer f.Close()
+	var r io.Reader = f
+	if format == "tar.gz" {
+		gr, err := gzip.NewReader(f)
+		require.NoError(tb, err)
+		defer gr.Close()
+		r = gr
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(tb, err)
+		if h.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		result[h.Name] = h.ModTime
+	}
+	return result
+}
+
 func TestInvalidFormat(t *testing.T) {
 	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
 		Dist:        t.TempDir(),
@@ -171,6 +1227,7 @@ func TestDefault(t *testing.T) {
 	require.Equal(t, config.Source{
 		NameTemplate: "{{ .ProjectName }}-{{ .Version }}",
 		Format:       "tar.gz",
+		ZipMethod:    "deflate",
 	}, ctx.Config.Source)
 }
 
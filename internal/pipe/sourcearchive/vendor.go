@@ -0,0 +1,70 @@
+package sourcearchive
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// vendorGoModules runs go mod vendor into a temporary directory, returning it
+// along with the files to add to the archive under vendor/.
+// The caller must remove the returned directory.
+func vendorGoModules(ctx *context.Context) (string, []config.File, error) {
+	root := cmp.Or(ctx.Config.Source.WorkTree, ".")
+	if _, err := os.Stat(filepath.Join(root, "go.mod")); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil, fmt.Errorf("source.vendor_go_modules requires a go module, but there is no go.mod in %q", root)
+		}
+		return "", nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "goreleaser-source-vendor")
+	if err != nil {
+		return "", nil, fmt.Errorf("could not vendor go modules: %w", err)
+	}
+	vendor := filepath.Join(dir, "vendor")
+
+	cmd := exec.CommandContext(ctx, cmp.Or(ctx.Config.GoMod.GoBinary, "go"), "mod", "vendor", "-o", vendor)
+	cmd.Env = append(ctx.Env.Strings(), ctx.Config.GoMod.Env...)
+	cmd.Dir = root
+	if out, err := cmd.CombinedOutput(); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("could not vendor go modules: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	// a module without dependencies has nothing to vendor.
+	var files []config.File
+	err = filepath.WalkDir(vendor, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && path == vendor {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, config.File{
+			Source:      path,
+			Destination: filepath.ToSlash(rel),
+		})
+		return nil
+	})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("could not vendor go modules: %w", err)
+	}
+	return dir, files, nil
+}
@@ -0,0 +1,104 @@
+package sourcearchive
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goreleaser/goreleaser/v2/internal/git"
+	"github.com/goreleaser/goreleaser/v2/pkg/archive"
+	"github.com/goreleaser/goreleaser/v2/pkg/archive/zip"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
+	"github.com/goreleaser/goreleaser/v2/pkg/context"
+)
+
+// archiveWorkTree archives the work tree as is, including uncommitted changes
+// and untracked files, returning the git arguments used to list them.
+// Files are listed with git-ls-files, so ignored files are left out, and the
+// .git directory is never included.
+func archiveWorkTree(ctx *context.Context, args []string, name, format, prefix string, mtime time.Time) ([]string, error) {
+	top, err := git.Clean(git.RunWithBinary(ctx, ctx.Env["GIT_BINARY"], append(slices.Clone(args), "rev-parse", "--show-toplevel")...))
+	if err != nil {
+		return nil, err
+	}
+	args = append(slices.Clone(args), "ls-files", "-z", "--cached", "--others", "--exclude-standard", "--full-name", "--", ":/")
+	out, err := git.RunWithBinary(ctx, ctx.Env["GIT_BINARY"], args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the dist directory might not be ignored, and has the archive itself.
+	dist, err := filepath.Abs(ctx.Config.Dist)
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(dist); err == nil {
+		dist = resolved
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not create archive: %w", err)
+	}
+	defer f.Close()
+	var arch archive.Archive
+	if format == "zip" {
+		arch = zip.NewWithMethod(f, zipMethod(ctx))
+	} else {
+		arch, err = archive.New(f, format)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	slices.Sort(files)
+	for _, file := range slices.Compact(files) {
+		if file == "" || isGitDir(file) {
+			continue
+		}
+		src := filepath.Join(top, filepath.FromSlash(file))
+		if strings.HasPrefix(src, dist+string(filepath.Separator)) {
+			continue
+		}
+		info, err := os.Lstat(src)
+		if os.IsNotExist(err) {
+			// deleted, but not staged yet.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			// submodules are listed as directories.
+			continue
+		}
+		if err := arch.Add(config.File{
+			Source:      src,
+			Destination: path.Join(prefix, file),
+			Info: config.FileInfo{
+				ParsedMTime: mtime,
+			},
+		}); err != nil {
+			return nil, fmt.Errorf("could not add %q to archive: %w", file, err)
+		}
+	}
+
+	if err := arch.Close(); err != nil {
+		return nil, fmt.Errorf("could not close archive file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("could not close archive file: %w", err)
+	}
+	return args, nil
+}
+
+// isGitDir tells whether the given slash separated path is in a .git
+// directory, e.g. of a nested repository.
+func isGitDir(file string) bool {
+	return slices.Contains(strings.Split(file, "/"), ".git")
+}
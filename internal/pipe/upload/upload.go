@@ -5,8 +5,11 @@ import (
 	"fmt"
 	h "net/http"
 
+	"github.com/goreleaser/goreleaser/v2/internal/artifact"
 	"github.com/goreleaser/goreleaser/v2/internal/http"
 	"github.com/goreleaser/goreleaser/v2/internal/pipe"
+	"github.com/goreleaser/goreleaser/v2/internal/skips"
+	"github.com/goreleaser/goreleaser/v2/pkg/config"
 	"github.com/goreleaser/goreleaser/v2/pkg/context"
 )
 
@@ -14,21 +17,39 @@ import (
 type Pipe struct{}
 
 // String returns the description of the pipe.
-func (Pipe) String() string                 { return "http upload" }
-func (Pipe) Skip(ctx *context.Context) bool { return len(ctx.Config.Uploads) == 0 }
+func (Pipe) String() string { return "http upload" }
+func (Pipe) Skip(ctx *context.Context) bool {
+	return skips.Any(ctx, skips.Upload) || len(ctx.Config.Uploads) == 0
+}
 
 // Default sets the pipe defaults.
 func (Pipe) Default(ctx *context.Context) error {
 	return http.Defaults(ctx.Config.Uploads)
 }
 
+// Matches returns the artifacts the given upload would upload, without
+// uploading them.
+// Extra files are not included, and an invalid mode matches nothing.
+func Matches(ctx *context.Context, upload config.Upload) []*artifact.Artifact {
+	if upload.ExtraFilesOnly {
+		return nil
+	}
+	filter, err := http.ArtifactFilter(&upload)
+	if err != nil {
+		return nil
+	}
+	return ctx.Artifacts.Filter(filter).List()
+}
+
 // Publish artifacts.
 func (Pipe) Publish(ctx *context.Context) error {
 	// Check requirements for every instance we have configured.
 	// If not fulfilled, we can skip this pipeline
 	for _, instance := range ctx.Config.Uploads {
-		if skip := http.CheckConfig(ctx, &instance, "upload"); skip != nil {
-			return pipe.Skip(skip.Error())
+		if err := http.CheckConfig(ctx, &instance, "upload"); pipe.IsSkip(err) {
+			return pipe.Skip(err.Error())
+		} else if err != nil {
+			return err
 		}
 	}
 
@@ -11,7 +11,9 @@ import (
 	"testing"
 
 	"github.com/goreleaser/goreleaser/v2/internal/artifact"
+	"github.com/goreleaser/goreleaser/v2/internal/middleware/skip"
 	"github.com/goreleaser/goreleaser/v2/internal/pipe"
+	"github.com/goreleaser/goreleaser/v2/internal/skips"
 	"github.com/goreleaser/goreleaser/v2/internal/testctx"
 	"github.com/goreleaser/goreleaser/v2/internal/testlib"
 	"github.com/goreleaser/goreleaser/v2/pkg/config"
@@ -543,6 +545,63 @@ func TestRunPipe_DirUpload(t *testing.T) {
 	require.EqualError(t, Pipe{}.Publish(ctx), `upload: upload failed: the asset to upload can't be a directory`)
 }
 
+func TestRunPipe_Skipped(t *testing.T) {
+	var requests int
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		ProjectName: "mybin",
+		Uploads: []config.Upload{
+			{
+				Method: http.MethodPut,
+				Name:   "production",
+				Mode:   "binary",
+				// would fail if the templates were evaluated.
+				Target:   server.URL + "/{{ .Nope }",
+				Username: "deployuser",
+			},
+		},
+		Env: []string{"UPLOAD_PRODUCTION_SECRET=deployuser-secret"},
+	}, testctx.Skip(skips.Upload))
+	ctx.Artifacts.Add(&artifact.Artifact{
+		Name: "mybin",
+		Path: filepath.Join(t.TempDir(), "nope"),
+		Type: artifact.UploadableBinary,
+	})
+
+	// the pipeline skips it before publishing, so no templates are evaluated
+	// and no artifacts are read.
+	require.NoError(t, skip.Maybe(Pipe{}, Pipe{}.Publish)(ctx))
+	mu.Lock()
+	defer mu.Unlock()
+	require.Zero(t, requests)
+}
+
+func TestRunPipe_HostNotAllowed(t *testing.T) {
+	ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+		ProjectName:         "mybin",
+		UploadsAllowedHosts: []string{"staging.example.com"},
+		Uploads: []config.Upload{
+			{
+				Method: http.MethodPut,
+				Name:   "production",
+				Mode:   "binary",
+				Target: "https://prod.example.com/{{ .SHA256 }}",
+			},
+		},
+	})
+	err := Pipe{}.Publish(ctx)
+	require.False(t, pipe.IsSkip(err), err)
+	require.ErrorContains(t, err, `host "prod.example.com" is not in uploads_allowed_hosts`)
+}
+
 func TestDescription(t *testing.T) {
 	require.NotEmpty(t, Pipe{}.String())
 }
@@ -677,4 +736,91 @@ func TestSkip(t *testing.T) {
 
 		require.False(t, Pipe{}.Skip(ctx))
 	})
+
+	t.Run("skip flag", func(t *testing.T) {
+		ctx := testctx.WrapWithCfg(t.Context(), config.Project{
+			Uploads: []config.Upload{
+				{},
+			},
+		}, testctx.Skip(skips.Upload))
+
+		require.True(t, Pipe{}.Skip(ctx))
+	})
+}
+
+func TestMatches(t *testing.T) {
+	ctx := testctx.Wrap(t.Context())
+	for _, a := range []struct {
+		name, id, format string
+		typ              artifact.Type
+	}{
+		{"a.deb", "foo", "", artifact.LinuxPackage},
+		{"a.rpm", "bar", "", artifact.LinuxPackage},
+		{"a.tar.gz", "foo", "tar.gz", artifact.UploadableArchive},
+		{"a.zip", "bar", "zip", artifact.UploadableArchive},
+		{"a", "foo", "", artifact.UploadableBinary},
+		{"checksums.txt", "", "", artifact.Checksum},
+	} {
+		extra := map[string]any{
+			artifact.ExtraID: a.id,
+		}
+		if a.format != "" {
+			extra[artifact.ExtraFormat] = a.format
+		} else if ext := filepath.Ext(a.name); ext != "" {
+			extra[artifact.ExtraExt] = ext
+		}
+		ctx.Artifacts.Add(&artifact.Artifact{
+			Name:  a.name,
+			Type:  a.typ,
+			Extra: extra,
+		})
+	}
+
+	names := func(artifacts []*artifact.Artifact) []string {
+		var result []string
+		for _, a := range artifacts {
+			result = append(result, a.Name)
+		}
+		return result
+	}
+
+	for name, tt := range map[string]struct {
+		upload config.Upload
+		want   []string
+	}{
+		"archive": {
+			upload: config.Upload{Mode: "archive"},
+			want:   []string{"a.deb", "a.rpm", "a.tar.gz", "a.zip"},
+		},
+		"binary": {
+			upload: config.Upload{Mode: "binary"},
+			want:   []string{"a"},
+		},
+		"archive with checksum": {
+			upload: config.Upload{Mode: "archive", Checksum: true, Exts: []string{"txt"}},
+			want:   []string{"checksums.txt"},
+		},
+		"exts": {
+			upload: config.Upload{Mode: "archive", Exts: []string{"deb", "zip"}},
+			want:   []string{"a.deb", "a.zip"},
+		},
+		"ids": {
+			upload: config.Upload{Mode: "archive", IDs: []string{"foo"}},
+			want:   []string{"a.deb", "a.tar.gz"},
+		},
+		"exts and ids": {
+			upload: config.Upload{Mode: "archive", IDs: []string{"foo"}, Exts: []string{"deb", "zip"}},
+			want:   []string{"a.deb"},
+		},
+		"extra files only": {
+			upload: config.Upload{Mode: "archive", ExtraFilesOnly: true},
+		},
+		"invalid mode": {
+			upload: config.Upload{Mode: "nope"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.ElementsMatch(t, tt.want, names(Matches(ctx, tt.upload)))
+		})
+	}
 }
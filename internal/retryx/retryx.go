@@ -80,6 +80,21 @@ func Do(ctx context.Context, c config.Retry, retryableFunc func() error, retryIf
 	return retry.Do(retryableFunc, opts(ctx, c, retryIf)...)
 }
 
+// Jitter randomizes a backoff delay, which is already capped to the
+// configured max delay.
+type Jitter func(time.Duration) time.Duration
+
+// DoWithJitter is like Do, but applies the given jitter to the backoff
+// delays.
+// Server-suggested delays are honored as is.
+func DoWithJitter(ctx context.Context, c config.Retry, retryableFunc func() error, retryIf func(error) bool, jitter Jitter) error {
+	opts := opts(ctx, c, retryIf)
+	if jitter != nil {
+		opts = append(opts, retry.DelayType(jittered(c, jitter)))
+	}
+	return retry.Do(retryableFunc, opts...)
+}
+
 func opts(ctx context.Context, c config.Retry, retryIf func(error) bool) []retry.Option {
 	opts := []retry.Option{
 		retry.Context(ctx),
@@ -108,6 +123,21 @@ func delay(n uint, err error, c *retry.Config) time.Duration {
 	return retry.BackOffDelay(n, err, c)
 }
 
+// jittered caps the exponential backoff to the max delay before applying the
+// jitter, so the jitter range doesn't get truncated by retry-go.
+func jittered(c config.Retry, jitter Jitter) retry.DelayTypeFunc {
+	return func(n uint, err error, rc *retry.Config) time.Duration {
+		if he, ok := errors.AsType[HTTPError](err); ok && he.RetryAfter > 0 {
+			return he.RetryAfter
+		}
+		d := retry.BackOffDelay(n, err, rc)
+		if c.MaxDelay > 0 {
+			d = min(d, c.MaxDelay)
+		}
+		return jitter(d)
+	}
+}
+
 // IsNetworkError returns true if the error looks like a transient network error.
 func IsNetworkError(err error) bool {
 	if err == nil {
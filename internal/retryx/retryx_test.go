@@ -123,6 +123,27 @@ func TestDoRetryIf(t *testing.T) {
 	})
 }
 
+func TestDoWithJitter(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		c := config.Retry{
+			Attempts: 4,
+			Delay:    10 * time.Second,
+			MaxDelay: 15 * time.Second,
+		}
+		var delays []time.Duration
+		start := time.Now()
+		err := DoWithJitter(t.Context(), c, func() error {
+			return errors.New("always fails")
+		}, nil, func(d time.Duration) time.Duration {
+			delays = append(delays, d)
+			return d / 2
+		})
+		require.ErrorContains(t, err, "always fails")
+		require.Equal(t, []time.Duration{10 * time.Second, 15 * time.Second, 15 * time.Second}, delays)
+		require.Equal(t, 20*time.Second, time.Since(start))
+	})
+}
+
 func TestDoWithDataSuccess(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
 		val, err := DoWithData(t.Context(), retryConfig(3), func() (string, error) {
@@ -38,6 +38,7 @@ const (
 	Archive        Key = "archive"
 	MCP            Key = "mcp"
 	SRPM           Key = "srpm"
+	Upload         Key = "upload"
 )
 
 func String(ctx *context.Context) string {
@@ -130,6 +131,7 @@ var Release = Keys{
 	Makeself,
 	Flatpak,
 	SRPM,
+	Upload,
 	Before,
 	Notarize,
 	Archive,
@@ -16,23 +16,45 @@ import (
 
 // Archive zip struct.
 type Archive struct {
-	z     *zip.Writer
-	files map[string]bool
+	z      *zip.Writer
+	files  map[string]bool
+	method uint16
 }
 
 // New zip archive.
 func New(target io.Writer) Archive {
+	return NewWithMethod(target, zip.Deflate)
+}
+
+// NewWithMethod creates a zip archive whose files are written with the given
+// compression method, i.e. zip.Deflate or zip.Store.
+func NewWithMethod(target io.Writer, method uint16) Archive {
 	compressor := zip.NewWriter(target)
 	compressor.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
 		return flate.NewWriter(out, flate.BestCompression)
 	})
 	return Archive{
-		z:     compressor,
-		files: map[string]bool{},
+		z:      compressor,
+		files:  map[string]bool{},
+		method: method,
 	}
 }
 
+// Copy copies the source zip into a new one, which can be appended at.
+// The copied files are stored uncompressed, and the appended ones deflated.
 func Copy(source *os.File, target io.Writer) (Archive, error) {
+	return copyZip(source, target, zip.Store, zip.Deflate)
+}
+
+// CopyWithMethod is like Copy, but the files, both the copied and the
+// appended ones, are written with the given compression method.
+func CopyWithMethod(source *os.File, target io.Writer, method uint16) (Archive, error) {
+	return copyZip(source, target, method, method)
+}
+
+// copyZip copies the source zip into a new one, writing the copied files with
+// copyMethod, and the ones appended later with method.
+func copyZip(source *os.File, target io.Writer, copyMethod, method uint16) (Archive, error) {
 	info, err := source.Stat()
 	if err != nil {
 		return Archive{}, err
@@ -41,15 +63,17 @@ func Copy(source *os.File, target io.Writer) (Archive, error) {
 	if err != nil {
 		return Archive{}, err
 	}
-	w := New(target)
+	w := NewWithMethod(target, method)
 	for _, zf := range r.File {
 		w.files[zf.Name] = true
 		hdr := zip.FileHeader{
 			Name:               zf.Name,
+			Method:             copyMethod,
 			UncompressedSize64: zf.UncompressedSize64,
 			UncompressedSize:   zf.UncompressedSize,
 			CreatorVersion:     zf.CreatorVersion,
 			ExternalAttrs:      zf.ExternalAttrs,
+			Modified:           zf.Modified,
 		}
 		ww, err := w.z.CreateHeader(&hdr)
 		if err != nil {
@@ -94,7 +118,7 @@ func (a Archive) Add(f config.File) error {
 		return err
 	}
 	header.Name = f.Destination
-	header.Method = zip.Deflate
+	header.Method = a.method
 	if !f.Info.ParsedMTime.IsZero() {
 		header.Modified = f.Info.ParsedMTime
 	}
@@ -166,4 +166,67 @@ func TestTarInvalidLink(t *testing.T) {
 	}))
 }
 
-// TODO: add copying test
+func TestZipMethod(t *testing.T) {
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		var buf bytes.Buffer
+		archive := NewWithMethod(&buf, method)
+		require.NoError(t, archive.Add(config.File{
+			Source:      "../testdata/foo.txt",
+			Destination: "foo.txt",
+		}))
+		require.NoError(t, archive.Close())
+
+		path := filepath.Join(t.TempDir(), "test.zip")
+		require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+		src, err := os.Open(path)
+		require.NoError(t, err)
+		defer src.Close()
+
+		var copied bytes.Buffer
+		archive, err = CopyWithMethod(src, &copied, method)
+		require.NoError(t, err)
+		require.NoError(t, archive.Add(config.File{
+			Source:      "../testdata/foo.txt",
+			Destination: "bar.txt",
+		}))
+		require.NoError(t, archive.Close())
+
+		r, err := zip.NewReader(bytes.NewReader(copied.Bytes()), int64(copied.Len()))
+		require.NoError(t, err)
+		require.Len(t, r.File, 2)
+		for _, f := range r.File {
+			require.Equal(t, method, f.Method, f.Name)
+		}
+	}
+}
+
+func TestZipCopy(t *testing.T) {
+	var buf bytes.Buffer
+	archive := New(&buf)
+	require.NoError(t, archive.Add(config.File{
+		Source:      "../testdata/foo.txt",
+		Destination: "foo.txt",
+	}))
+	require.NoError(t, archive.Close())
+
+	path := filepath.Join(t.TempDir(), "test.zip")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+	src, err := os.Open(path)
+	require.NoError(t, err)
+	defer src.Close()
+
+	var copied bytes.Buffer
+	archive, err = Copy(src, &copied)
+	require.NoError(t, err)
+	require.NoError(t, archive.Add(config.File{
+		Source:      "../testdata/foo.txt",
+		Destination: "bar.txt",
+	}))
+	require.NoError(t, archive.Close())
+
+	r, err := zip.NewReader(bytes.NewReader(copied.Bytes()), int64(copied.Len()))
+	require.NoError(t, err)
+	require.Len(t, r.File, 2)
+	require.Equal(t, zip.Store, r.File[0].Method)
+	require.Equal(t, zip.Deflate, r.File[1].Method)
+}
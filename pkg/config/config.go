@@ -1287,6 +1287,26 @@ type Blob struct {
 	ExtraFilesOnly     bool        `yaml:"extra_files_only,omitempty" json:"extra_files_only,omitempty"`
 }
 
+// UploadOAuth2 configures the OAuth2 client credentials used by an upload.
+type UploadOAuth2 struct {
+	TokenURL     string   `yaml:"token_url,omitempty" json:"token_url,omitempty"`
+	ClientID     string   `yaml:"client_id,omitempty" json:"client_id,omitempty"`
+	ClientSecret string   `yaml:"client_secret,omitempty" json:"client_secret,omitempty"`
+	Scopes       []string `yaml:"scopes,omitempty" json:"scopes,omitempty"`
+}
+
+// UploadClientX509 is a client certificate and its key.
+type UploadClientX509 struct {
+	Cert string `yaml:"cert,omitempty" json:"cert,omitempty"`
+	Key  string `yaml:"key,omitempty" json:"key,omitempty"`
+}
+
+// UploadCredentials are the username and password of an upload.
+type UploadCredentials struct {
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+}
+
 // Upload configuration.
 type Upload struct {
 	Name               string            `yaml:"name,omitempty" json:"name,omitempty"`
@@ -1303,6 +1323,7 @@ type Upload struct {
 	Checksum           bool              `yaml:"checksum,omitempty" json:"checksum,omitempty"`
 	Signature          bool              `yaml:"signature,omitempty" json:"signature,omitempty"`
 	Meta               bool              `yaml:"meta,omitempty" json:"meta,omitempty"`
+	SBOM               bool              `yaml:"sbom,omitempty" json:"sbom,omitempty"`
 	CustomArtifactName bool              `yaml:"custom_artifact_name,omitempty" json:"custom_artifact_name,omitempty"`
 	CustomHeaders      map[string]string `yaml:"custom_headers,omitempty" json:"custom_headers,omitempty"`
 	ExtraFiles         []ExtraFile       `yaml:"extra_files,omitempty" json:"extra_files,omitempty"`
@@ -1311,6 +1332,81 @@ type Upload struct {
 
 	// Since v2.12
 	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+
+	// Since v2.17
+	SuccessCodes                map[string][]int             `yaml:"success_codes,omitempty" json:"success_codes,omitempty"`
+	Strict                      bool                         `yaml:"strict,omitempty" json:"strict,omitempty"`
+	VerifyGzip                  bool                         `yaml:"verify_gzip,omitempty" json:"verify_gzip,omitempty"`
+	BodyMode                    string                       `yaml:"body_mode,omitempty" json:"body_mode,omitempty" jsonschema:"enum=file,enum=empty,enum=json_envelope,enum=form,default=file"`
+	JSONEnvelope                map[string]string            `yaml:"json_envelope,omitempty" json:"json_envelope,omitempty"`
+	ResolveHost                 string                       `yaml:"resolve_host,omitempty" json:"resolve_host,omitempty"`
+	ResolveAddr                 string                       `yaml:"resolve_addr,omitempty" json:"resolve_addr,omitempty"`
+	FastHash                    bool                         `yaml:"fast_hash,omitempty" json:"fast_hash,omitempty"`
+	ChecksumEncoding            string                       `yaml:"checksum_encoding,omitempty" json:"checksum_encoding,omitempty" jsonschema:"enum=hex,enum=base64,default=hex"`
+	GroupTemplate               string                       `yaml:"group_template,omitempty" json:"group_template,omitempty"`
+	ContinueOnError             bool                         `yaml:"continue_on_error,omitempty" json:"continue_on_error,omitempty"`
+	CaptureCIDJSONPath          string                       `yaml:"capture_cid_json_path,omitempty" json:"capture_cid_json_path,omitempty"`
+	VersionHeader               string                       `yaml:"version_header,omitempty" json:"version_header,omitempty"`
+	SSHKey                      string                       `yaml:"ssh_key,omitempty" json:"ssh_key,omitempty"`
+	SSHKnownHosts               string                       `yaml:"ssh_known_hosts,omitempty" json:"ssh_known_hosts,omitempty"`
+	PerFileChecksum             bool                         `yaml:"per_file_checksum,omitempty" json:"per_file_checksum,omitempty"`
+	NameTemplate                string                       `yaml:"name_template,omitempty" json:"name_template,omitempty"`
+	OAuth2                      UploadOAuth2                 `yaml:"oauth2,omitempty" json:"oauth2,omitempty"`
+	MaxFileSize                 string                       `yaml:"max_file_size,omitempty" json:"max_file_size,omitempty"`
+	ChecksumTrailer             bool                         `yaml:"checksum_trailer,omitempty" json:"checksum_trailer,omitempty"`
+	Compress                    bool                         `yaml:"compress,omitempty" json:"compress,omitempty"`
+	CompressSkipExts            []string                     `yaml:"compress_skip_exts,omitempty" json:"compress_skip_exts,omitempty"`
+	CompressAlgo                string                       `yaml:"compress_algo,omitempty" json:"compress_algo,omitempty" jsonschema:"enum=gzip,enum=br,default=gzip"`
+	FormFields                  map[string]string            `yaml:"form_fields,omitempty" json:"form_fields,omitempty"`
+	FormChecksumField           string                       `yaml:"form_checksum_field,omitempty" json:"form_checksum_field,omitempty"`
+	EnvPrefix                   string                       `yaml:"env_prefix,omitempty" json:"env_prefix,omitempty"`
+	VerifyAfterUpload           bool                         `yaml:"verify_after_upload,omitempty" json:"verify_after_upload,omitempty"`
+	VerifyMode                  string                       `yaml:"verify_mode,omitempty" json:"verify_mode,omitempty" jsonschema:"enum=full,enum=sample,default=full"`
+	SkipExisting                bool                         `yaml:"skip_existing,omitempty" json:"skip_existing,omitempty"`
+	ExistsMethod                string                       `yaml:"exists_method,omitempty" json:"exists_method,omitempty" jsonschema:"enum=HEAD,enum=PROPFIND,default=HEAD"`
+	DeltaFrom                   string                       `yaml:"delta_from,omitempty" json:"delta_from,omitempty"`
+	RetryJitter                 string                       `yaml:"retry_jitter,omitempty" json:"retry_jitter,omitempty" jsonschema:"enum=none,enum=full,enum=equal,default=none"`
+	RangeChunkSize              string                       `yaml:"range_chunk_size,omitempty" json:"range_chunk_size,omitempty"`
+	RangeParallelism            int                          `yaml:"range_parallelism,omitempty" json:"range_parallelism,omitempty"`
+	ClientX509ByHost            map[string]UploadClientX509  `yaml:"client_x509_by_host,omitempty" json:"client_x509_by_host,omitempty"`
+	SidecarTemplate             string                       `yaml:"sidecar_template,omitempty" json:"sidecar_template,omitempty"`
+	SidecarExt                  string                       `yaml:"sidecar_ext,omitempty" json:"sidecar_ext,omitempty"`
+	FailureThreshold            int                          `yaml:"failure_threshold,omitempty" json:"failure_threshold,omitempty"`
+	Timeout                     string                       `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	ConnectTimeout              string                       `yaml:"connect_timeout,omitempty" json:"connect_timeout,omitempty"`
+	Mirrors                     []string                     `yaml:"mirrors,omitempty" json:"mirrors,omitempty"`
+	MirrorBestEffort            bool                         `yaml:"mirror_best_effort,omitempty" json:"mirror_best_effort,omitempty"`
+	BufferThreshold             string                       `yaml:"buffer_threshold,omitempty" json:"buffer_threshold,omitempty"`
+	UnixSocket                  string                       `yaml:"unix_socket,omitempty" json:"unix_socket,omitempty"`
+	CredentialsByRealm          map[string]UploadCredentials `yaml:"credentials_by_realm,omitempty" json:"credentials_by_realm,omitempty"`
+	Dedupe                      bool                         `yaml:"dedupe,omitempty" json:"dedupe,omitempty"`
+	RemoteCredentials           UploadCredentials            `yaml:"remote_credentials,omitempty" json:"remote_credentials,omitempty"`
+	VerifySize                  bool                         `yaml:"verify_size,omitempty" json:"verify_size,omitempty"`
+	FallbackTarget              string                       `yaml:"fallback_target,omitempty" json:"fallback_target,omitempty"`
+	ProvenanceHeaders           bool                         `yaml:"provenance_headers,omitempty" json:"provenance_headers,omitempty"`
+	IdempotencyKeyHeader        string                       `yaml:"idempotency_key_header,omitempty" json:"idempotency_key_header,omitempty"`
+	FailIfEmpty                 bool                         `yaml:"fail_if_empty,omitempty" json:"fail_if_empty,omitempty"`
+	CaptureHeaders              []string                     `yaml:"capture_headers,omitempty" json:"capture_headers,omitempty"`
+	TmpDir                      string                       `yaml:"tmp_dir,omitempty" json:"tmp_dir,omitempty"`
+	BodySchema                  string                       `yaml:"body_schema,omitempty" json:"body_schema,omitempty"`
+	InitiateTarget              string                       `yaml:"initiate_target,omitempty" json:"initiate_target,omitempty"`
+	UploadURLJSONPath           string                       `yaml:"upload_url_json_path,omitempty" json:"upload_url_json_path,omitempty"`
+	Trace                       bool                         `yaml:"trace,omitempty" json:"trace,omitempty"`
+	MtimeHeader                 string                       `yaml:"mtime_header,omitempty" json:"mtime_header,omitempty"`
+	ChecksumOptional            bool                         `yaml:"checksum_optional,omitempty" json:"checksum_optional,omitempty"`
+	DisplayName                 string                       `yaml:"display_name,omitempty" json:"display_name,omitempty"`
+	VerifyAcceptGzip            bool                         `yaml:"verify_accept_gzip,omitempty" json:"verify_accept_gzip,omitempty"`
+	SuccessHeader               string                       `yaml:"success_header,omitempty" json:"success_header,omitempty"`
+	SuccessHeaderValue          string                       `yaml:"success_header_value,omitempty" json:"success_header_value,omitempty"`
+	MaxBytesPerSecond           int64                        `yaml:"max_bytes_per_second,omitempty" json:"max_bytes_per_second,omitempty"`
+	UploadURLHeader             string                       `yaml:"upload_url_header,omitempty" json:"upload_url_header,omitempty"`
+	CanonicalizeArchiveChecksum bool                         `yaml:"canonicalize_archive_checksum,omitempty" json:"canonicalize_archive_checksum,omitempty"`
+	Expect100Continue           bool                         `yaml:"expect_100_continue,omitempty" json:"expect_100_continue,omitempty"`
+	ExtraFilter                 map[string]string            `yaml:"extra_filter,omitempty" json:"extra_filter,omitempty"`
+	HashFanout                  int                          `yaml:"hash_fanout,omitempty" json:"hash_fanout,omitempty"`
+	ChunkChecksum               bool                         `yaml:"chunk_checksum,omitempty" json:"chunk_checksum,omitempty"`
+	OnCollision                 string                       `yaml:"on_collision,omitempty" json:"on_collision,omitempty" jsonschema:"enum=overwrite,enum=error,enum=rename"`
+	RawRequestTemplate          string                       `yaml:"raw_request_template,omitempty" json:"raw_request_template,omitempty"`
 }
 
 // Publisher configuration.
@@ -1329,11 +1425,28 @@ type Publisher struct {
 
 // Source configuration.
 type Source struct {
-	NameTemplate   string `yaml:"name_template,omitempty" json:"name_template,omitempty"`
-	Format         string `yaml:"format,omitempty" json:"format,omitempty" jsonschema:"enum=tar,enum=tgz,enum=tar.gz,enum=zip,default=tar.gz"`
-	Enabled        bool   `yaml:"enabled,omitempty" json:"enabled,omitempty"`
-	PrefixTemplate string `yaml:"prefix_template,omitempty" json:"prefix_template,omitempty"`
-	Files          []File `yaml:"files,omitempty" json:"files,omitempty"`
+	NameTemplate         string `yaml:"name_template,omitempty" json:"name_template,omitempty"`
+	Format               string `yaml:"format,omitempty" json:"format,omitempty" jsonschema:"enum=tar,enum=tgz,enum=tar.gz,enum=zip,default=tar.gz"`
+	Enabled              bool   `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	PrefixTemplate       string `yaml:"prefix_template,omitempty" json:"prefix_template,omitempty"`
+	Files                []File `yaml:"files,omitempty" json:"files,omitempty"`
+	GitDir               string `yaml:"git_dir,omitempty" json:"git_dir,omitempty"`
+	WorkTree             string `yaml:"work_tree,omitempty" json:"work_tree,omitempty"`
+	InfoFile             string `yaml:"info_file,omitempty" json:"info_file,omitempty"`
+	AllowShallow         bool   `yaml:"allow_shallow,omitempty" json:"allow_shallow,omitempty"`
+	Ref                  string `yaml:"ref,omitempty" json:"ref,omitempty"`
+	WriteArchiveInfo     bool   `yaml:"write_archive_info,omitempty" json:"write_archive_info,omitempty"`
+	IncludeUncommitted   bool   `yaml:"include_uncommitted,omitempty" json:"include_uncommitted,omitempty"`
+	NoPrefix             bool   `yaml:"no_prefix,omitempty" json:"no_prefix,omitempty"`
+	PreArchiveHooks      Hooks  `yaml:"pre_archive_hooks,omitempty" json:"pre_archive_hooks,omitempty"`
+	PostArchiveHooks     Hooks  `yaml:"post_archive_hooks,omitempty" json:"post_archive_hooks,omitempty"`
+	ZipMethod            string `yaml:"zip_method,omitempty" json:"zip_method,omitempty" jsonschema:"enum=deflate,enum=store,default=deflate"`
+	DiffFrom             string `yaml:"diff_from,omitempty" json:"diff_from,omitempty"`
+	Cache                bool   `yaml:"cache,omitempty" json:"cache,omitempty"`
+	VendorGoModules      bool   `yaml:"vendor_go_modules,omitempty" json:"vendor_go_modules,omitempty"`
+	ZipZeroExternalAttrs bool   `yaml:"zip_zero_external_attrs,omitempty" json:"zip_zero_external_attrs,omitempty"`
+	EmbedChangelog       bool   `yaml:"embed_changelog,omitempty" json:"embed_changelog,omitempty"`
+	FileList             bool   `yaml:"file_list,omitempty" json:"file_list,omitempty"`
 }
 
 // Project includes all project configuration.
@@ -1388,6 +1501,12 @@ type Project struct {
 	MCP               MCP               `yaml:"mcp,omitempty" json:"mcp,omitempty"`
 	Retry             Retry             `yaml:"retry,omitempty" json:"retry,omitempty"`
 
+	// hosts uploads and artifactories are allowed to upload to
+	UploadsAllowedHosts []string `yaml:"uploads_allowed_hosts,omitempty" json:"uploads_allowed_hosts,omitempty"`
+
+	// maximum in-flight requests of all uploads and artifactories
+	UploadsParallelism int `yaml:"uploads_parallelism,omitempty" json:"uploads_parallelism,omitempty"`
+
 	// force the SCM token to use when multiple are set
 	ForceToken string `yaml:"force_token,omitempty" json:"force_token,omitempty" jsonschema:"enum=github,enum=gitlab,enum=gitea,enum=,default="`
 
@@ -110,10 +110,18 @@ type Context struct {
 	Semver            Semver
 	Runtime           Runtime
 	Skips             map[string]bool
+	SkippedUploads    []SkippedUpload
 
 	NotifiedDeprecations map[string]struct{}
 }
 
+// SkippedUpload records an upload which was skipped, and why.
+type SkippedUpload struct {
+	Kind   string
+	Name   string
+	Reason string
+}
+
 type Runtime struct {
 	Goos   string
 	Goarch string